@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pbouamriou/lock-analyzer/formatters"
 	"github.com/pbouamriou/lock-analyzer/i18n"
+	"github.com/pbouamriou/lock-analyzer/lockanalyzer"
 
 	_ "github.com/lib/pq"
 	"github.com/uptrace/bun"
@@ -25,13 +30,27 @@ func main() {
 	translator := i18n.NewTranslator(lang)
 
 	// Flag configuration with localized descriptions
+	defaults := lockanalyzer.DefaultAnalyzerOptions()
 	var (
-		dsn      = flag.String("dsn", "", translator.T("cli_dsn_description"))
-		format   = flag.String("format", "markdown", translator.T("cli_format_description"))
-		langFlag = flag.String("lang", lang, translator.T("cli_lang_description"))
-		output   = flag.String("output", "stdout", translator.T("cli_output_description"))
-		interval = flag.Duration("interval", 0, translator.T("cli_interval_description"))
-		help     = flag.Bool("help", false, translator.T("cli_help_description"))
+		dsn       = flag.String("dsn", "", translator.T("cli_dsn_description"))
+		format    = flag.String("format", "markdown", translator.T("cli_format_description"))
+		langFlag  = flag.String("lang", lang, translator.T("cli_lang_description"))
+		output    = flag.String("output", "stdout", translator.T("cli_output_description"))
+		interval  = flag.Duration("interval", 0, translator.T("cli_interval_description"))
+		timeout   = flag.Duration("timeout", defaults.QueryTimeout, translator.T("cli_timeout_description"))
+		include   = flag.String("include-schemas", "", translator.T("cli_include_schemas_description"))
+		exclude   = flag.String("exclude-schemas", "", translator.T("cli_exclude_schemas_description"))
+		databases = flag.String("databases", "", translator.T("cli_databases_description"))
+		longTxn   = flag.Duration("long-txn-threshold", defaults.LongTransactionThreshold, translator.T("cli_long_txn_threshold_description"))
+		longWait  = flag.Duration("long-wait-threshold", defaults.LongWaitThreshold, translator.T("cli_long_wait_threshold_description"))
+		idleTxn   = flag.Duration("idle-txn-threshold", defaults.IdleTransactionThreshold, translator.T("cli_idle_txn_threshold_description"))
+		prepared  = flag.Duration("prepared-txn-threshold", defaults.PreparedTransactionThreshold, translator.T("cli_prepared_txn_threshold_description"))
+		lockCount = flag.Int("lock-count-threshold", defaults.LockCountThreshold, translator.T("cli_lock_count_threshold_description"))
+		rowLocks  = flag.String("row-lock-tables", "", translator.T("cli_row_lock_tables_description"))
+		conflicts = flag.Duration("conflict-sample-interval", defaults.ConflictSampleInterval, translator.T("cli_conflict_sample_interval_description"))
+		snapshot  = flag.String("snapshot", "", translator.T("cli_snapshot_description"))
+		saveSnap  = flag.String("save-snapshot", "", translator.T("cli_save_snapshot_description"))
+		help      = flag.Bool("help", false, translator.T("cli_help_description"))
 	)
 	flag.Parse()
 
@@ -47,7 +66,7 @@ func main() {
 	}
 
 	// Parameter validation
-	if *dsn == "" {
+	if *dsn == "" && *snapshot == "" {
 		log.Fatal(translator.T("cli_dsn_required"))
 	}
 
@@ -63,12 +82,38 @@ func main() {
 		log.Fatalf(translator.T("cli_invalid_language"), *langFlag)
 	}
 
-	// Database connection
-	db, err := connectDB(*dsn)
-	if err != nil {
-		log.Fatalf(translator.T("cli_db_connection_error"), err)
+	// Analyzer options
+	opts := defaults
+	opts.QueryTimeout = *timeout
+	opts.IncludeSchemas = splitList(*include)
+	opts.ExcludeSchemas = splitList(*exclude)
+	opts.Databases = splitList(*databases)
+	opts.LongTransactionThreshold = *longTxn
+	opts.LongWaitThreshold = *longWait
+	opts.IdleTransactionThreshold = *idleTxn
+	opts.PreparedTransactionThreshold = *prepared
+	opts.LockCountThreshold = *lockCount
+	opts.RowLockTables = splitList(*rowLocks)
+	opts.ConflictSampleInterval = *conflicts
+	if err := opts.Validate(); err != nil {
+		log.Fatalf(translator.T("cli_invalid_options"), err)
+	}
+
+	// Snapshot source: a saved snapshot or the live database
+	var source lockanalyzer.Source
+	if *snapshot != "" {
+		source = lockanalyzer.NewFileSource(*snapshot)
+	} else {
+		db, err := connectDB(*dsn)
+		if err != nil {
+			log.Fatalf(translator.T("cli_db_connection_error"), err)
+		}
+		defer db.Close()
+		source = lockanalyzer.NewClusterSource(db, databaseConnector(*dsn))
+	}
+	if *saveSnap != "" {
+		source = &savingSource{source: source, filename: *saveSnap}
 	}
-	defer db.Close()
 
 	// Create formatter
 	formatter, err := formatters.NewFormatter(*format, *langFlag)
@@ -76,14 +121,18 @@ func main() {
 		log.Fatalf(translator.T("cli_formatter_error"), err)
 	}
 
+	// Stop collecting on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Real-time monitoring mode
 	if *interval > 0 {
-		runRealTimeMonitoring(db, formatter, *interval, *output, translator)
+		runRealTimeMonitoring(ctx, source, opts, formatter, *interval, *output, translator)
 		return
 	}
 
 	// Single report mode
-	generateSingleReport(db, formatter, *output, translator)
+	generateSingleReport(ctx, source, opts, formatter, *output, translator)
 }
 
 // getLanguageFromEnv detects the system language from environment variables
@@ -113,6 +162,17 @@ func getLanguageFromEnv() string {
 	return "fr" // Default to French
 }
 
+// splitList splits a comma-separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func printHelp(translator *i18n.Translator) {
 	fmt.Printf(`🔒 %s
 
@@ -141,6 +201,50 @@ func printHelp(translator *i18n.Translator) {
         %s
         %s
 
+  -timeout duration
+        %s
+        %s
+
+  -include-schemas string
+        %s
+        %s
+
+  -exclude-schemas string
+        %s
+        %s
+
+  -databases string
+        %s
+        %s
+
+  -long-txn-threshold duration
+        %s
+
+  -long-wait-threshold duration
+        %s
+
+  -idle-txn-threshold duration
+        %s
+
+  -prepared-txn-threshold duration
+        %s
+
+  -lock-count-threshold int
+        %s
+
+  -row-lock-tables string
+        %s
+        %s
+
+  -conflict-sample-interval duration
+        %s
+
+  -snapshot string
+        %s
+
+  -save-snapshot string
+        %s
+
   -help
         %s
 
@@ -171,6 +275,24 @@ func printHelp(translator *i18n.Translator) {
 		translator.T("cli_output_use"),
 		translator.T("cli_interval_description"),
 		translator.T("cli_interval_examples"),
+		translator.T("cli_timeout_description"),
+		translator.T("cli_timeout_examples"),
+		translator.T("cli_include_schemas_description"),
+		translator.T("cli_include_schemas_examples"),
+		translator.T("cli_exclude_schemas_description"),
+		translator.T("cli_exclude_schemas_examples"),
+		translator.T("cli_databases_description"),
+		translator.T("cli_databases_examples"),
+		translator.T("cli_long_txn_threshold_description"),
+		translator.T("cli_long_wait_threshold_description"),
+		translator.T("cli_idle_txn_threshold_description"),
+		translator.T("cli_prepared_txn_threshold_description"),
+		translator.T("cli_lock_count_threshold_description"),
+		translator.T("cli_row_lock_tables_description"),
+		translator.T("cli_row_lock_tables_examples"),
+		translator.T("cli_conflict_sample_interval_description"),
+		translator.T("cli_snapshot_description"),
+		translator.T("cli_save_snapshot_description"),
 		translator.T("cli_help_description"),
 		translator.T("cli_examples"),
 		translator.T("cli_example_1"),
@@ -195,24 +317,91 @@ func connectDB(dsn string) (*bun.DB, error) {
 	return db, nil
 }
 
-func generateSingleReport(db *bun.DB, formatter formatters.LockReportFormatter, output string, translator *i18n.Translator) {
+// databaseConnector opens connections to the other databases of the server with the settings of the DSN
+func databaseConnector(dsn string) lockanalyzer.Connector {
+	return func(ctx context.Context, database string) (*bun.DB, error) {
+		databaseDSN, err := dsnForDatabase(dsn, database)
+		if err != nil {
+			return nil, err
+		}
+
+		sqldb, err := sql.Open("postgres", databaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		sqldb.SetMaxOpenConns(1)
+
+		if err := sqldb.PingContext(ctx); err != nil {
+			sqldb.Close()
+			return nil, fmt.Errorf("unable to connect to database %s: %v", database, err)
+		}
+
+		return bun.NewDB(sqldb, pgdialect.New()), nil
+	}
+}
+
+// dsnForDatabase returns the DSN connecting to another database, the DSN being a URL or a
+// keyword/value connection string
+func dsnForDatabase(dsn, database string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		u.Path = "/" + database
+		u.RawPath = ""
+		return u.String(), nil
+	}
+
+	// The last value of a keyword wins
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(database)
+	return dsn + " dbname='" + quoted + "'", nil
+}
+
+// savingSource saves every snapshot taken from the wrapped source to a file, so that it can be analyzed later
+type savingSource struct {
+	source   lockanalyzer.Source
+	filename string
+}
+
+// Snapshot takes a snapshot from the wrapped source and saves it
+func (s *savingSource) Snapshot(ctx context.Context, opts lockanalyzer.AnalyzerOptions) (*lockanalyzer.Snapshot, error) {
+	snapshot, err := s.source.Snapshot(ctx, opts)
+	if snapshot == nil {
+		return nil, err
+	}
+
+	file, createErr := os.Create(s.filename)
+	if createErr != nil {
+		return nil, fmt.Errorf("error creating snapshot file %s: %v", s.filename, createErr)
+	}
+	defer file.Close()
+
+	if writeErr := lockanalyzer.WriteSnapshot(snapshot, file); writeErr != nil {
+		return nil, writeErr
+	}
+
+	return snapshot, err
+}
+
+func generateSingleReport(ctx context.Context, source lockanalyzer.Source, opts lockanalyzer.AnalyzerOptions, formatter formatters.LockReportFormatter, output string, translator *i18n.Translator) {
 	fmt.Printf("🔍 %s\n", translator.T("cli_generating_report"))
 
 	if output == "stdout" {
 		// Display to stdout
-		if err := formatters.GenerateAndDisplayReport(db, formatter); err != nil {
+		if err := formatters.GenerateAndDisplaySourceReport(ctx, source, opts, formatter); err != nil {
 			log.Fatalf(translator.T("cli_report_generation_error"), err)
 		}
 	} else {
 		// Write to file
-		if err := formatters.GenerateAndWriteReport(db, formatter, output); err != nil {
+		if err := formatters.GenerateAndWriteSourceReport(ctx, source, opts, formatter, output); err != nil {
 			log.Fatalf(translator.T("cli_report_writing_error"), err)
 		}
 		fmt.Printf("✅ %s: %s\n", translator.T("cli_report_generated"), output)
 	}
 }
 
-func runRealTimeMonitoring(db *bun.DB, formatter formatters.LockReportFormatter, interval time.Duration, output string, translator *i18n.Translator) {
+func runRealTimeMonitoring(ctx context.Context, source lockanalyzer.Source, opts lockanalyzer.AnalyzerOptions, formatter formatters.LockReportFormatter, interval time.Duration, output string, translator *i18n.Translator) {
 	fmt.Printf("🔍 %s\n", fmt.Sprintf(translator.T("cli_realtime_monitoring"), interval))
 	fmt.Printf("📁 %s: %s\n", translator.T("cli_output"), output)
 	fmt.Printf("⏹️  %s\n\n", translator.T("cli_press_ctrl_c"))
@@ -220,10 +409,6 @@ func runRealTimeMonitoring(db *bun.DB, formatter formatters.LockReportFormatter,
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	// Interrupt handling
-	sigChan := make(chan os.Signal, 1)
-	// signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
 	counter := 0
 	for {
 		select {
@@ -233,7 +418,7 @@ func runRealTimeMonitoring(db *bun.DB, formatter formatters.LockReportFormatter,
 
 			if output == "stdout" {
 				fmt.Printf("\n--- %s #%d (%s) ---\n", translator.T("cli_analysis"), counter, timestamp)
-				if err := formatters.GenerateAndDisplayReport(db, formatter); err != nil {
+				if err := formatters.GenerateAndDisplaySourceReport(ctx, source, opts, formatter); err != nil {
 					log.Printf(translator.T("cli_report_generation_error"), err)
 				}
 			} else {
@@ -245,14 +430,14 @@ func runRealTimeMonitoring(db *bun.DB, formatter formatters.LockReportFormatter,
 					counter,
 					ext)
 
-				if err := formatters.GenerateAndWriteReport(db, formatter, filename); err != nil {
+				if err := formatters.GenerateAndWriteSourceReport(ctx, source, opts, formatter, filename); err != nil {
 					log.Printf(translator.T("cli_report_writing_error"), err)
 				} else {
 					fmt.Printf("✅ %s #%d: %s\n", translator.T("cli_report_generated"), counter, filename)
 				}
 			}
 
-		case <-sigChan:
+		case <-ctx.Done():
 			fmt.Printf("\n🛑 %s\n", translator.T("cli_monitoring_stopped"))
 			return
 		}
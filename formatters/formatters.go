@@ -1,6 +1,7 @@
 package formatters
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -48,8 +49,18 @@ func GetAvailableLanguages() []string {
 
 // GenerateAndWriteReport generates a report and writes it using the specified formatter
 func GenerateAndWriteReport(db *bun.DB, formatter LockReportFormatter, filename string) error {
+	return GenerateAndWriteReportContext(context.Background(), db, lockanalyzer.DefaultAnalyzerOptions(), formatter, filename)
+}
+
+// GenerateAndWriteReportContext generates a report with the given options and writes it using the specified formatter
+func GenerateAndWriteReportContext(ctx context.Context, db bun.IDB, opts lockanalyzer.AnalyzerOptions, formatter LockReportFormatter, filename string) error {
+	return GenerateAndWriteSourceReport(ctx, lockanalyzer.NewPostgresSource(db), opts, formatter, filename)
+}
+
+// GenerateAndWriteSourceReport generates a report from a snapshot source and writes it using the specified formatter
+func GenerateAndWriteSourceReport(ctx context.Context, source lockanalyzer.Source, opts lockanalyzer.AnalyzerOptions, formatter LockReportFormatter, filename string) error {
 	// Generate report data
-	reportData, err := lockanalyzer.GenerateLocksReport(db)
+	reportData, err := lockanalyzer.GenerateReport(ctx, source, opts)
 	if err != nil {
 		return fmt.Errorf("error generating report data: %v", err)
 	}
@@ -71,8 +82,20 @@ func GenerateAndWriteReport(db *bun.DB, formatter LockReportFormatter, filename
 
 // GenerateAndDisplayReport generates a report and displays it on stdout using the specified formatter
 func GenerateAndDisplayReport(db *bun.DB, formatter LockReportFormatter) error {
+	return GenerateAndDisplayReportContext(context.Background(), db, lockanalyzer.DefaultAnalyzerOptions(), formatter)
+}
+
+// GenerateAndDisplayReportContext generates a report with the given options and displays it on stdout
+// using the specified formatter
+func GenerateAndDisplayReportContext(ctx context.Context, db bun.IDB, opts lockanalyzer.AnalyzerOptions, formatter LockReportFormatter) error {
+	return GenerateAndDisplaySourceReport(ctx, lockanalyzer.NewPostgresSource(db), opts, formatter)
+}
+
+// GenerateAndDisplaySourceReport generates a report from a snapshot source and displays it on stdout
+// using the specified formatter
+func GenerateAndDisplaySourceReport(ctx context.Context, source lockanalyzer.Source, opts lockanalyzer.AnalyzerOptions, formatter LockReportFormatter) error {
 	// Generate report data
-	reportData, err := lockanalyzer.GenerateLocksReport(db)
+	reportData, err := lockanalyzer.GenerateReport(ctx, source, opts)
 	if err != nil {
 		return fmt.Errorf("error generating report data: %v", err)
 	}
@@ -43,10 +43,10 @@ func TestMarkdownFormatter(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false, Type: "relation", Object: "models"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "10s", Query: "SELECT * FROM models"},
+			{PID: 2, Duration: 10 * time.Second, Query: "SELECT * FROM models"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "30s", Query: "UPDATE projects SET name = 'test'"},
+			{PID: 1, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'test'"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -139,10 +139,10 @@ func TestMarkdownFormatterEnglish(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false, Type: "relation", Object: "models"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "10s", Query: "SELECT * FROM models"},
+			{PID: 2, Duration: 10 * time.Second, Query: "SELECT * FROM models"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "30s", Query: "UPDATE projects SET name = 'test'"},
+			{PID: 1, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'test'"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -221,10 +221,10 @@ func TestJSONFormatter(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false, Type: "relation", Object: "models"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "10s", Query: "SELECT * FROM models"},
+			{PID: 2, Duration: 10 * time.Second, Query: "SELECT * FROM models"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "30s", Query: "UPDATE projects SET name = 'test'"},
+			{PID: 1, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'test'"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -294,10 +294,10 @@ func TestTextFormatter(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false, Type: "relation", Object: "models"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "10s", Query: "SELECT * FROM models"},
+			{PID: 2, Duration: 10 * time.Second, Query: "SELECT * FROM models"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "30s", Query: "UPDATE projects SET name = 'test'"},
+			{PID: 1, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'test'"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -362,10 +362,10 @@ func TestTextFormatterEnglish(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false, Type: "relation", Object: "models"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "10s", Query: "SELECT * FROM models"},
+			{PID: 2, Duration: 10 * time.Second, Query: "SELECT * FROM models"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "30s", Query: "UPDATE projects SET name = 'test'"},
+			{PID: 1, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'test'"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -482,11 +482,11 @@ func createTestReportData() *lockanalyzer.ReportData {
 			{PID: 3, Mode: "RowShareLock", Granted: true, Type: "tuple", Object: "files"},
 		},
 		BlockedTxns: []lockanalyzer.BlockedTransaction{
-			{PID: "2", Duration: "15s", Query: "SELECT * FROM models WHERE id = 1"},
-			{PID: "4", Duration: "30s", Query: "UPDATE projects SET name = 'updated'"},
+			{PID: 2, Duration: 15 * time.Second, Query: "SELECT * FROM models WHERE id = 1"},
+			{PID: 4, Duration: 30 * time.Second, Query: "UPDATE projects SET name = 'updated'"},
 		},
 		LongTxns: []lockanalyzer.LongTransaction{
-			{PID: "1", Duration: "2m", Query: "UPDATE projects SET modified_at = NOW()"},
+			{PID: 1, Duration: 2 * time.Minute, Query: "UPDATE projects SET modified_at = NOW()"},
 		},
 		Suggestions: []string{
 			"Consider adding timeouts on long transactions",
@@ -623,3 +623,705 @@ func GenerateAndWriteReportWithData(data *lockanalyzer.ReportData, formatter loc
 func GenerateAndDisplayReportWithData(data *lockanalyzer.ReportData, formatter lockanalyzer.LockReportFormatter, output io.Writer) error {
 	return formatter.Format(data, output)
 }
+
+// TestDeadlockSections tests that deadlocks and blocking chains are rendered separately
+func TestDeadlockSections(t *testing.T) {
+	data := createTestReportData()
+	data.Deadlocks = []lockanalyzer.DeadlockInfo{
+		{
+			Participants: []lockanalyzer.DeadlockParticipant{
+				{PID: 11, HeldLock: lockanalyzer.LockInfo{Mode: "RowExclusiveLock", Object: "projects"}, WaitingLock: lockanalyzer.LockInfo{Mode: "ShareLock", Object: "models"}},
+				{PID: 12, HeldLock: lockanalyzer.LockInfo{Mode: "RowExclusiveLock", Object: "models"}, WaitingLock: lockanalyzer.LockInfo{Mode: "ShareLock", Object: "files"}},
+				{PID: 13, HeldLock: lockanalyzer.LockInfo{Mode: "RowExclusiveLock", Object: "files"}, WaitingLock: lockanalyzer.LockInfo{Mode: "ShareLock", Object: "projects"}},
+			},
+		},
+	}
+	data.BlockingChains = []lockanalyzer.BlockingChain{{PIDs: []int{3, 2, 1}, Database: "shop"}}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			if !strings.Contains(content, "DEADLOCKS IN PROGRESS") {
+				t.Error("Report must contain the deadlocks section")
+			}
+			if !strings.Contains(content, "BLOCKING CHAINS") {
+				t.Error("Report must contain the blocking chains section")
+			}
+			if !strings.Contains(content, "3 → 2 → 1") {
+				t.Error("Report must render the blocking chain")
+			}
+			chain := map[string]string{"markdown": "| 3 → 2 → 1 | shop |", "text": "3 → 2 → 1, Database: shop"}[format]
+			if !strings.Contains(content, chain) {
+				t.Errorf("Report must render the database of the blocking chain: %s", chain)
+			}
+			for _, pid := range []string{"11", "12", "13"} {
+				if !strings.Contains(content, pid) {
+					t.Errorf("Report must list deadlock participant %s", pid)
+				}
+			}
+		})
+	}
+}
+
+// TestCollectorErrorsSection tests that failed collectors are reported
+func TestCollectorErrorsSection(t *testing.T) {
+	data := createTestReportData()
+	data.CollectorErrors = []lockanalyzer.CollectorError{
+		{Collector: "indexes", Error: "context deadline exceeded", TimedOut: true},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			if !strings.Contains(content, "INCOMPLETE DATA") {
+				t.Error("Report must contain the incomplete data section")
+			}
+			if !strings.Contains(content, "indexes") || !strings.Contains(content, "timed out") {
+				t.Error("Report must list the timed out collector")
+			}
+		})
+	}
+}
+
+// TestUnsupportedFeaturesSection tests that the features the server is too old for are reported
+func TestUnsupportedFeaturesSection(t *testing.T) {
+	data := createTestReportData()
+	data.ServerVersion = "12.4"
+	data.UnsupportedFeatures = []lockanalyzer.UnsupportedFeature{
+		{Feature: lockanalyzer.FeatureLockWaitStart, Reason: "requires PostgreSQL 14", Impact: "lock wait times are estimated"},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			if !strings.Contains(content, "NOT SUPPORTED ON THIS SERVER") || !strings.Contains(content, "PostgreSQL 12.4") {
+				t.Error("Report must contain the unsupported features section")
+			}
+			if !strings.Contains(content, "lock_wait_start") || !strings.Contains(content, "requires PostgreSQL 14") {
+				t.Error("Report must list the unsupported feature")
+			}
+		})
+	}
+}
+
+// TestStatementsSection tests that the statements of the blocking and blocked sessions are reported
+func TestStatementsSection(t *testing.T) {
+	data := createTestReportData()
+	data.Statements = []lockanalyzer.LockStatement{
+		{
+			Statement: lockanalyzer.StatementStats{
+				QueryID: 4242, Database: "app", Query: "SELECT * FROM models WHERE id = $1",
+				Calls: 50000, TotalTime: 100 * time.Second, MeanTime: 2 * time.Millisecond,
+			},
+			BlockedPIDs: []int{3},
+		},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			if !strings.Contains(content, "STATEMENTS INVOLVED IN LOCK WAITS") {
+				t.Error("Report must contain the statements section")
+			}
+			if !strings.Contains(content, "4242") || !strings.Contains(content, "50000") || !strings.Contains(content, "1m40s") {
+				t.Error("Report must list the statement with its calls and total time")
+			}
+		})
+	}
+}
+
+// TestGroupedBlockedTransactions tests that blocked transactions running the same query are rendered
+// as one group with its count and longest wait
+func TestGroupedBlockedTransactions(t *testing.T) {
+	data := createTestReportData()
+	data.BlockedTxns = nil
+	for pid := 600; pid < 610; pid++ {
+		data.BlockedTxns = append(data.BlockedTxns, lockanalyzer.BlockedTransaction{
+			PID: pid, Database: "app", Duration: time.Duration(pid-595) * time.Second, BlockingPIDs: []int{599},
+			Query: fmt.Sprintf("UPDATE accounts SET balance = %d WHERE id = %d", pid*10, pid),
+		})
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"update accounts set balance = ? where id = ?", "600, 601, 602, 603, 604, … (+5)", "14s"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain the group detail: %s", expected)
+				}
+			}
+			if strings.Contains(content, "UPDATE accounts SET balance = 6000") {
+				t.Error("Report must not list the grouped transactions one by one")
+			}
+		})
+	}
+}
+
+// TestLockSessionDetails tests that the session owning a lock and its database are rendered
+func TestLockSessionDetails(t *testing.T) {
+	data := createTestReportData()
+	data.Locks = []lockanalyzer.LockInfo{
+		{
+			PID: 42, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "projects", Database: "warehouse",
+			Username: "billing", ApplicationName: "invoice-worker", ClientAddr: "10.0.0.12", State: "idle in transaction",
+		},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"warehouse", "billing", "invoice-worker", "10.0.0.12", "idle in transaction"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain session detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestBlockedTransactionBlockers tests that the blockers of a blocked transaction are rendered
+func TestBlockedTransactionBlockers(t *testing.T) {
+	data := createTestReportData()
+	data.BlockedTxns = []lockanalyzer.BlockedTransaction{
+		{PID: 7, Duration: 90 * time.Second, BlockingPIDs: []int{101, 102}, WaitEvent: "Lock: transactionid", Query: "UPDATE projects"},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			if !strings.Contains(content, "101, 102") {
+				t.Error("Report must list the blocking PIDs")
+			}
+			if !strings.Contains(content, "1m30s") {
+				t.Error("Report must display the wait duration")
+			}
+		})
+	}
+}
+
+// TestAdvisoryLocksSection tests that advisory lock holders and waiters are rendered
+func TestAdvisoryLocksSection(t *testing.T) {
+	data := createTestReportData()
+	data.AdvisoryLocks = []lockanalyzer.AdvisoryLockInfo{
+		{
+			Key:     lockanalyzer.AdvisoryKey{Key1: 42, Key2: 7, TwoKeys: true},
+			Holders: []lockanalyzer.AdvisoryLockSession{{PID: 101, Mode: "ExclusiveLock", ApplicationName: "nightly-job"}},
+			Waiters: []lockanalyzer.AdvisoryLockSession{{PID: 102, Mode: "ExclusiveLock", WaitTime: 3 * time.Second}},
+		},
+	}
+	data.Summary.AdvisoryLocks = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"Advisory Locks", "42, 7", "101", "nightly-job", "102", "3s"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain advisory lock detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestObjectConflictsSection tests that conflicting holder/waiter pairs are rendered with their modes
+func TestObjectConflictsSection(t *testing.T) {
+	data := createTestReportData()
+	data.ObjectConflicts = []lockanalyzer.ObjectConflict{
+		{
+			Schema: "shop", Object: "shop.orders", Type: "relation",
+			HolderPID: 201, HolderMode: "AccessShareLock", WaiterPID: 202, WaiterMode: "AccessExclusiveLock",
+			Recommendation: "Schedule schema changes and VACUUM FULL outside busy periods",
+		},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"Object Conflicts", "shop.orders", "201", "AccessShareLock", "202", "AccessExclusiveLock", "VACUUM FULL"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain object conflict detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestBlockingTreesSection tests that blocking trees are rendered as an indented hierarchy
+// and that the top root blocker opens the summary
+func TestBlockingTreesSection(t *testing.T) {
+	data := createTestReportData()
+	data.BlockingTrees = []lockanalyzer.BlockingTree{
+		{
+			Root: lockanalyzer.BlockingNode{
+				PID: 301, State: "idle in transaction", Query: "UPDATE orders SET paid = true",
+				Waiters: []lockanalyzer.BlockingNode{
+					{
+						PID: 302, WaitTime: 5 * time.Second, Query: "ALTER TABLE orders ADD note text",
+						WaitingLock: lockanalyzer.LockInfo{Mode: "AccessExclusiveLock", Object: "shop.orders"},
+						Waiters: []lockanalyzer.BlockingNode{
+							{PID: 303, WaitTime: 2 * time.Second, Query: "SELECT * FROM orders"},
+						},
+					},
+				},
+			},
+			DirectlyBlocked: 1, TransitivelyBlocked: 2, TotalWaitTime: 7 * time.Second, Depth: 2,
+		},
+		{
+			Root: lockanalyzer.BlockingNode{
+				PID: -777, GID: "order-42", State: "prepared",
+				Waiters: []lockanalyzer.BlockingNode{{PID: 304, WaitTime: 3 * time.Second, Query: "UPDATE orders SET paid = true"}},
+			},
+			DirectlyBlocked: 1, TransitivelyBlocked: 1, TotalWaitTime: 3 * time.Second, Depth: 1,
+		},
+	}
+	data.Summary.TopRootBlocker = &lockanalyzer.RootBlocker{PID: 301, DirectlyBlocked: 1, TransitivelyBlocked: 2, TotalWaitTime: 7 * time.Second}
+	data.Summary.RootBlockers = 1
+
+	tests := map[string][]string{
+		"markdown": {"- **301** (idle in transaction)", "  - **302**", "    - **303**", "- **`order-42`** (prepared)"},
+		"text":     {"  PID: 301, State: idle in transaction", "    PID: 302", "      PID: 303", "  GID: order-42, State: prepared"},
+	}
+	for format, lines := range tests {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			prepared := "Prepared transaction order-42: 1 blocked sessions (1 directly), 3s of accumulated wait"
+			for _, expected := range append(lines, "Blocking Trees", "AccessExclusiveLock shop.orders", "5s", prepared) {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain blocking tree detail: %s", expected)
+				}
+			}
+
+			top := "PID 301: 2 blocked sessions (1 directly), 7s of accumulated wait"
+			if !strings.Contains(content, top) {
+				t.Fatalf("Summary must contain the top root blocker: %s", top)
+			}
+			if strings.Index(content, top) > strings.Index(content, "Total active locks") {
+				t.Error("Top root blocker should come first in the summary")
+			}
+		})
+	}
+}
+
+// TestDDLQueuesSection tests that DDL statements with sessions queued behind them are rendered
+func TestDDLQueuesSection(t *testing.T) {
+	data := createTestReportData()
+	data.DDLQueues = []lockanalyzer.DDLQueue{
+		{
+			Schema: "shop", Object: "shop.orders",
+			DDL: lockanalyzer.LockInfo{PID: 20, Mode: "AccessExclusiveLock", WaitTime: time.Minute, Query: "ALTER TABLE orders ADD COLUMN note text"},
+			Holders: []lockanalyzer.DDLQueueHolder{
+				{PID: 10, Mode: "AccessShareLock", State: "active", Query: "SELECT sum(total) FROM orders", TransactionAge: 30 * time.Minute},
+			},
+			Queued: []lockanalyzer.LockInfo{
+				{PID: 30, Mode: "AccessShareLock", WaitTime: 30 * time.Second, Query: "SELECT * FROM orders WHERE id = 1"},
+			},
+		},
+	}
+	data.Summary.DDLQueues = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{
+				"DDL Lock Queue Pile-ups", "AccessExclusiveLock on shop.orders requested by PID 20: 1 sessions queued behind it",
+				"ALTER TABLE orders ADD COLUMN note text", "SELECT sum(total) FROM orders", "30m0s",
+				"SELECT * FROM orders WHERE id = 1", "SET lock_timeout",
+			} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain DDL queue detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestBlockedTransactionRowWait tests that the row waited for and the holder's query are rendered
+func TestBlockedTransactionRowWait(t *testing.T) {
+	data := createTestReportData()
+	data.BlockedTxns = []lockanalyzer.BlockedTransaction{
+		{
+			PID: 402, Duration: 3 * time.Second, BlockingPIDs: []int{401}, Query: "UPDATE orders SET paid = false",
+			RowWait: &lockanalyzer.RowWait{
+				Schema: "shop", Table: "shop.orders", Page: "12", Tuple: "4", TransactionID: "991",
+				HolderPID: 401, HolderQuery: "UPDATE orders SET paid = true",
+			},
+		},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"row (12,4) of shop.orders held by PID 401", "UPDATE orders SET paid = true"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain row wait detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestRowLocksSection tests that the rows read with pgrowlocks are rendered with their transactions
+func TestRowLocksSection(t *testing.T) {
+	data := createTestReportData()
+	data.RowLocks = []lockanalyzer.RowLockInfo{
+		{PID: 501, Schema: "shop", Table: "shop.orders", Page: "7", Tuple: "2", Mode: "For Share", Granted: true, TransactionID: "880", MultiXactID: "12",
+			BlockedModes: []string{"FOR NO KEY UPDATE", "FOR UPDATE"}},
+	}
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"Row Locks", "shop.orders", "(7,2)", "For Share", "501", "880", "12", "FOR NO KEY UPDATE, FOR UPDATE"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain row lock detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestPreparedTransactionsSection tests that orphaned prepared transactions are rendered with their remediation
+func TestPreparedTransactionsSection(t *testing.T) {
+	data := createTestReportData()
+	data.PreparedTxns = []lockanalyzer.PreparedTransaction{
+		{
+			GID: "order-42", TransactionID: "777", Owner: "app", Database: "shop", Age: 48 * time.Hour, BlockedSessions: 2,
+			Locks: []lockanalyzer.LockInfo{{Mode: "RowExclusiveLock", Type: "relation", Object: "shop.orders"}},
+		},
+	}
+	data.Summary.PreparedTxns = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{
+				"Orphaned Prepared Transactions", "order-42", "777", "48h0m0s", "RowExclusiveLock shop.orders",
+				"ROLLBACK PREPARED 'order-42'",
+			} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain prepared transaction detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestVacuumSection tests that vacuums blocking other sessions and blocked vacuums are rendered
+func TestVacuumSection(t *testing.T) {
+	data := createTestReportData()
+	data.Vacuum = lockanalyzer.VacuumReport{
+		Blocking: []lockanalyzer.VacuumConflict{
+			{
+				Object: "shop.orders", VacuumPID: 70, VacuumMode: "ShareUpdateExclusiveLock",
+				Vacuum:   lockanalyzer.VacuumInfo{Auto: true, Wraparound: true, Phase: "scanning heap"},
+				OtherPID: 80, OtherMode: "AccessExclusiveLock", OtherQuery: "ALTER TABLE orders ADD COLUMN note text",
+				WaitTime: 30 * time.Second, Recommendation: "Let it finish",
+			},
+		},
+		Blocked: []lockanalyzer.VacuumConflict{
+			{
+				Object: "shop.files", VacuumPID: 100, VacuumMode: "ShareUpdateExclusiveLock",
+				OtherPID: 90, OtherMode: "ShareLock", OtherQuery: "CREATE INDEX ON files (name)",
+				WaitTime: 2 * time.Minute, Recommendation: "Keep transactions short",
+			},
+		},
+	}
+	data.Summary.VacuumConflicts = 2
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{
+				"Vacuum Interactions", "Vacuums blocking other sessions", "Blocked vacuums",
+				"anti-wraparound autovacuum", "scanning heap", "shop.orders", "ALTER TABLE orders ADD COLUMN note text", "30s",
+				"shop.files", "CREATE INDEX ON files (name)", "2m0s",
+			} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain vacuum detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestSSISection tests that the predicate locks of serializable transactions are rendered
+func TestSSISection(t *testing.T) {
+	data := createTestReportData()
+	data.SSI = lockanalyzer.SSIReport{
+		Relations: []lockanalyzer.PredicateLockInfo{
+			{Schema: "shop", Relation: "shop.orders", RelationLocks: 1, PageLocks: 2, Sessions: 3},
+			{Schema: "shop", Relation: "shop.customers", TupleLocks: 5, Sessions: 1},
+		},
+		TotalLocks: 8, EscalatedRelations: 1, Sessions: 3, CommittedLocks: 2,
+		XactCommit: 750, XactRollback: 250,
+		RelationEscalationThreshold: 32, PageEscalationThreshold: 2,
+	}
+	data.Summary.EscalatedPredicateLocks = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{
+				"Serializable (SSI) Predicate Locks", "Relations with escalated predicate locks",
+				"8 predicate locks held by 3 serializable transactions, 2 kept for committed transactions",
+				"after 32 page/tuple locks", "250 of 1000 transactions (25.0%)",
+				"shop.orders", "shop.customers", "relation", "tuple",
+			} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain predicate lock detail: %s", expected)
+				}
+			}
+		})
+	}
+}
+
+// TestStandbySection tests that the recovery conflicts and replay waits of a standby are rendered
+func TestStandbySection(t *testing.T) {
+	data := createTestReportData()
+	data.Standby = &lockanalyzer.StandbyReport{
+		ReplayLag:      2 * time.Second,
+		LastReplayTime: time.Date(2024, 5, 1, 11, 59, 58, 0, time.UTC),
+		Conflicts:      []lockanalyzer.RecoveryConflicts{{Database: "shop", Lock: 4, Snapshot: 12}},
+		Deltas:         []lockanalyzer.RecoveryConflicts{{Database: "shop", Lock: 1, Snapshot: 2}},
+		SampleInterval: time.Second,
+		StartupPID:     40,
+		ReplayWaiters: []lockanalyzer.ReplayWaiter{
+			{PID: 41, WaitTime: 5 * time.Second, WaitingLock: lockanalyzer.LockInfo{Mode: "AccessShareLock", Schema: "shop", Object: "orders"}, Query: "SELECT * FROM orders"},
+		},
+		Settings: map[string]string{"hot_standby_feedback": "off", "max_standby_streaming_delay": "30s"},
+	}
+	data.Summary.RecoveryConflicts = 3
+	data.Summary.ReplayWaiters = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{
+				"Hot Standby Recovery Conflicts", "Replay lag", "PID 40", "hot_standby_feedback", "30s",
+				"Queries cancelled during the last 1s", "Queries cancelled since the statistics reset",
+				"Sessions waiting for WAL replay", "SELECT * FROM orders",
+			} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain standby detail: %s", expected)
+				}
+			}
+		})
+	}
+
+	data.Standby = nil
+	formatter, err := NewFormatter("text", "en")
+	if err != nil {
+		t.Fatalf("Error creating formatter: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := formatter.Format(data, &buf); err != nil {
+		t.Fatalf("Error during formatting: %v", err)
+	}
+	if strings.Contains(buf.String(), "Hot Standby") {
+		t.Error("Report of a primary must not contain the standby section")
+	}
+}
+
+// TestIdleTransactionsSection tests that sessions idle in transaction holding locks are rendered
+func TestIdleTransactionsSection(t *testing.T) {
+	data := createTestReportData()
+	data.IdleTxns = []lockanalyzer.IdleTransaction{
+		{
+			PID: 55, State: "idle in transaction", IdleTime: 45 * time.Second, BlockedSessions: 3,
+			ApplicationName: "checkout", Query: "UPDATE orders SET paid = true",
+			Locks: []lockanalyzer.LockInfo{{Mode: "RowExclusiveLock", Type: "relation", Object: "shop.orders"}},
+		},
+	}
+	data.Summary.IdleTxns = 1
+
+	for _, format := range []string{"markdown", "text"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "en")
+			if err != nil {
+				t.Fatalf("Error creating formatter: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter.Format(data, &buf); err != nil {
+				t.Fatalf("Error during formatting: %v", err)
+			}
+
+			content := buf.String()
+			for _, expected := range []string{"Idle in Transaction Lock Holders", "55", "45s", "RowExclusiveLock shop.orders", "checkout"} {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Report must contain idle transaction detail: %s", expected)
+				}
+			}
+		})
+	}
+}
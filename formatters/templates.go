@@ -3,6 +3,8 @@ package formatters
 import (
 	"bytes"
 	"embed"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -69,6 +71,7 @@ func (f *TemplateFormatter) Format(data *lockanalyzer.ReportData, output interfa
 
 // Template functions
 var templateFuncs = template.FuncMap{
+	"join": strings.Join,
 	"add": func(a, b int) int {
 		return a + b
 	},
@@ -79,6 +82,40 @@ var templateFuncs = template.FuncMap{
 		}
 		return result
 	},
+	"joinPIDs": func(pids []int) string {
+		parts := make([]string, len(pids))
+		for i, pid := range pids {
+			parts[i] = strconv.Itoa(pid)
+		}
+		return strings.Join(parts, " → ")
+	},
+	"joinInts": func(values []int) string {
+		parts := make([]string, len(values))
+		for i, value := range values {
+			parts[i] = strconv.Itoa(value)
+		}
+		return strings.Join(parts, ", ")
+	},
+	"joinIntsMax": func(values []int, max int) string {
+		shown := values
+		if len(values) > max {
+			shown = values[:max]
+		}
+		parts := make([]string, len(shown))
+		for i, value := range shown {
+			parts[i] = strconv.Itoa(value)
+		}
+		if len(shown) < len(values) {
+			parts = append(parts, "… (+"+strconv.Itoa(len(values)-len(shown))+")")
+		}
+		return strings.Join(parts, ", ")
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"percent": func(ratio float64) string {
+		return strconv.FormatFloat(ratio*100, 'f', 1, 64) + "%"
+	},
 	"dict": func(values ...interface{}) map[string]interface{} {
 		if len(values)%2 != 0 {
 			return nil
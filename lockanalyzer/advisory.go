@@ -0,0 +1,123 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AdvisoryKey identifies an advisory lock as requested by the application.
+// pg_advisory_lock(bigint) stores the high and low halves of the key in classid and objid
+// with objsubid = 1, while pg_advisory_lock(int, int) stores both keys with objsubid = 2.
+type AdvisoryKey struct {
+	Key     int64
+	Key1    int32
+	Key2    int32
+	TwoKeys bool
+}
+
+// decodeAdvisoryKey decodes the pg_locks columns of an advisory lock
+func decodeAdvisoryKey(classID, objID uint32, objSubID int) AdvisoryKey {
+	if objSubID == 2 {
+		return AdvisoryKey{Key1: int32(classID), Key2: int32(objID), TwoKeys: true}
+	}
+	return AdvisoryKey{Key: int64(uint64(classID)<<32 | uint64(objID))}
+}
+
+// String returns the key as it would be passed to pg_advisory_lock()
+func (k AdvisoryKey) String() string {
+	if k.TwoKeys {
+		return fmt.Sprintf("%d, %d", k.Key1, k.Key2)
+	}
+	return fmt.Sprintf("%d", k.Key)
+}
+
+// AdvisoryLockSession contains information about a session holding or waiting for an advisory lock
+type AdvisoryLockSession struct {
+	PID             int
+	Mode            string
+	ApplicationName string
+	WaitTime        time.Duration
+	Query           string
+}
+
+// AdvisoryLockInfo contains the holders and waiters of an advisory lock key.
+// Advisory locks are per database: the same key taken in two databases is two locks.
+type AdvisoryLockInfo struct {
+	Database string
+	Key      AdvisoryKey
+	Holders  []AdvisoryLockSession
+	Waiters  []AdvisoryLockSession
+}
+
+// Contended reports whether at least one session is waiting for the key
+func (a AdvisoryLockInfo) Contended() bool {
+	return len(a.Waiters) > 0
+}
+
+// advisoryObject returns the object label of an advisory lock
+func advisoryObject(key AdvisoryKey) string {
+	return fmt.Sprintf("advisory(%s)", key)
+}
+
+// advisoryLockID identifies an advisory lock among the databases
+type advisoryLockID struct {
+	database uint32
+	key      AdvisoryKey
+}
+
+// detectAdvisoryLocks groups advisory locks by database and key, most contended keys first
+func detectAdvisoryLocks(locks []LockInfo) []AdvisoryLockInfo {
+	byKey := make(map[advisoryLockID]*AdvisoryLockInfo)
+	var keys []advisoryLockID
+
+	for _, lock := range locks {
+		if lock.Type != "advisory" {
+			continue
+		}
+
+		key := decodeAdvisoryKey(lock.ClassID, lock.ObjID, lock.ObjSubID)
+		id := advisoryLockID{database: lock.DatabaseOID, key: key}
+		info, ok := byKey[id]
+		if !ok {
+			info = &AdvisoryLockInfo{Database: lock.Database, Key: key}
+			byKey[id] = info
+			keys = append(keys, id)
+		}
+
+		session := AdvisoryLockSession{
+			PID:             lock.PID,
+			Mode:            lock.Mode,
+			ApplicationName: lock.ApplicationName,
+			WaitTime:        lock.WaitTime,
+			Query:           lock.Query,
+		}
+		if lock.Granted {
+			info.Holders = append(info.Holders, session)
+		} else {
+			info.Waiters = append(info.Waiters, session)
+		}
+	}
+
+	var advisoryLocks []AdvisoryLockInfo
+	for _, key := range keys {
+		advisoryLocks = append(advisoryLocks, *byKey[key])
+	}
+
+	sort.SliceStable(advisoryLocks, func(i, j int) bool {
+		return len(advisoryLocks[i].Waiters) > len(advisoryLocks[j].Waiters)
+	})
+
+	return advisoryLocks
+}
+
+// countContendedAdvisoryLocks returns the number of advisory lock keys with waiters
+func countContendedAdvisoryLocks(advisoryLocks []AdvisoryLockInfo) int {
+	count := 0
+	for _, advisoryLock := range advisoryLocks {
+		if advisoryLock.Contended() {
+			count++
+		}
+	}
+	return count
+}
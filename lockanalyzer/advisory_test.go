@@ -0,0 +1,66 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDecodeAdvisoryKey tests decoding of single and two-key advisory locks
+func TestDecodeAdvisoryKey(t *testing.T) {
+	// pg_advisory_lock(-1) is stored as classid = 4294967295, objid = 4294967295, objsubid = 1
+	key := decodeAdvisoryKey(4294967295, 4294967295, 1)
+	if key.TwoKeys || key.Key != -1 {
+		t.Errorf("Expected single key -1, got: %+v", key)
+	}
+
+	// pg_advisory_lock(4294967298) is stored as classid = 1, objid = 2, objsubid = 1
+	key = decodeAdvisoryKey(1, 2, 1)
+	if key.Key != 4294967298 || key.String() != "4294967298" {
+		t.Errorf("Expected key 4294967298, got: %s", key)
+	}
+
+	// pg_advisory_lock(42, -7) is stored as classid = 42, objid = 4294967289, objsubid = 2
+	key = decodeAdvisoryKey(42, 4294967289, 2)
+	if !key.TwoKeys || key.Key1 != 42 || key.Key2 != -7 {
+		t.Errorf("Expected keys 42, -7, got: %+v", key)
+	}
+	if key.String() != "42, -7" {
+		t.Errorf("Expected key label: 42, -7, got: %s", key)
+	}
+}
+
+// TestDetectAdvisoryLocks tests grouping of advisory locks by key
+func TestDetectAdvisoryLocks(t *testing.T) {
+	locks := []LockInfo{
+		{PID: 1, Mode: "ExclusiveLock", Granted: true, Type: "advisory", ClassID: 0, ObjID: 10, ObjSubID: 1, ApplicationName: "idle-job"},
+		{PID: 2, Mode: "ExclusiveLock", Granted: true, Type: "advisory", ClassID: 0, ObjID: 20, ObjSubID: 1, ApplicationName: "nightly-job"},
+		{PID: 3, Mode: "ExclusiveLock", Granted: false, Type: "advisory", ClassID: 0, ObjID: 20, ObjSubID: 1, WaitTime: 5 * time.Second},
+		{PID: 4, Mode: "ShareLock", Granted: false, Type: "advisory", ClassID: 0, ObjID: 20, ObjSubID: 1},
+		{PID: 5, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "projects"},
+	}
+
+	advisoryLocks := detectAdvisoryLocks(locks)
+
+	if len(advisoryLocks) != 2 {
+		t.Fatalf("Expected 2 advisory lock keys, got: %d", len(advisoryLocks))
+	}
+
+	// Contended key first
+	contended := advisoryLocks[0]
+	if contended.Key.Key != 20 || !contended.Contended() {
+		t.Errorf("Expected contended key 20 first, got: %+v", contended.Key)
+	}
+	if len(contended.Holders) != 1 || contended.Holders[0].ApplicationName != "nightly-job" {
+		t.Errorf("Expected nightly-job holding key 20, got: %+v", contended.Holders)
+	}
+	if len(contended.Waiters) != 2 || contended.Waiters[0].WaitTime != 5*time.Second {
+		t.Errorf("Expected 2 waiters on key 20, got: %+v", contended.Waiters)
+	}
+
+	if advisoryLocks[1].Contended() {
+		t.Error("Key 10 should not be contended")
+	}
+	if countContendedAdvisoryLocks(advisoryLocks) != 1 {
+		t.Errorf("Expected 1 contended advisory lock, got: %d", countContendedAdvisoryLocks(advisoryLocks))
+	}
+}
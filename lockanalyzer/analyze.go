@@ -0,0 +1,215 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// buildLocks joins the lock rows of a snapshot with the sessions and relations they refer to
+func buildLocks(snapshot *Snapshot) []LockInfo {
+	sessions := make(map[int]ActivityRow, len(snapshot.Activity))
+	for _, session := range snapshot.Activity {
+		sessions[session.PID] = session
+	}
+	progress := make(map[int]VacuumProgressRow, len(snapshot.VacuumProgress))
+	for _, row := range snapshot.VacuumProgress {
+		progress[row.PID] = row
+	}
+	vacuums := make(map[int]*VacuumInfo)
+	for _, session := range snapshot.Activity {
+		row, inProgress := progress[session.PID]
+		if vacuum := classifyVacuum(session, row, inProgress); vacuum != nil {
+			vacuums[session.PID] = vacuum
+		}
+	}
+	preparedXacts := make(map[string]PreparedXactRow, len(snapshot.PreparedXacts))
+	for _, prepared := range snapshot.PreparedXacts {
+		preparedXacts[prepared.TransactionID] = prepared
+	}
+	databases, _ := databaseNames(snapshot.Databases)
+	relations := newRelationIndex(snapshot.Relations)
+	tables := make(map[string]bool)
+
+	var locks []LockInfo
+	for _, row := range snapshot.Locks {
+		// Predicate locks never block and are analyzed apart
+		if row.Mode == predicateLockMode {
+			continue
+		}
+
+		lock := LockInfo{
+			PID:           row.PID,
+			Mode:          row.Mode,
+			Granted:       row.Granted,
+			DatabaseOID:   row.Database,
+			ObjectType:    row.LockType,
+			ObjectName:    "N/A",
+			Page:          row.Page,
+			Tuple:         row.Tuple,
+			VirtualXID:    row.VirtualXID,
+			TransactionID: row.TransactionID,
+			ClassID:       row.ClassID,
+			ObjID:         row.ObjID,
+			ObjSubID:      row.ObjSubID,
+		}
+
+		if row.Relation != 0 {
+			if relation, ok := relations.lookup(row.Database, row.Relation); ok {
+				lock.Schema = relation.Schema
+				lock.ObjectName = qualifiedName(relation.Schema, relation.Name)
+				if !isIndexKind(relation.Kind) {
+					tables[tableTag(lock.DatabaseOID, lock.ObjectName)] = true
+				}
+			} else {
+				lock.ObjectName = strconv.FormatUint(uint64(row.Relation), 10)
+			}
+		}
+
+		session := sessions[row.PID]
+		applySession(&lock, session)
+		lock.Vacuum = vacuums[row.PID]
+		if xid := preparedTransactionID(row); xid != "" {
+			// Prepared transactions have no session, their owner is in pg_prepared_xacts
+			lock.PreparedTransactionID = xid
+			lock.PreparedGID = preparedXacts[xid].GID
+			lock.State = preparedState
+			lock.Username = preparedXacts[xid].Owner
+			lock.Database = preparedXacts[xid].Database
+		}
+		if name, ok := databases[row.Database]; ok && row.Database != 0 {
+			lock.Database = name
+		}
+
+		if !row.Granted {
+			// Before PostgreSQL 14, the wait is assumed to have started with the current state or query
+			lock.WaitStart = row.WaitStart
+			if lock.WaitStart.IsZero() {
+				lock.WaitStart = session.StateChange
+			}
+			if lock.WaitStart.IsZero() {
+				lock.WaitStart = session.QueryStart
+			}
+			if !lock.WaitStart.IsZero() && snapshot.Timestamp.After(lock.WaitStart) {
+				lock.WaitTime = snapshot.Timestamp.Sub(lock.WaitStart)
+			}
+		}
+
+		lock.Type = lock.ObjectType
+		lock.Object = lock.ObjectName
+		if lock.Type == "advisory" {
+			lock.Object = advisoryObject(decodeAdvisoryKey(lock.ClassID, lock.ObjID, lock.ObjSubID))
+		}
+
+		locks = append(locks, lock)
+	}
+
+	sort.SliceStable(locks, func(i, j int) bool {
+		if locks[i].PID != locks[j].PID {
+			return locks[i].PID < locks[j].PID
+		}
+		return locks[i].Mode < locks[j].Mode
+	})
+
+	resolveRowWaits(locks, tables)
+
+	return locks
+}
+
+// isIndexKind reports whether a relkind is the one of an index
+func isIndexKind(kind string) bool {
+	return kind == "i" || kind == "I"
+}
+
+// applySession copies the session details into a lock
+func applySession(lock *LockInfo, session ActivityRow) {
+	lock.Database = session.Database
+	lock.Username = session.Username
+	lock.ApplicationName = session.ApplicationName
+	lock.ClientAddr = session.ClientAddr
+	lock.BackendType = session.BackendType
+	lock.State = session.State
+	lock.XactStart = session.XactStart
+	lock.QueryStart = session.QueryStart
+	lock.StateChange = session.StateChange
+	lock.WaitEventType = session.WaitEventType
+	lock.WaitEvent = session.WaitEvent
+	lock.Query = session.Query
+}
+
+// buildWaitGraph builds the wait graph from the blocking PIDs of the sessions.
+// A zero blocking PID stands for the prepared transactions, which have no backend: each of them
+// holding a lock conflicting with the awaited one becomes a node of its own (see preparedNode).
+// The zero PID is kept as a node when none of their locks has been collected.
+func buildWaitGraph(activity []ActivityRow, locks []LockInfo) *WaitGraph {
+	graph := NewWaitGraph(nil)
+	for _, session := range activity {
+		for _, blocker := range session.BlockingPIDs {
+			if blocker != 0 {
+				graph.AddEdge(session.PID, blocker)
+				continue
+			}
+			prepared := preparedBlockers(locks, session.PID)
+			if len(prepared) == 0 {
+				graph.AddEdge(session.PID, blocker)
+			}
+			for _, node := range prepared {
+				graph.AddEdge(session.PID, node)
+			}
+		}
+	}
+	return graph
+}
+
+// buildIndexes returns the indexes of the current database with their schema-qualified names
+// and readable sizes
+func buildIndexes(rows []IndexRow, databases []DatabaseRow) []IndexInfo {
+	_, current := databaseNames(databases)
+	var indexes []IndexInfo
+	for _, row := range rows {
+		indexes = append(indexes, IndexInfo{
+			Database: current,
+			Schema:   row.Schema,
+			Name:     qualifiedName(row.Schema, row.Name),
+			Table:    qualifiedName(row.Schema, row.Table),
+			Size:     prettySize(row.SizeBytes),
+		})
+	}
+	return indexes
+}
+
+// prettySize formats a size in bytes like pg_size_pretty()
+func prettySize(size int64) string {
+	const limit = 10 * 1024
+	const roundedLimit = 2*limit - 1
+
+	if abs(size) < limit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+
+	// Sizes are kept in half units so that they can be rounded
+	size /= 1 << 9
+	for _, unit := range []string{"kB", "MB", "GB", "TB"} {
+		if abs(size) < roundedLimit || unit == "TB" {
+			return fmt.Sprintf("%d %s", halfRounded(size), unit)
+		}
+		size /= 1 << 10
+	}
+	return ""
+}
+
+// halfRounded converts a size in half units to units, rounding half away from zero
+func halfRounded(size int64) int64 {
+	if size < 0 {
+		return (size - 1) / 2
+	}
+	return (size + 1) / 2
+}
+
+// abs returns the absolute value of a size
+func abs(size int64) int64 {
+	if size < 0 {
+		return -size
+	}
+	return size
+}
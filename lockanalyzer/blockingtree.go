@@ -0,0 +1,148 @@
+package lockanalyzer
+
+import (
+	"sort"
+	"time"
+)
+
+// BlockingNode is a backend of a blocking tree, with the backends waiting for it
+type BlockingNode struct {
+	// PID is the backend, or the wait graph node of a prepared transaction (see preparedNode)
+	PID int
+	// GID is the global identifier of the prepared transaction the node stands for, empty for a backend
+	GID             string
+	Database        string
+	State           string
+	ApplicationName string
+	Query           string
+	// WaitingLock is the lock the backend is waiting for, empty for the root blocker
+	WaitingLock LockInfo
+	WaitTime    time.Duration
+	// Statement is the pg_stat_statements entry of the query, nil when unknown
+	Statement *StatementStats
+	Waiters   []BlockingNode
+}
+
+// BlockingTree is the tree of backends waiting, directly or not, for a root blocker:
+// a backend blocking others without waiting for any lock itself
+type BlockingTree struct {
+	Root                BlockingNode
+	DirectlyBlocked     int
+	TransitivelyBlocked int
+	TotalWaitTime       time.Duration
+	Depth               int
+}
+
+// RootBlocker summarizes the root blocker of the largest blocking tree
+type RootBlocker struct {
+	PID int
+	// GID is the global identifier of the root blocker when it is a prepared transaction
+	GID                 string
+	Database            string
+	DirectlyBlocked     int
+	TransitivelyBlocked int
+	TotalWaitTime       time.Duration
+	Query               string
+	// Statement is the pg_stat_statements entry of the query, nil when unknown
+	Statement *StatementStats
+}
+
+// detectBlockingTrees builds a tree for each root blocker of the wait graph, the trees blocking
+// the most sessions first. A backend waiting for several backends of the same tree appears once,
+// under the blocker closest to the root. Backends only waiting for deadlock cycles have no root
+// blocker and are reported with the deadlocks.
+func detectBlockingTrees(graph *WaitGraph, locks []LockInfo) []BlockingTree {
+	var trees []BlockingTree
+
+	if graph == nil {
+		return trees
+	}
+
+	for _, pid := range graph.Nodes {
+		if !graph.IsBlocking(pid) || graph.IsWaiting(pid) {
+			continue
+		}
+
+		tree := BlockingTree{
+			Root:            sessionNode(locks, pid),
+			DirectlyBlocked: len(graph.WaitersOf(pid)),
+		}
+
+		// Breadth-first, so that each waiter is attached to its blocker closest to the root
+		visited := map[int]bool{pid: true}
+		level := []*BlockingNode{&tree.Root}
+		for len(level) > 0 {
+			var next []*BlockingNode
+			for _, node := range level {
+				waiters := append([]int(nil), graph.WaitersOf(node.PID)...)
+				sort.Ints(waiters)
+				for _, waiter := range waiters {
+					if visited[waiter] {
+						continue
+					}
+					visited[waiter] = true
+					node.Waiters = append(node.Waiters, sessionNode(locks, waiter))
+				}
+				for i := range node.Waiters {
+					next = append(next, &node.Waiters[i])
+					tree.TransitivelyBlocked++
+					tree.TotalWaitTime += node.Waiters[i].WaitTime
+				}
+			}
+			if len(next) > 0 {
+				tree.Depth++
+			}
+			level = next
+		}
+
+		trees = append(trees, tree)
+	}
+
+	sort.SliceStable(trees, func(i, j int) bool {
+		if trees[i].TransitivelyBlocked != trees[j].TransitivelyBlocked {
+			return trees[i].TransitivelyBlocked > trees[j].TransitivelyBlocked
+		}
+		return trees[i].TotalWaitTime > trees[j].TotalWaitTime
+	})
+
+	return trees
+}
+
+// sessionNode describes a backend or a prepared transaction of a blocking tree from its locks
+func sessionNode(locks []LockInfo, pid int) BlockingNode {
+	node := BlockingNode{PID: pid}
+	for _, lock := range locks {
+		if lockNode(lock) != pid {
+			continue
+		}
+		node.GID = lock.PreparedGID
+		node.Database = lock.Database
+		node.State = lock.State
+		node.ApplicationName = lock.ApplicationName
+		node.Query = lock.Query
+		if !lock.Granted {
+			node.WaitingLock = lock
+			node.WaitTime = lock.WaitTime
+			break
+		}
+	}
+	return node
+}
+
+// topRootBlocker returns the root blocker of the first tree, or nil when no backend is blocked
+func topRootBlocker(trees []BlockingTree) *RootBlocker {
+	if len(trees) == 0 {
+		return nil
+	}
+	tree := trees[0]
+	return &RootBlocker{
+		PID:                 tree.Root.PID,
+		GID:                 tree.Root.GID,
+		Database:            tree.Root.Database,
+		DirectlyBlocked:     tree.DirectlyBlocked,
+		TransitivelyBlocked: tree.TransitivelyBlocked,
+		TotalWaitTime:       tree.TotalWaitTime,
+		Query:               tree.Root.Query,
+		Statement:           tree.Root.Statement,
+	}
+}
@@ -0,0 +1,77 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDetectBlockingTrees tests the trees built for each root blocker
+func TestDetectBlockingTrees(t *testing.T) {
+	// 1 blocks 2 and 3, 3 also waits for 2 and blocks 4; 10 blocks 11; 20 and 21 are deadlocked and block 22
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 2, Blocker: 1},
+		{Waiter: 3, Blocker: 1},
+		{Waiter: 3, Blocker: 2},
+		{Waiter: 4, Blocker: 3},
+		{Waiter: 11, Blocker: 10},
+		{Waiter: 20, Blocker: 21},
+		{Waiter: 21, Blocker: 20},
+		{Waiter: 22, Blocker: 20},
+	})
+	locks := []LockInfo{
+		{PID: 1, Mode: "RowExclusiveLock", Granted: true, State: "idle in transaction", Query: "UPDATE projects"},
+		{PID: 2, Mode: "ShareLock", Granted: false, WaitTime: 4 * time.Second, TransactionID: "1234"},
+		{PID: 3, Mode: "AccessExclusiveLock", Granted: false, WaitTime: 2 * time.Second, Object: "public.projects"},
+		{PID: 4, Mode: "AccessShareLock", Granted: false, WaitTime: time.Second, Object: "public.projects"},
+		{PID: 10, Mode: "ExclusiveLock", Granted: true},
+		{PID: 11, Mode: "ShareLock", Granted: false, WaitTime: 30 * time.Second},
+	}
+
+	trees := detectBlockingTrees(graph, locks)
+
+	if len(trees) != 2 {
+		t.Fatalf("Expected 2 blocking trees, got: %+v", trees)
+	}
+
+	// The tree blocking the most sessions comes first, even with less accumulated wait
+	tree := trees[0]
+	if tree.Root.PID != 1 || tree.Root.State != "idle in transaction" || tree.Root.Query != "UPDATE projects" {
+		t.Errorf("Expected root blocker 1 idle in transaction, got: %+v", tree.Root)
+	}
+	if tree.DirectlyBlocked != 2 || tree.TransitivelyBlocked != 3 {
+		t.Errorf("Expected 2 directly and 3 transitively blocked sessions, got: %d and %d", tree.DirectlyBlocked, tree.TransitivelyBlocked)
+	}
+	if tree.TotalWaitTime != 7*time.Second {
+		t.Errorf("Expected total wait time: 7s, got: %v", tree.TotalWaitTime)
+	}
+	if tree.Depth != 2 {
+		t.Errorf("Expected depth: 2, got: %d", tree.Depth)
+	}
+
+	// 3 waits for both 1 and 2 and is attached once, under the root
+	if len(tree.Root.Waiters) != 2 || tree.Root.Waiters[0].PID != 2 || tree.Root.Waiters[1].PID != 3 {
+		t.Fatalf("Expected waiters 2 and 3 under the root, got: %+v", tree.Root.Waiters)
+	}
+	if len(tree.Root.Waiters[0].Waiters) != 0 {
+		t.Errorf("Backend 3 should not be repeated under backend 2, got: %+v", tree.Root.Waiters[0].Waiters)
+	}
+	third := tree.Root.Waiters[1]
+	if third.WaitingLock.Mode != "AccessExclusiveLock" || third.WaitTime != 2*time.Second {
+		t.Errorf("Expected backend 3 waiting 2s for AccessExclusiveLock, got: %+v", third)
+	}
+	if len(third.Waiters) != 1 || third.Waiters[0].PID != 4 {
+		t.Errorf("Expected backend 4 under backend 3, got: %+v", third.Waiters)
+	}
+
+	if trees[1].Root.PID != 10 || trees[1].TotalWaitTime != 30*time.Second {
+		t.Errorf("Expected root blocker 10 with 30s of wait, got: %+v", trees[1])
+	}
+
+	top := topRootBlocker(trees)
+	if top == nil || top.PID != 1 || top.TransitivelyBlocked != 3 {
+		t.Errorf("Expected top root blocker 1, got: %+v", top)
+	}
+	if topRootBlocker(nil) != nil {
+		t.Error("There should be no top root blocker without blocking tree")
+	}
+}
@@ -0,0 +1,155 @@
+package lockanalyzer
+
+import (
+	"fmt"
+)
+
+// The catalog views read by the collectors gain columns with each PostgreSQL release, and some
+// data comes from extensions. The collectors select a column only when the server version
+// provides it, falling back to NULL otherwise, and the report lists the features the server lacks
+// so that missing data is not mistaken for the absence of an issue.
+
+// Feature is a capability of the server some part of the analysis depends on
+type Feature string
+
+const (
+	// FeatureLockWaitStart is pg_locks.waitstart, the time a lock wait began
+	FeatureLockWaitStart Feature = "lock_wait_start"
+	// FeatureParallelLeader is pg_stat_activity.leader_pid, the leader of a parallel worker
+	FeatureParallelLeader Feature = "parallel_leader"
+	// FeatureQueryID is pg_stat_activity.query_id, the identifier of the running query
+	FeatureQueryID Feature = "query_id"
+	// FeatureStatementStats is the pg_stat_statements extension, the statistics of each statement
+	FeatureStatementStats Feature = "statement_stats"
+)
+
+// serverFeature is a feature available from a PostgreSQL version, or with an extension installed
+// in the database the snapshot is taken from
+type serverFeature struct {
+	feature    Feature
+	minVersion int
+	extension  string
+	// impact tells how the report is affected when the feature is unsupported
+	impact string
+}
+
+// serverFeatures lists the features depending on the server version or its extensions
+var serverFeatures = []serverFeature{
+	{
+		feature:    FeatureLockWaitStart,
+		minVersion: 140000,
+		impact:     "lock wait times are estimated from the last state change of the waiting sessions",
+	},
+	{
+		feature:    FeatureParallelLeader,
+		minVersion: 130000,
+		impact:     "parallel workers are reported as sessions of their own",
+	},
+	{
+		feature:    FeatureQueryID,
+		minVersion: 140000,
+		impact:     "blocking and blocked sessions are linked to their statement statistics by query text",
+	},
+	{
+		feature:   FeatureStatementStats,
+		extension: "pg_stat_statements",
+		impact:    "blocking and blocked queries are reported without their statement statistics",
+	},
+}
+
+// UnsupportedFeature is a feature of the analysis the server does not support
+type UnsupportedFeature struct {
+	Feature Feature
+	// Reason tells why the feature is unavailable (e.g. "requires PostgreSQL 14")
+	Reason string
+	// Impact tells how the report is affected
+	Impact string
+}
+
+// capabilities tells which features a server supports from its version number
+// (server_version_num, e.g. 140005 for 14.5) and its extensions. An unknown version supports no
+// version dependent feature, unknown extensions no extension.
+type capabilities struct {
+	versionNum int
+	// extensions are the versions of the installed extensions by name, nil when unknown
+	extensions map[string]string
+}
+
+// snapshotCapabilities returns the capabilities of the server a snapshot was taken from, as far as
+// collected
+func snapshotCapabilities(snapshot *Snapshot) capabilities {
+	return capabilities{versionNum: snapshot.ServerVersion, extensions: snapshot.Extensions}
+}
+
+// supports reports whether the server supports a feature
+func (c capabilities) supports(feature Feature) bool {
+	for _, f := range serverFeatures {
+		if f.feature == feature {
+			return c.supportsVersion(f) && c.supportsExtension(f)
+		}
+	}
+	return false
+}
+
+// supportsVersion reports whether the server version provides a feature
+func (c capabilities) supportsVersion(f serverFeature) bool {
+	return c.versionNum >= f.minVersion
+}
+
+// supportsExtension reports whether the extension a feature depends on is installed
+func (c capabilities) supportsExtension(f serverFeature) bool {
+	if f.extension == "" {
+		return true
+	}
+	_, ok := c.extensions[f.extension]
+	return ok
+}
+
+// column returns the column of a feature when the server supports it, or a NULL of its type
+func (c capabilities) column(feature Feature, column, sqlType string) string {
+	if c.supports(feature) {
+		return column
+	}
+	return "NULL::" + sqlType
+}
+
+// unsupportedFeatures lists the features the server of a snapshot does not support. Nothing is
+// reported from a server version or extensions that are unknown: the failure to read them is a
+// collector error, and the snapshots saved before extensions were collected do not list them.
+func unsupportedFeatures(snapshot *Snapshot) []UnsupportedFeature {
+	caps := snapshotCapabilities(snapshot)
+
+	var unsupported []UnsupportedFeature
+	for _, f := range serverFeatures {
+		var reason string
+		switch {
+		case caps.versionNum != 0 && !caps.supportsVersion(f):
+			reason = "requires PostgreSQL " + versionName(f.minVersion)
+		case caps.extensions != nil && !caps.supportsExtension(f):
+			reason = "requires the " + f.extension + " extension (CREATE EXTENSION " + f.extension + ")"
+		default:
+			continue
+		}
+		unsupported = append(unsupported, UnsupportedFeature{
+			Feature: f.feature,
+			Reason:  reason,
+			Impact:  f.impact,
+		})
+	}
+	return unsupported
+}
+
+// versionName returns the readable name of a version number: 140005 is 14.5, 90624 is 9.6.24,
+// and the minor version is left out when zero
+func versionName(versionNum int) string {
+	if versionNum == 0 {
+		return ""
+	}
+	if versionNum < 100000 {
+		return fmt.Sprintf("%d.%d.%d", versionNum/10000, versionNum/100%100, versionNum%100)
+	}
+	if versionNum%10000 == 0 {
+		return fmt.Sprintf("%d", versionNum/10000)
+	}
+	return fmt.Sprintf("%d.%d", versionNum/10000, versionNum%10000)
+}
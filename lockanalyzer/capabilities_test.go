@@ -0,0 +1,99 @@
+package lockanalyzer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCapabilitiesColumns tests that the collectors select the columns the server version provides
+func TestCapabilitiesColumns(t *testing.T) {
+	tests := []struct {
+		versionNum int
+		waitStart  string
+		leaderPID  string
+		queryID    string
+	}{
+		{0, "NULL::timestamptz", "NULL::int", "NULL::bigint"},
+		{120004, "NULL::timestamptz", "NULL::int", "NULL::bigint"},
+		{130011, "NULL::timestamptz", "leader_pid", "NULL::bigint"},
+		{140000, "l.waitstart", "leader_pid", "query_id"},
+		{170002, "l.waitstart", "leader_pid", "query_id"},
+	}
+
+	for _, tt := range tests {
+		caps := capabilities{versionNum: tt.versionNum}
+		if got := caps.column(FeatureLockWaitStart, "l.waitstart", "timestamptz"); got != tt.waitStart {
+			t.Errorf("Version %d: expected wait start column %s, got: %s", tt.versionNum, tt.waitStart, got)
+		}
+		if got := caps.column(FeatureParallelLeader, "leader_pid", "int"); got != tt.leaderPID {
+			t.Errorf("Version %d: expected leader column %s, got: %s", tt.versionNum, tt.leaderPID, got)
+		}
+		if got := caps.column(FeatureQueryID, "query_id", "bigint"); got != tt.queryID {
+			t.Errorf("Version %d: expected query id column %s, got: %s", tt.versionNum, tt.queryID, got)
+		}
+	}
+}
+
+// TestVersionName tests the readable names of server version numbers
+func TestVersionName(t *testing.T) {
+	tests := map[int]string{
+		0:      "",
+		90624:  "9.6.24",
+		120004: "12.4",
+		140000: "14",
+		170002: "17.2",
+	}
+	for versionNum, expected := range tests {
+		if got := versionName(versionNum); got != expected {
+			t.Errorf("Version %d: expected %q, got: %q", versionNum, expected, got)
+		}
+	}
+}
+
+// TestAnalyzeUnsupportedFeatures tests that the report lists the features the server is too old for
+func TestAnalyzeUnsupportedFeatures(t *testing.T) {
+	snapshot := createTestSnapshot()
+
+	data := Analyze(snapshot, DefaultAnalyzerOptions())
+	if data.ServerVersion != "16.2" || len(data.UnsupportedFeatures) != 0 {
+		t.Errorf("Expected PostgreSQL 16.2 to support every feature, got %q: %+v", data.ServerVersion, data.UnsupportedFeatures)
+	}
+
+	snapshot.ServerVersion = 130011
+	data = Analyze(snapshot, DefaultAnalyzerOptions())
+	var features []Feature
+	for _, unsupported := range data.UnsupportedFeatures {
+		features = append(features, unsupported.Feature)
+		if unsupported.Reason != "requires PostgreSQL 14" {
+			t.Errorf("Unexpected reason for %s: %s", unsupported.Feature, unsupported.Reason)
+		}
+	}
+	if expected := []Feature{FeatureLockWaitStart, FeatureQueryID}; !reflect.DeepEqual(features, expected) {
+		t.Errorf("Expected unsupported features %v, got: %v", expected, features)
+	}
+
+	// A server whose version could not be read is reported through the collector errors
+	snapshot.ServerVersion = 0
+	data = Analyze(snapshot, DefaultAnalyzerOptions())
+	if data.ServerVersion != "" || len(data.UnsupportedFeatures) != 0 {
+		t.Errorf("Expected no unsupported features without server version, got: %+v", data.UnsupportedFeatures)
+	}
+}
+
+// TestDetectLongTransactionsParallelWorkers tests that parallel workers are left out of the long
+// transactions, their leader being reported
+func TestDetectLongTransactionsParallelWorkers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-10 * time.Minute)
+	activity := []ActivityRow{
+		{PID: 10, LeaderPID: 10, State: "active", QueryStart: start, Query: "SELECT count(*) FROM orders"},
+		{PID: 11, LeaderPID: 10, State: "active", QueryStart: start, Query: "SELECT count(*) FROM orders"},
+		{PID: 12, LeaderPID: 10, State: "active", QueryStart: start, Query: "SELECT count(*) FROM orders"},
+	}
+
+	longTxns := detectLongTransactions(activity, now, time.Minute)
+	if len(longTxns) != 1 || longTxns[0].PID != 10 {
+		t.Errorf("Expected only the parallel leader to be reported, got: %+v", longTxns)
+	}
+}
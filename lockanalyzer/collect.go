@@ -0,0 +1,248 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// snapshotCollector is the name under which a failure to open the report snapshot is recorded
+const snapshotCollector = "snapshot"
+
+// snapshotTxOptions are the options of the transaction shared by all the collectors of a report
+var snapshotTxOptions = &sql.TxOptions{
+	Isolation: sql.LevelRepeatableRead,
+	ReadOnly:  true,
+}
+
+// CollectorError contains information about a collector that failed or timed out
+type CollectorError struct {
+	Collector string
+	Error     string
+	TimedOut  bool
+}
+
+// collector retrieves one part of the snapshot data
+type collector struct {
+	name    string
+	collect func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error
+	// enabled reports whether the collector runs with the given options and the data collected
+	// so far (always when nil)
+	enabled func(opts AnalyzerOptions, snapshot *Snapshot) bool
+}
+
+// collectors lists the collectors run for each snapshot, in order
+var collectors = []collector{
+	{
+		name: "server_version",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.ServerVersion, err = serverVersionNum(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "extensions",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Extensions, err = getExtensions(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "recovery",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.InRecovery, snapshot.LastReplayTime, err = getRecoveryState(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "databases",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Databases, err = getDatabaseRows(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "locks",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Locks, err = getLockRows(ctx, db, snapshotCapabilities(snapshot))
+			return err
+		},
+	},
+	{
+		name: "relations",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Relations, err = getRelationRows(ctx, db, lockedRelations(snapshot))
+			return err
+		},
+		enabled: func(opts AnalyzerOptions, snapshot *Snapshot) bool {
+			return len(lockedRelations(snapshot)) > 0
+		},
+	},
+	{
+		name: "activity",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Activity, err = getActivityRows(ctx, db, snapshotCapabilities(snapshot))
+			return err
+		},
+	},
+	{
+		// Settings precede the statements, whose query texts are cut at track_activity_query_size
+		name: "settings",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Settings, err = getSettings(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "statements",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Statements, err = getStatementRows(ctx, db, snapshotCapabilities(snapshot), lockWaitSessions(snapshot.Activity),
+				snapshot.Databases, activityQuerySize(snapshot.Settings))
+			return err
+		},
+		enabled: func(opts AnalyzerOptions, snapshot *Snapshot) bool {
+			return snapshotCapabilities(snapshot).supports(FeatureStatementStats) && len(lockWaitSessions(snapshot.Activity)) > 0
+		},
+	},
+	{
+		name: "vacuum_progress",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.VacuumProgress, err = getVacuumProgressRows(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "prepared_xacts",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.PreparedXacts, err = getPreparedXactRows(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "indexes",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.Indexes, err = getIndexRows(ctx, db, opts)
+			return err
+		},
+	},
+	{
+		name: "database_stats",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			snapshot.DatabaseStats, err = getDatabaseStats(ctx, db)
+			return err
+		},
+	},
+	{
+		name: "row_locks",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) (err error) {
+			// Extensions are unknown when their collector failed, pgrowlocks is then tried anyway
+			if _, ok := snapshot.Extensions["pgrowlocks"]; !ok && snapshot.Extensions != nil {
+				return errPgRowLocksMissing
+			}
+			snapshot.RowLockTables, snapshot.RowLocks, err = getPgRowLocks(ctx, db, opts.RowLockTables)
+			return err
+		},
+		enabled: func(opts AnalyzerOptions, snapshot *Snapshot) bool {
+			return len(opts.RowLockTables) > 0
+		},
+	},
+}
+
+// beginSnapshot starts the read-only REPEATABLE READ transaction in which every collector of a report
+// runs, and returns the server time at which the snapshot was taken.
+// Catalog lookups are consistent within the transaction and pg_stat_activity is read once per
+// transaction by the statistics system, so all the collectors see the same sessions. pg_locks and
+// pg_blocking_pids() are not transactional though: they read the live lock manager state on each
+// statement, so the locks collector and the blocking PIDs of the activity collector are taken a
+// few milliseconds apart and may disagree on a lock acquired or released meanwhile.
+func beginSnapshot(ctx context.Context, db bun.IDB) (bun.Tx, time.Time, error) {
+	var timestamp time.Time
+
+	tx, err := db.BeginTx(ctx, snapshotTxOptions)
+	if err != nil {
+		return tx, timestamp, err
+	}
+
+	if err := tx.QueryRowContext(ctx, "SELECT now()").Scan(&timestamp); err != nil {
+		_ = tx.Rollback()
+		return tx, timestamp, err
+	}
+
+	return tx, timestamp, nil
+}
+
+// queryCanceledState is the SQLSTATE of a statement cancelled by statement_timeout
+const queryCanceledState = "57014"
+
+// runCollector runs a collector within the query timeout and records its failure in the snapshot.
+// Inside a snapshot transaction, the collector runs in a savepoint so that a failed or cancelled
+// query does not abort the transaction for the following collectors.
+func runCollector(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot, c collector) {
+	if err := collectInSavepoint(ctx, db, opts, snapshot, c); err != nil {
+		snapshot.CollectorErrors = append(snapshot.CollectorErrors, CollectorError{
+			Collector: c.name,
+			Error:     err.Error(),
+			TimedOut:  isTimeout(err),
+		})
+	}
+}
+
+// collectInSavepoint runs a collector, wrapped in a savepoint when db is a transaction.
+// Within the transaction, the query timeout is enforced by the server with statement_timeout: the
+// driver closes the connection of a query whose context expires, which would end the snapshot
+// transaction for the following collectors. Outside a transaction, the connection is not shared
+// and the timeout is the deadline of the context.
+func collectInSavepoint(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot, c collector) error {
+	tx, ok := db.(bun.Tx)
+	if !ok {
+		if opts.QueryTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.QueryTimeout)
+			defer cancel()
+		}
+		return c.collect(ctx, db, opts, snapshot)
+	}
+
+	savepoint, err := tx.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// SET LOCAL lasts until the end of the transaction, so each collector sets its own timeout
+	timeout := int64(0)
+	if opts.QueryTimeout > 0 {
+		timeout = max(opts.QueryTimeout.Milliseconds(), 1)
+	}
+	if _, err := savepoint.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout)); err != nil {
+		_ = savepoint.Rollback()
+		return err
+	}
+
+	if err := c.collect(ctx, savepoint, opts, snapshot); err != nil {
+		_ = savepoint.Rollback()
+		return err
+	}
+
+	return savepoint.Commit()
+}
+
+// isTimeout reports whether a collector error comes from the query timeout, either the deadline
+// of the context or statement_timeout
+func isTimeout(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == queryCanceledState {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// serverVersionNum returns the server version as a number (e.g. 140005 for 14.5)
+func serverVersionNum(ctx context.Context, db bun.IDB) (int, error) {
+	var versionNum int
+	err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum)
+	return versionNum, err
+}
@@ -0,0 +1,115 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// TestRunCollectorTimeout tests that a slow collector is stopped and reported as timed out
+func TestRunCollectorTimeout(t *testing.T) {
+	snapshot := &Snapshot{}
+	slow := collector{
+		name: "slow",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	runCollector(context.Background(), nil, AnalyzerOptions{QueryTimeout: 10 * time.Millisecond}, snapshot, slow)
+
+	if len(snapshot.CollectorErrors) != 1 {
+		t.Fatalf("Expected 1 collector error, got: %d", len(snapshot.CollectorErrors))
+	}
+	if snapshot.CollectorErrors[0].Collector != "slow" {
+		t.Errorf("Expected failed collector: slow, got: %s", snapshot.CollectorErrors[0].Collector)
+	}
+	if !snapshot.CollectorErrors[0].TimedOut {
+		t.Error("Collector error should be reported as timed out")
+	}
+}
+
+// TestRunCollectorFailure tests that a failing collector is recorded without a timeout flag
+func TestRunCollectorFailure(t *testing.T) {
+	snapshot := &Snapshot{}
+	failing := collector{
+		name: "failing",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+			return errors.New("permission denied")
+		},
+	}
+
+	runCollector(context.Background(), nil, DefaultAnalyzerOptions(), snapshot, failing)
+
+	if len(snapshot.CollectorErrors) != 1 {
+		t.Fatalf("Expected 1 collector error, got: %d", len(snapshot.CollectorErrors))
+	}
+	if snapshot.CollectorErrors[0].TimedOut {
+		t.Error("Collector error should not be reported as timed out")
+	}
+	if snapshot.CollectorErrors[0].Error != "permission denied" {
+		t.Errorf("Expected error: permission denied, got: %s", snapshot.CollectorErrors[0].Error)
+	}
+}
+
+// TestRunCollectorStatementTimeout tests that a query cancelled by statement_timeout is reported as
+// timed out
+func TestRunCollectorStatementTimeout(t *testing.T) {
+	snapshot := &Snapshot{}
+	cancelled := collector{
+		name: "cancelled",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+			return &pq.Error{Code: queryCanceledState, Message: "canceling statement due to statement timeout"}
+		},
+	}
+
+	runCollector(context.Background(), nil, DefaultAnalyzerOptions(), snapshot, cancelled)
+
+	if len(snapshot.CollectorErrors) != 1 || !snapshot.CollectorErrors[0].TimedOut {
+		t.Errorf("Expected the collector to be reported as timed out, got: %+v", snapshot.CollectorErrors)
+	}
+}
+
+// TestGenerateLocksReportContextCancelled tests that a cancelled context returns a partial report
+func TestGenerateLocksReportContextCancelled(t *testing.T) {
+	sqldb, err := sql.Open("postgres", "postgres://localhost:1/unreachable?sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db := bun.NewDB(sqldb, pgdialect.New())
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := GenerateLocksReportContext(ctx, db, DefaultAnalyzerOptions())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if report == nil {
+		t.Fatal("A partial report should be returned")
+	}
+	// The snapshot cannot be opened and every enabled collector fails
+	enabled := 0
+	for _, c := range collectors {
+		if c.enabled == nil || c.enabled(DefaultAnalyzerOptions(), &Snapshot{}) {
+			enabled++
+		}
+	}
+	if len(report.CollectorErrors) != enabled+1 {
+		t.Errorf("Expected %d collector errors, got: %d", enabled+1, len(report.CollectorErrors))
+	}
+	if report.CollectorErrors[0].Collector != snapshotCollector {
+		t.Errorf("Expected first failure on the snapshot, got: %s", report.CollectorErrors[0].Collector)
+	}
+	if report.Timestamp.IsZero() {
+		t.Error("Report timestamp should fall back to the client time")
+	}
+}
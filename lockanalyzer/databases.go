@@ -0,0 +1,173 @@
+package lockanalyzer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/uptrace/bun"
+)
+
+// pg_locks and pg_stat_activity cover every database of the server, but pg_class only describes
+// the relations of the database it is read from. The relations locked in other databases are
+// resolved through a short-lived connection to each of them, outside of the snapshot transaction:
+// the OID of a relation does not change while it exists, so the names read a moment later match.
+
+// databaseRelationsCollector is the name under which the failures to resolve the relations of
+// other databases are recorded, followed by the database
+const databaseRelationsCollector = "relations"
+
+// relationKey identifies a relation of the server
+type relationKey struct {
+	database uint32
+	oid      uint32
+}
+
+// relationIndex holds the relations of a snapshot by database and OID
+type relationIndex map[relationKey]RelationRow
+
+// newRelationIndex indexes the relation rows of a snapshot
+func newRelationIndex(rows []RelationRow) relationIndex {
+	index := make(relationIndex, len(rows))
+	for _, row := range rows {
+		index[relationKey{database: row.Database, oid: row.OID}] = row
+	}
+	return index
+}
+
+// lookup returns the relation locked in a database. Shared catalogs are listed without database,
+// like the relations of the snapshots saved before relations carried their database.
+func (i relationIndex) lookup(database, oid uint32) (RelationRow, bool) {
+	if relation, ok := i[relationKey{database: database, oid: oid}]; ok {
+		return relation, true
+	}
+	relation, ok := i[relationKey{oid: oid}]
+	return relation, ok
+}
+
+// getDatabaseRows retrieves the databases of the server
+func getDatabaseRows(ctx context.Context, db bun.IDB) ([]DatabaseRow, error) {
+	query := `
+		SELECT
+			oid,
+			datname,
+			datname = current_database()
+		FROM pg_database
+		ORDER BY datname
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var databases []DatabaseRow
+	for rows.Next() {
+		var database DatabaseRow
+		var oid int64
+		if err := rows.Scan(&oid, &database.Name, &database.Current); err != nil {
+			continue
+		}
+		database.OID = uint32(oid)
+		databases = append(databases, database)
+	}
+
+	return databases, rows.Err()
+}
+
+// databaseNames returns the names of the databases of a snapshot by OID, along with the name of
+// the database the snapshot was taken from (empty when unknown)
+func databaseNames(rows []DatabaseRow) (map[uint32]string, string) {
+	names := make(map[uint32]string, len(rows))
+	var current string
+	for _, row := range rows {
+		names[row.OID] = row.Name
+		if row.Current {
+			current = row.Name
+		}
+	}
+	return names, current
+}
+
+// lockedRelations returns the OIDs of the relations locked in the current database or in the
+// shared catalogs, in order. When the current database is unknown, the relations locked in every
+// database are returned: a relation of the current database with the OID of one of them is
+// recorded under the current database and is not mistaken for it.
+func lockedRelations(snapshot *Snapshot) []uint32 {
+	var current uint32
+	for _, database := range snapshot.Databases {
+		if database.Current {
+			current = database.OID
+		}
+	}
+
+	seen := make(map[uint32]bool)
+	var oids []uint32
+	for _, row := range snapshot.Locks {
+		if row.Relation == 0 || seen[row.Relation] || (current != 0 && row.Database != 0 && row.Database != current) {
+			continue
+		}
+		seen[row.Relation] = true
+		oids = append(oids, row.Relation)
+	}
+	sort.Slice(oids, func(i, j int) bool { return oids[i] < oids[j] })
+	return oids
+}
+
+// unresolvedRelations returns the OIDs of the relations locked in each database that the
+// snapshot does not describe, in order
+func unresolvedRelations(snapshot *Snapshot) map[uint32][]uint32 {
+	relations := newRelationIndex(snapshot.Relations)
+	seen := make(map[relationKey]bool)
+	unresolved := make(map[uint32][]uint32)
+	for _, row := range snapshot.Locks {
+		key := relationKey{database: row.Database, oid: row.Relation}
+		if row.Database == 0 || row.Relation == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := relations[key]; !ok {
+			unresolved[row.Database] = append(unresolved[row.Database], row.Relation)
+		}
+	}
+	for _, oids := range unresolved {
+		sort.Slice(oids, func(i, j int) bool { return oids[i] < oids[j] })
+	}
+	return unresolved
+}
+
+// collectDatabaseRelations resolves the relations locked in the databases matching opts.Databases,
+// connecting to each database with locked relations the snapshot does not describe. Each database
+// is collected within opts.QueryTimeout and its failure is recorded in the snapshot.
+func (s *PostgresSource) collectDatabaseRelations(ctx context.Context, opts AnalyzerOptions, snapshot *Snapshot) {
+	if s.connect == nil {
+		snapshot.CollectorErrors = append(snapshot.CollectorErrors, CollectorError{
+			Collector: databaseRelationsCollector,
+			Error:     "no connector to open connections to other databases (see NewClusterSource)",
+		})
+		return
+	}
+
+	unresolved := unresolvedRelations(snapshot)
+	for _, database := range snapshot.Databases {
+		oids := unresolved[database.OID]
+		if database.Current || len(oids) == 0 || !matchesPattern(opts.Databases, database.Name) {
+			continue
+		}
+
+		runCollector(ctx, nil, opts, snapshot, collector{
+			name: databaseRelationsCollector + " " + database.Name,
+			collect: func(ctx context.Context, _ bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+				conn, err := s.connect(ctx, database.Name)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+
+				relations, err := getDatabaseRelationRows(ctx, conn, oids)
+				snapshot.Relations = append(snapshot.Relations, relations...)
+				return err
+			},
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package lockanalyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/uptrace/bun"
+)
+
+// TestBuildLocksAcrossDatabases tests that relations are resolved in their own database and that
+// the objects of different databases never conflict
+func TestBuildLocksAcrossDatabases(t *testing.T) {
+	snapshot := &Snapshot{
+		Databases: []DatabaseRow{{OID: 5, Name: "shop", Current: true}, {OID: 6, Name: "billing"}},
+		Relations: []RelationRow{
+			{Database: 5, OID: 16400, Schema: "public", Name: "orders", Kind: "r"},
+			{Database: 6, OID: 16400, Schema: "public", Name: "invoices", Kind: "r"},
+			{OID: 1262, Schema: "pg_catalog", Name: "pg_database", Kind: "r"},
+		},
+		Locks: []LockRow{
+			{PID: 1, LockType: "relation", Database: 5, Relation: 16400, Mode: "AccessExclusiveLock", Granted: true},
+			{PID: 2, LockType: "relation", Database: 6, Relation: 16400, Mode: "AccessShareLock", Granted: false},
+			{PID: 3, LockType: "relation", Database: 6, Relation: 16500, Mode: "AccessShareLock", Granted: true},
+			{PID: 3, LockType: "relation", Relation: 1262, Mode: "AccessShareLock", Granted: true},
+			{PID: 3, LockType: "transactionid", TransactionID: "900", Mode: "ExclusiveLock", Granted: true},
+			{PID: 1, LockType: "advisory", Database: 5, ObjID: 42, ObjSubID: 1, Mode: "ExclusiveLock", Granted: true},
+			{PID: 2, LockType: "advisory", Database: 6, ObjID: 42, ObjSubID: 1, Mode: "ExclusiveLock", Granted: true},
+		},
+		Activity: []ActivityRow{
+			{PID: 1, Database: "shop"},
+			{PID: 2, Database: "billing"},
+			{PID: 3, Database: "billing"},
+		},
+	}
+
+	locks := buildLocks(snapshot)
+	expected := map[string]string{
+		"1/AccessExclusiveLock/public.orders":      "shop",
+		"2/AccessShareLock/public.invoices":        "billing",
+		"3/AccessShareLock/16500":                  "billing",
+		"3/AccessShareLock/pg_catalog.pg_database": "billing",
+		"3/ExclusiveLock/N/A":                      "billing",
+	}
+	for _, lock := range locks {
+		if lock.Type == "advisory" {
+			continue
+		}
+		key := lockKey(lock)
+		database, ok := expected[key]
+		if !ok {
+			t.Errorf("Unexpected lock: %s", key)
+			continue
+		}
+		if lock.Database != database {
+			t.Errorf("Expected lock %s in database %s, got: %q", key, database, lock.Database)
+		}
+	}
+
+	if conflicts := detectObjectConflicts(locks); len(conflicts) != 0 {
+		t.Errorf("Relations of different databases must not conflict, got: %+v", conflicts)
+	}
+
+	advisoryLocks := detectAdvisoryLocks(locks)
+	if len(advisoryLocks) != 2 || advisoryLocks[0].Database == advisoryLocks[1].Database {
+		t.Errorf("Expected the advisory key once per database, got: %+v", advisoryLocks)
+	}
+}
+
+// lockKey describes a lock by PID, mode and object
+func lockKey(lock LockInfo) string {
+	return fmt.Sprintf("%d/%s/%s", lock.PID, lock.Mode, lock.Object)
+}
+
+// TestBuildLocksWithoutDatabases tests the snapshots saved before relations carried their database
+func TestBuildLocksWithoutDatabases(t *testing.T) {
+	snapshot := &Snapshot{
+		Relations: []RelationRow{{OID: 16400, Schema: "public", Name: "orders", Kind: "r"}},
+		Locks:     []LockRow{{PID: 1, LockType: "relation", Database: 5, Relation: 16400, Mode: "AccessShareLock", Granted: true}},
+		Activity:  []ActivityRow{{PID: 1}},
+	}
+
+	locks := buildLocks(snapshot)
+	if len(locks) != 1 || locks[0].Object != "public.orders" || locks[0].Database != "" {
+		t.Errorf("Expected public.orders without database, got: %+v", locks)
+	}
+}
+
+// TestUnresolvedRelations tests the relations left to resolve in other databases
+func TestUnresolvedRelations(t *testing.T) {
+	snapshot := &Snapshot{
+		Relations: []RelationRow{{Database: 5, OID: 16400}, {OID: 1262}},
+		Locks: []LockRow{
+			{LockType: "relation", Database: 5, Relation: 16400},
+			{LockType: "relation", Relation: 1262},
+			{LockType: "relation", Database: 6, Relation: 16500},
+			{LockType: "relation", Database: 6, Relation: 16400},
+			{LockType: "tuple", Database: 6, Relation: 16500, Page: "0", Tuple: "1"},
+			{LockType: "transactionid", TransactionID: "900"},
+		},
+	}
+
+	unresolved := unresolvedRelations(snapshot)
+	if len(unresolved) != 1 || len(unresolved[6]) != 2 || unresolved[6][0] != 16400 || unresolved[6][1] != 16500 {
+		t.Errorf("Expected relations 16400 and 16500 of database 6, got: %v", unresolved)
+	}
+}
+
+// TestLockedRelations tests the relations resolved from the current database: those of its locks
+// and of the shared catalogs
+func TestLockedRelations(t *testing.T) {
+	snapshot := &Snapshot{
+		Databases: []DatabaseRow{{OID: 5, Name: "app", Current: true}, {OID: 6, Name: "billing"}},
+		Locks: []LockRow{
+			{LockType: "relation", Database: 5, Relation: 16500},
+			{LockType: "relation", Relation: 1262},
+			{LockType: "tuple", Database: 5, Relation: 16500, Page: "0", Tuple: "1"},
+			{LockType: "relation", Database: 6, Relation: 16400},
+			{LockType: "transactionid", TransactionID: "900"},
+		},
+	}
+
+	if oids := lockedRelations(snapshot); !reflect.DeepEqual(oids, []uint32{1262, 16500}) {
+		t.Errorf("Expected relations 1262 and 16500, got: %v", oids)
+	}
+
+	// Without the current database, every locked relation is looked up
+	snapshot.Databases = nil
+	if oids := lockedRelations(snapshot); !reflect.DeepEqual(oids, []uint32{1262, 16400, 16500}) {
+		t.Errorf("Expected relations 1262, 16400 and 16500, got: %v", oids)
+	}
+}
+
+// TestCollectDatabaseRelations tests that only the matching databases with unresolved relations
+// are connected to, and that connection failures are recorded
+func TestCollectDatabaseRelations(t *testing.T) {
+	snapshot := &Snapshot{
+		Databases: []DatabaseRow{
+			{OID: 5, Name: "shop", Current: true},
+			{OID: 6, Name: "billing"},
+			{OID: 7, Name: "billing_archive"},
+			{OID: 8, Name: "reporting"},
+		},
+		Locks: []LockRow{
+			{LockType: "relation", Database: 5, Relation: 16400},
+			{LockType: "relation", Database: 6, Relation: 16400},
+			{LockType: "relation", Database: 8, Relation: 16400},
+		},
+	}
+
+	var connected []string
+	source := NewClusterSource(nil, func(ctx context.Context, database string) (*bun.DB, error) {
+		connected = append(connected, database)
+		return nil, errors.New("permission denied for database " + database)
+	})
+	opts := DefaultAnalyzerOptions()
+	opts.Databases = []string{"billing*", "shop"}
+
+	source.collectDatabaseRelations(context.Background(), opts, snapshot)
+
+	if len(connected) != 1 || connected[0] != "billing" {
+		t.Errorf("Expected a connection to billing only, got: %v", connected)
+	}
+	if len(snapshot.CollectorErrors) != 1 || snapshot.CollectorErrors[0].Collector != "relations billing" {
+		t.Errorf("Expected the failure of billing to be recorded, got: %+v", snapshot.CollectorErrors)
+	}
+
+	snapshot.CollectorErrors = nil
+	NewPostgresSource(nil).collectDatabaseRelations(context.Background(), opts, snapshot)
+	if len(snapshot.CollectorErrors) != 1 || snapshot.CollectorErrors[0].Collector != databaseRelationsCollector {
+		t.Errorf("Expected an error without connector, got: %+v", snapshot.CollectorErrors)
+	}
+}
@@ -0,0 +1,142 @@
+package lockanalyzer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pbouamriou/lock-analyzer/lockmodes"
+)
+
+// Lock requests on a relation are queued: a request waits not only for the conflicting locks that
+// are granted, but also for the conflicting requests queued before it. A DDL statement waiting for
+// an AccessExclusiveLock behind a long SELECT therefore blocks every later query on the table, even
+// the ones that do not conflict with the SELECT, until the SELECT ends or the DDL gives up.
+
+// ddlLockTimeout is the lock_timeout suggested for DDL statements
+const ddlLockTimeout = "5s"
+
+// DDLQueue is a DDL statement waiting for a relation lock with sessions queued behind it
+type DDLQueue struct {
+	Database string
+	Schema   string
+	Object   string
+	// DDL is the waiting lock of the DDL statement
+	DDL LockInfo
+	// Holders are the granted locks the DDL statement waits for, the oldest transaction first
+	Holders []DDLQueueHolder
+	// Queued are the waiting locks that only conflict with the DDL statement, not with the holders
+	Queued []LockInfo
+}
+
+// DDLQueueHolder is a session holding a lock a DDL statement waits for
+type DDLQueueHolder struct {
+	PID   int
+	Mode  string
+	State string
+	Query string
+	// TransactionAge is the time elapsed since the transaction of the holder began
+	TransactionAge time.Duration
+}
+
+// Recommendation tells how to avoid the pile-up
+func (q DDLQueue) Recommendation() string {
+	return "Run the DDL with SET lock_timeout = '" + ddlLockTimeout + "' and retry it until it gets its lock, " +
+		"rather than letting it block every query on " + q.Object
+}
+
+// isDDLMode reports whether a relation lock mode is taken by DDL or maintenance statements,
+// rather than by queries reading or modifying rows
+func isDDLMode(mode string) bool {
+	parsed, err := lockmodes.ParseMode(mode)
+	return err == nil && parsed >= lockmodes.ShareUpdateExclusive
+}
+
+// detectDDLQueues lists the DDL statements waiting for a relation lock with sessions queued behind
+// them, the longest queues first
+func detectDDLQueues(locks []LockInfo, timestamp time.Time) []DDLQueue {
+	relationLocks := make(map[string][]LockInfo)
+	for _, lock := range locks {
+		if lock.Type == "relation" {
+			relationLocks[lockTag(lock)] = append(relationLocks[lockTag(lock)], lock)
+		}
+	}
+
+	var queues []DDLQueue
+	for _, objectLocks := range relationLocks {
+		for _, ddl := range objectLocks {
+			if ddl.Granted || !isDDLMode(ddl.Mode) {
+				continue
+			}
+
+			queue := DDLQueue{Database: ddl.Database, Schema: ddl.Schema, Object: ddl.Object, DDL: ddl}
+			var granted []LockInfo
+			for _, holder := range objectLocks {
+				if !holder.Granted || holder.PID == ddl.PID {
+					continue
+				}
+				granted = append(granted, holder)
+				if lockmodes.ModesConflict(holder.Mode, ddl.Mode) {
+					queue.Holders = append(queue.Holders, ddlQueueHolder(holder, timestamp))
+				}
+			}
+
+			for _, waiter := range objectLocks {
+				if waiter.Granted || waiter.PID == ddl.PID || !lockmodes.ModesConflict(ddl.Mode, waiter.Mode) {
+					continue
+				}
+				// Sessions queued before the DDL are not blocked by it
+				if waiter.WaitTime > ddl.WaitTime {
+					continue
+				}
+				if !conflictsWithAny(waiter, granted) {
+					queue.Queued = append(queue.Queued, waiter)
+				}
+			}
+
+			if len(queue.Holders) == 0 || len(queue.Queued) == 0 {
+				continue
+			}
+
+			sort.SliceStable(queue.Holders, func(i, j int) bool {
+				return queue.Holders[i].TransactionAge > queue.Holders[j].TransactionAge
+			})
+			sort.SliceStable(queue.Queued, func(i, j int) bool {
+				return queue.Queued[i].WaitTime > queue.Queued[j].WaitTime
+			})
+			queues = append(queues, queue)
+		}
+	}
+
+	sort.Slice(queues, func(i, j int) bool {
+		if len(queues[i].Queued) != len(queues[j].Queued) {
+			return len(queues[i].Queued) > len(queues[j].Queued)
+		}
+		return queues[i].DDL.WaitTime > queues[j].DDL.WaitTime
+	})
+
+	return queues
+}
+
+// conflictsWithAny reports whether a lock conflicts with one of the locks of other sessions
+func conflictsWithAny(lock LockInfo, others []LockInfo) bool {
+	for _, other := range others {
+		if other.PID != lock.PID && lockmodes.ModesConflict(other.Mode, lock.Mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// ddlQueueHolder describes the session holding a lock a DDL statement waits for
+func ddlQueueHolder(lock LockInfo, timestamp time.Time) DDLQueueHolder {
+	holder := DDLQueueHolder{
+		PID:   lock.PID,
+		Mode:  lock.Mode,
+		State: lock.State,
+		Query: lock.Query,
+	}
+	if !lock.XactStart.IsZero() && timestamp.After(lock.XactStart) {
+		holder.TransactionAge = timestamp.Sub(lock.XactStart)
+	}
+	return holder
+}
@@ -0,0 +1,58 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDetectDDLQueues tests that the sessions queued behind a waiting DDL statement are counted,
+// leaving out the ones blocked by the holders themselves or queued before the DDL
+func TestDetectDDLQueues(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		Timestamp: now,
+		Relations: []RelationRow{
+			{OID: 1, Schema: "public", Name: "orders", Kind: "r"},
+			{OID: 2, Schema: "public", Name: "files", Kind: "r"},
+		},
+		Locks: []LockRow{
+			// A long report reads orders and an index build blocks writers
+			{PID: 1, LockType: "relation", Relation: 1, Mode: "AccessShareLock", Granted: true},
+			{PID: 5, LockType: "relation", Relation: 1, Mode: "ShareLock", Granted: true},
+			// A writer queued before the ALTER TABLE waits for the index build
+			{PID: 6, LockType: "relation", Relation: 1, Mode: "RowExclusiveLock", Granted: false, WaitStart: now.Add(-2 * time.Minute)},
+			{PID: 2, LockType: "relation", Relation: 1, Mode: "AccessExclusiveLock", Granted: false, WaitStart: now.Add(-time.Minute)},
+			// A read queued behind the ALTER TABLE, and a write also blocked by the index build
+			{PID: 3, LockType: "relation", Relation: 1, Mode: "AccessShareLock", Granted: false, WaitStart: now.Add(-30 * time.Second)},
+			{PID: 4, LockType: "relation", Relation: 1, Mode: "RowExclusiveLock", Granted: false, WaitStart: now.Add(-10 * time.Second)},
+			// A DDL statement without anything queued behind it
+			{PID: 10, LockType: "relation", Relation: 2, Mode: "AccessShareLock", Granted: true},
+			{PID: 11, LockType: "relation", Relation: 2, Mode: "AccessExclusiveLock", Granted: false, WaitStart: now.Add(-time.Minute)},
+		},
+		Activity: []ActivityRow{
+			{PID: 1, State: "active", Query: "SELECT sum(total) FROM orders", XactStart: now.Add(-30 * time.Minute)},
+			{PID: 2, State: "active", Query: "ALTER TABLE orders ADD COLUMN note text"},
+			{PID: 3, State: "active", Query: "SELECT * FROM orders WHERE id = 1"},
+			{PID: 5, State: "active", Query: "CREATE INDEX ON orders (total)", XactStart: now.Add(-5 * time.Minute)},
+		},
+	}
+
+	queues := detectDDLQueues(buildLocks(snapshot), now)
+
+	if len(queues) != 1 {
+		t.Fatalf("Expected 1 DDL queue, got: %+v", queues)
+	}
+	queue := queues[0]
+	if queue.Object != "public.orders" || queue.DDL.PID != 2 || queue.DDL.WaitTime != time.Minute {
+		t.Errorf("Expected the ALTER TABLE of PID 2 on public.orders, got: %+v", queue.DDL)
+	}
+	if len(queue.Holders) != 2 || queue.Holders[0].PID != 1 || queue.Holders[0].TransactionAge != 30*time.Minute || queue.Holders[1].PID != 5 {
+		t.Errorf("Expected holders 1 and 5, the oldest transaction first, got: %+v", queue.Holders)
+	}
+	if len(queue.Queued) != 1 || queue.Queued[0].PID != 3 {
+		t.Errorf("Expected only PID 3 queued behind the DDL, got: %+v", queue.Queued)
+	}
+	if queue.Recommendation() != "Run the DDL with SET lock_timeout = '5s' and retry it until it gets its lock, rather than letting it block every query on public.orders" {
+		t.Errorf("Unexpected recommendation: %s", queue.Recommendation())
+	}
+}
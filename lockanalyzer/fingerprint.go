@@ -0,0 +1,327 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sessions of the application run the same statements with different constants, so a report
+// with hundreds of identical waits groups the blocked transactions, long transactions and object
+// conflicts by the fingerprint of their query: its text with constants, IN lists, comments and
+// whitespace normalized. The groups are computed from the report on demand, by the formatters
+// and the JSON encoding.
+
+// inList matches an IN list of normalized constants, e.g. "in (?, ?, ?)"
+var inList = regexp.MustCompile(`\bin ?\( ?\?( ?, ?\?)* ?\)`)
+
+// normalizeQuery returns a query text with its constants and parameters replaced by "?", its
+// comments removed and its whitespace collapsed, so that a running query and its
+// pg_stat_statements entry compare equal
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	space := false
+	// prev is the last byte written, digits following a letter being part of an identifier
+	var prev byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = b.Len() > 0
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			// Comment up to the end of the line
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = b.Len() > 0
+			continue
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			// Block comment
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			space = b.Len() > 0
+			continue
+		case c == '"':
+			// Quoted identifier, kept as is
+			end := len(query) - 1
+			if j := strings.IndexByte(query[i+1:], '"'); j >= 0 {
+				end = i + 1 + j
+			}
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteString(query[i : end+1])
+			prev = '"'
+			i = end
+			continue
+		case c == '\'':
+			// String constant
+			i = stringEnd(query, i, false)
+			c = '?'
+		case strings.IndexByte("bBeEnNxX", c) >= 0 && i+1 < len(query) && query[i+1] == '\'' && (space || !isIdentifierByte(prev)):
+			// Escape (E'...'), bit (B'...', X'...') or national (N'...') string constant
+			i = stringEnd(query, i+1, lower(c) == 'e')
+			c = '?'
+		case (c == 'u' || c == 'U') && strings.HasPrefix(query[i+1:], "&'") && (space || !isIdentifierByte(prev)):
+			// String constant with Unicode escapes (U&'...'), backslashes not escaping quotes
+			i = stringEnd(query, i+2, false)
+			c = '?'
+		case c == '$' && dollarTag(query, i) != "" && (space || !isIdentifierByte(prev)):
+			// Dollar-quoted string constant, up to the same tag
+			tag := dollarTag(query, i)
+			if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag) - 1
+			} else {
+				i = len(query) - 1
+			}
+			c = '?'
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]) && (space || !isIdentifierByte(prev)),
+			isDigit(c) && (space || !isIdentifierByte(prev)),
+			c == '.' && startsNumber(query, i) && (space || !isIdentifierByte(prev)),
+			c == '-' && startsNumber(query, i+1) && !isOperandEnd(prev):
+			// Parameter or numeric constant (possibly starting with a dot, e.g. .5), a minus sign
+			// not following an operand being part of it
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			// Exponent, e.g. 1.5e-3
+			if j := i + 2; j < len(query) && (query[i+1] == 'e' || query[i+1] == 'E') {
+				if query[j] == '+' || query[j] == '-' {
+					j++
+				}
+				if j < len(query) && isDigit(query[j]) {
+					i = j
+					for i+1 < len(query) && isDigit(query[i+1]) {
+						i++
+					}
+				}
+			}
+			c = '?'
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		prev = lower(c)
+		b.WriteByte(prev)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// startsNumber reports whether a numeric constant starts at the given index: a digit, or a dot
+// followed by a digit
+func startsNumber(query string, i int) bool {
+	if i < len(query) && query[i] == '.' {
+		i++
+	}
+	return i < len(query) && isDigit(query[i])
+}
+
+// stringEnd returns the index of the quote closing the string constant opened at start, quotes
+// being escaped by doubling them, or by a backslash in escape strings (E'...')
+func stringEnd(query string, start int, backslash bool) int {
+	i := start + 1
+	for ; i < len(query); i++ {
+		switch {
+		case backslash && query[i] == '\\':
+			i++
+		case query[i] == '\'' && i+1 < len(query) && query[i+1] == '\'':
+			i++
+		case query[i] == '\'':
+			return i
+		}
+	}
+	return i
+}
+
+// dollarTag returns the tag opening a dollar-quoted string at start ($$ or $name$), or "" when
+// there is none
+func dollarTag(query string, start int) string {
+	i := start + 1
+	for ; i < len(query); i++ {
+		c := query[i]
+		if !(c == '_' || c >= 0x80 || (lower(c) >= 'a' && lower(c) <= 'z') || (i > start+1 && isDigit(c))) {
+			break
+		}
+	}
+	if i < len(query) && query[i] == '$' {
+		return query[start : i+1]
+	}
+	return ""
+}
+
+// isDigit reports whether a byte is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentifierByte reports whether a normalized byte can be part of an identifier
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || isDigit(c)
+}
+
+// isOperandEnd reports whether a normalized byte ends an operand, a following minus sign being a
+// subtraction
+func isOperandEnd(c byte) bool {
+	return isIdentifierByte(c) || c == ')' || c == '?' || c == '"'
+}
+
+// lower returns the lower case of an ASCII letter
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// queryFingerprint returns the fingerprint of a query, a hash of its normalized text where IN
+// lists of any length are the same, along with that text
+func queryFingerprint(query string) (fingerprint, normalized string) {
+	normalized = inList.ReplaceAllString(normalizeQuery(query), "in (...)")
+	hash := fnv.New64a()
+	hash.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", hash.Sum64()), normalized
+}
+
+// BlockedTxnGroup is a set of blocked transactions running the same query
+type BlockedTxnGroup struct {
+	Fingerprint string
+	// Query is the normalized query of the group
+	Query       string
+	Count       int
+	PIDs        []int
+	MaxDuration time.Duration
+	// Worst is the transaction of the group waiting the longest
+	Worst BlockedTransaction
+}
+
+// LongTxnGroup is a set of long transactions running the same query
+type LongTxnGroup struct {
+	Fingerprint string
+	// Query is the normalized query of the group
+	Query       string
+	Count       int
+	PIDs        []int
+	MaxDuration time.Duration
+	// Worst is the transaction of the group running the longest
+	Worst LongTransaction
+}
+
+// ConflictGroup is a set of object conflicts between the same lock modes on an object, the
+// waiters running the same query
+type ConflictGroup struct {
+	Fingerprint string
+	// Query is the normalized query of the waiters
+	Query       string
+	Count       int
+	WaiterPIDs  []int
+	HolderPIDs  []int
+	MaxWaitTime time.Duration
+	// Worst is the conflict of the waiter waiting the longest
+	Worst ObjectConflict
+}
+
+// queryGroup is a set of report items whose queries share a fingerprint, in order of appearance
+type queryGroup[T any] struct {
+	fingerprint string
+	query       string
+	items       []T
+}
+
+// groupByFingerprint groups report items by the fingerprint of their query and a key telling the
+// items that must not be mixed apart, the groups being in the order of their first item
+func groupByFingerprint[T any](items []T, query func(T) string, key func(T) string) []queryGroup[T] {
+	index := make(map[string]int)
+	var groups []queryGroup[T]
+	for _, item := range items {
+		fingerprint, normalized := queryFingerprint(query(item))
+		groupKey := fingerprint + "/" + key(item)
+		i, ok := index[groupKey]
+		if !ok {
+			i = len(groups)
+			index[groupKey] = i
+			groups = append(groups, queryGroup[T]{fingerprint: fingerprint, query: normalized})
+		}
+		groups[i].items = append(groups[i].items, item)
+	}
+	return groups
+}
+
+// appendPID appends a PID to a list unless already present
+func appendPID(pids []int, pid int) []int {
+	for _, p := range pids {
+		if p == pid {
+			return pids
+		}
+	}
+	return append(pids, pid)
+}
+
+// BlockedTxnGroups groups the blocked transactions of the report by database and query fingerprint
+func (d *ReportData) BlockedTxnGroups() []BlockedTxnGroup {
+	var groups []BlockedTxnGroup
+	for _, g := range groupByFingerprint(d.BlockedTxns,
+		func(t BlockedTransaction) string { return t.Query },
+		func(t BlockedTransaction) string { return t.Database }) {
+		group := BlockedTxnGroup{Fingerprint: g.fingerprint, Query: g.query, Count: len(g.items), Worst: g.items[0]}
+		for _, txn := range g.items {
+			group.PIDs = appendPID(group.PIDs, txn.PID)
+			if txn.Duration > group.Worst.Duration {
+				group.Worst = txn
+			}
+		}
+		group.MaxDuration = group.Worst.Duration
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// LongTxnGroups groups the long transactions of the report by database and query fingerprint
+func (d *ReportData) LongTxnGroups() []LongTxnGroup {
+	var groups []LongTxnGroup
+	for _, g := range groupByFingerprint(d.LongTxns,
+		func(t LongTransaction) string { return t.Query },
+		func(t LongTransaction) string { return t.Database }) {
+		group := LongTxnGroup{Fingerprint: g.fingerprint, Query: g.query, Count: len(g.items), Worst: g.items[0]}
+		for _, txn := range g.items {
+			group.PIDs = appendPID(group.PIDs, txn.PID)
+			if txn.Duration > group.Worst.Duration {
+				group.Worst = txn
+			}
+		}
+		group.MaxDuration = group.Worst.Duration
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// ConflictGroups groups the object conflicts of the report by object, lock modes and query
+// fingerprint of the waiters
+func (d *ReportData) ConflictGroups() []ConflictGroup {
+	var groups []ConflictGroup
+	for _, g := range groupByFingerprint(d.ObjectConflicts,
+		func(c ObjectConflict) string { return c.WaiterQuery },
+		func(c ObjectConflict) string {
+			return c.Database + "/" + c.Type + "/" + c.Object + "/" + c.HolderMode + "/" + c.WaiterMode
+		}) {
+		group := ConflictGroup{Fingerprint: g.fingerprint, Query: g.query, Count: len(g.items), Worst: g.items[0]}
+		for _, conflict := range g.items {
+			group.WaiterPIDs = appendPID(group.WaiterPIDs, conflict.WaiterPID)
+			group.HolderPIDs = appendPID(group.HolderPIDs, conflict.HolderPID)
+			if conflict.WaitTime > group.Worst.WaitTime {
+				group.Worst = conflict
+			}
+		}
+		group.MaxWaitTime = group.Worst.WaitTime
+		groups = append(groups, group)
+	}
+	return groups
+}
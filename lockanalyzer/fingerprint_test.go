@@ -0,0 +1,158 @@
+package lockanalyzer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestNormalizeQuery tests that running queries compare equal to their pg_stat_statements text
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query      string
+		normalized string
+	}{
+		{"SELECT * FROM models WHERE id = 42", "select * from models where id = ?"},
+		{"SELECT * FROM models WHERE id = $1", "select * from models where id = ?"},
+		{"UPDATE t1 SET name = 'it''s', price = 1.5\n\tWHERE id=3;", "update t1 set name = ?, price = ? where id=?"},
+		{"SELECT col2 FROM table_3", "select col2 from table_3"},
+		{"SELECT a - 1, b * -2.5 FROM t WHERE c IN (-1)", "select a - ?, b * ? from t where c in (?)"},
+		{"/* trace_id=42 */ SELECT 1 -- retry 3\nFROM \"Models2\"", "select ? from \"Models2\""},
+		{`SELECT E'it\'s', e'a\\', 'b' FROM t WHERE c = E'\\'`, "select ?, ?, ? from t where c = ?"},
+		{"SELECT $$it's$$, $fn$ a $$ b $fn$ FROM t WHERE x = $1", "select ?, ? from t where x = ?"},
+		{"SELECT $$unterminated", "select ?"},
+		{"SELECT 1e5, 1.5E-3, 2e+10, x FROM t", "select ?, ?, ?, x from t"},
+		{"SELECT B'101', X'1F', N'abc' FROM t", "select ?, ?, ? from t"},
+		{"SELECT col$1, price$ FROM type_e WHERE note='x'", "select col$1, price$ from type_e where note=?"},
+		{`SELECT U&'d\0061t''a', u&'b' UESCAPE '!', menu&'c' FROM t`, "select ?, ? uescape ?, menu&? from t"},
+		{"SELECT .5, -.25, t.col, x*.1e2 FROM t WHERE a-.5 > 0", "select ?, ?, t.col, x*? from t where a-? > ?"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeQuery(tt.query); got != tt.normalized {
+			t.Errorf("normalizeQuery(%q): expected %q, got: %q", tt.query, tt.normalized, got)
+		}
+	}
+}
+
+// TestQueryFingerprint tests that queries differing only by their constants share a fingerprint
+func TestQueryFingerprint(t *testing.T) {
+	fingerprint, normalized := queryFingerprint("UPDATE accounts SET balance = 120.5 WHERE id IN (1, 2, 3)")
+	if normalized != "update accounts set balance = ? where id in (...)" {
+		t.Errorf("Unexpected normalized query: %q", normalized)
+	}
+
+	same := []string{
+		"update accounts  SET balance = -3 WHERE id in (7)",
+		"UPDATE accounts SET balance = $1 WHERE id IN ($2, $3)",
+		"UPDATE accounts SET balance = 1.2e3 WHERE id IN (1)",
+		"UPDATE accounts SET balance = -.5 WHERE id IN (.1)",
+		`UPDATE accounts SET balance = U&'\0031' WHERE id IN (1)`,
+	}
+	for _, query := range same {
+		if other, _ := queryFingerprint(query); other != fingerprint {
+			t.Errorf("Expected %q to share the fingerprint %s, got: %s", query, fingerprint, other)
+		}
+	}
+	if other, _ := queryFingerprint("UPDATE orders SET balance = 1 WHERE id IN (1)"); other == fingerprint {
+		t.Error("Expected queries on different tables to have different fingerprints")
+	}
+
+	// The end of a string constant is found whatever its quoting
+	first, _ := queryFingerprint(`INSERT INTO notes VALUES (E'it\'s'), ($$a'b$$)`)
+	second, _ := queryFingerprint(`INSERT INTO notes VALUES (E'other'), ($tag$c$tag$)`)
+	if first != second {
+		t.Error("Expected queries differing by their escaped and dollar-quoted strings to share a fingerprint")
+	}
+}
+
+// TestBlockedTxnGroups tests that blocked transactions running the same query are grouped
+func TestBlockedTxnGroups(t *testing.T) {
+	data := &ReportData{
+		BlockedTxns: []BlockedTransaction{
+			{PID: 10, Database: "app", Duration: 3 * time.Second, Query: "UPDATE accounts SET balance = 10 WHERE id = 1"},
+			{PID: 11, Database: "app", Duration: 9 * time.Second, Query: "UPDATE accounts SET balance = 20 WHERE id = 2"},
+			{PID: 12, Database: "app", Duration: 5 * time.Second, Query: "DELETE FROM sessions WHERE id = 3"},
+			{PID: 13, Database: "billing", Duration: time.Second, Query: "UPDATE accounts SET balance = 30 WHERE id = 3"},
+			{PID: 14, Database: "app", Duration: 4 * time.Second, Query: "update accounts set balance = 40 where id = 4"},
+		},
+	}
+
+	groups := data.BlockedTxnGroups()
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got: %+v", groups)
+	}
+	accounts := groups[0]
+	if accounts.Count != 3 || !reflect.DeepEqual(accounts.PIDs, []int{10, 11, 14}) {
+		t.Errorf("Expected the updates of app to be grouped, got: %+v", accounts)
+	}
+	if accounts.MaxDuration != 9*time.Second || accounts.Worst.PID != 11 {
+		t.Errorf("Expected PID 11 to be the worst wait, got: %+v", accounts)
+	}
+	if accounts.Query != "update accounts set balance = ? where id = ?" {
+		t.Errorf("Unexpected group query: %q", accounts.Query)
+	}
+	if groups[2].Worst.Database != "billing" || groups[2].Fingerprint != accounts.Fingerprint {
+		t.Errorf("Expected the update of billing in its own group, got: %+v", groups[2])
+	}
+}
+
+// TestConflictGroups tests that conflicts of waiters running the same query on an object are grouped
+func TestConflictGroups(t *testing.T) {
+	data := &ReportData{
+		ObjectConflicts: []ObjectConflict{
+			{Database: "app", Object: "public.accounts", Type: "relation", HolderPID: 1, HolderMode: "AccessExclusiveLock",
+				WaiterPID: 10, WaiterMode: "RowExclusiveLock", WaiterQuery: "UPDATE accounts SET balance = 1", WaitTime: time.Second},
+			{Database: "app", Object: "public.accounts", Type: "relation", HolderPID: 1, HolderMode: "AccessExclusiveLock",
+				WaiterPID: 11, WaiterMode: "RowExclusiveLock", WaiterQuery: "UPDATE accounts SET balance = 2", WaitTime: 4 * time.Second},
+			{Database: "app", Object: "public.accounts", Type: "relation", HolderPID: 1, HolderMode: "AccessExclusiveLock",
+				WaiterPID: 12, WaiterMode: "AccessShareLock", WaiterQuery: "SELECT * FROM accounts", WaitTime: 2 * time.Second},
+		},
+	}
+
+	groups := data.ConflictGroups()
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got: %+v", groups)
+	}
+	if groups[0].Count != 2 || !reflect.DeepEqual(groups[0].WaiterPIDs, []int{10, 11}) || !reflect.DeepEqual(groups[0].HolderPIDs, []int{1}) {
+		t.Errorf("Expected the updates to be grouped, got: %+v", groups[0])
+	}
+	if groups[0].MaxWaitTime != 4*time.Second || groups[0].Worst.WaiterPID != 11 {
+		t.Errorf("Expected PID 11 to be the worst wait, got: %+v", groups[0])
+	}
+}
+
+// TestLongTxnGroupsJSON tests that the groups are part of the JSON report
+func TestLongTxnGroupsJSON(t *testing.T) {
+	data := &ReportData{
+		LongTxns: []LongTransaction{
+			{PID: 20, Duration: time.Minute, Query: "SELECT * FROM events WHERE day = '2024-01-01'"},
+			{PID: 21, Duration: 2 * time.Minute, Query: "SELECT * FROM events WHERE day = '2024-01-02'"},
+		},
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Error encoding report: %v", err)
+	}
+
+	var decoded struct {
+		LongTxnGroups []struct {
+			Count         int
+			PIDs          []int
+			MaxDurationMs int64
+		}
+		BlockedTxnGroups []BlockedTxnGroup
+		ConflictGroups   []ConflictGroup
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Error decoding report: %v", err)
+	}
+	if len(decoded.LongTxnGroups) != 1 || decoded.LongTxnGroups[0].Count != 2 || decoded.LongTxnGroups[0].MaxDurationMs != 120000 {
+		t.Errorf("Unexpected long transaction groups: %+v", decoded.LongTxnGroups)
+	}
+	if decoded.BlockedTxnGroups == nil || decoded.ConflictGroups == nil {
+		t.Errorf("Expected empty groups to be encoded as [], got: %s", encoded)
+	}
+}
@@ -0,0 +1,86 @@
+package lockanalyzer
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// IdleTransaction contains information about a session idle in transaction while holding locks.
+// Such a session keeps its locks until the application commits or rolls back, and is the most
+// common root cause of lock pile-ups.
+type IdleTransaction struct {
+	PID             int
+	Database        string
+	State           string
+	IdleTime        time.Duration
+	XactStart       time.Time
+	Username        string
+	ApplicationName string
+	Query           string
+	Locks           []LockInfo
+	BlockedSessions int
+}
+
+// Aborted reports whether the transaction failed and waits for a rollback
+func (t IdleTransaction) Aborted() bool {
+	return strings.Contains(t.State, "aborted")
+}
+
+// isIdleInTransaction reports whether the session state is "idle in transaction"
+// or "idle in transaction (aborted)"
+func isIdleInTransaction(state string) bool {
+	return strings.HasPrefix(state, "idle in transaction")
+}
+
+// detectIdleTransactions lists the sessions idle in transaction for at least threshold that hold locks,
+// the sessions blocking the most backends first. The idle time is measured at the report timestamp.
+func detectIdleTransactions(locks []LockInfo, graph *WaitGraph, timestamp time.Time, threshold time.Duration) []IdleTransaction {
+	var idleTxns []IdleTransaction
+	byPID := make(map[int]int)
+
+	for _, lock := range locks {
+		// Every transaction holds its own virtualxid, it is not a lock held on behalf of the application
+		if !lock.Granted || !isIdleInTransaction(lock.State) || lock.Type == "virtualxid" {
+			continue
+		}
+
+		var idleTime time.Duration
+		if !lock.StateChange.IsZero() && timestamp.After(lock.StateChange) {
+			idleTime = timestamp.Sub(lock.StateChange)
+		}
+		if idleTime < threshold {
+			continue
+		}
+
+		i, ok := byPID[lock.PID]
+		if !ok {
+			txn := IdleTransaction{
+				PID:             lock.PID,
+				Database:        lock.Database,
+				State:           lock.State,
+				XactStart:       lock.XactStart,
+				Username:        lock.Username,
+				ApplicationName: lock.ApplicationName,
+				Query:           lock.Query,
+				IdleTime:        idleTime,
+			}
+			if graph != nil {
+				txn.BlockedSessions = len(graph.TransitiveWaitersOf(lock.PID))
+			}
+			i = len(idleTxns)
+			byPID[lock.PID] = i
+			idleTxns = append(idleTxns, txn)
+		}
+		idleTxns[i].Locks = append(idleTxns[i].Locks, lock)
+	}
+
+	sort.SliceStable(idleTxns, func(i, j int) bool {
+		if idleTxns[i].BlockedSessions != idleTxns[j].BlockedSessions {
+			return idleTxns[i].BlockedSessions > idleTxns[j].BlockedSessions
+		}
+		return idleTxns[i].IdleTime > idleTxns[j].IdleTime
+	})
+
+	return idleTxns
+}
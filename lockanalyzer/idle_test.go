@@ -0,0 +1,74 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDetectIdleTransactions tests detection of sessions idle in transaction holding locks
+func TestDetectIdleTransactions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	locks := []LockInfo{
+		{PID: 1, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "public.models",
+			State: "idle in transaction", StateChange: now.Add(-30 * time.Second), ApplicationName: "api"},
+		{PID: 1, Mode: "ExclusiveLock", Granted: true, Type: "transactionid", TransactionID: "1234",
+			State: "idle in transaction", StateChange: now.Add(-30 * time.Second)},
+		{PID: 1, Mode: "ExclusiveLock", Granted: true, Type: "virtualxid", VirtualXID: "3/15",
+			State: "idle in transaction", StateChange: now.Add(-30 * time.Second)},
+		{PID: 2, Mode: "AccessShareLock", Granted: true, Type: "relation", Object: "public.files",
+			State: "idle in transaction (aborted)", StateChange: now.Add(-5 * time.Minute)},
+		{PID: 3, Mode: "ShareLock", Granted: false, Type: "transactionid", TransactionID: "1234", State: "active"},
+		{PID: 4, Mode: "ExclusiveLock", Granted: true, Type: "virtualxid", VirtualXID: "5/2", State: "idle in transaction"},
+		{PID: 5, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "public.models", State: "active"},
+	}
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 3, Blocker: 1},
+		{Waiter: 6, Blocker: 3},
+	})
+
+	idleTxns := detectIdleTransactions(locks, graph, now, 0)
+
+	if len(idleTxns) != 2 {
+		t.Fatalf("Expected 2 idle transactions, got: %d", len(idleTxns))
+	}
+
+	// The session blocking others comes first, even if idle for a shorter time
+	first := idleTxns[0]
+	if first.PID != 1 {
+		t.Fatalf("Expected PID 1 first, got: %d", first.PID)
+	}
+	if first.IdleTime != 30*time.Second {
+		t.Errorf("Expected idle time 30s, got: %v", first.IdleTime)
+	}
+	if first.BlockedSessions != 2 {
+		t.Errorf("Expected 2 blocked sessions (direct and transitive), got: %d", first.BlockedSessions)
+	}
+	if len(first.Locks) != 2 {
+		t.Errorf("Expected 2 locks held without the virtualxid, got: %d", len(first.Locks))
+	}
+	if first.Locks[1].Target() != "transaction 1234" {
+		t.Errorf("Expected target: transaction 1234, got: %s", first.Locks[1].Target())
+	}
+
+	second := idleTxns[1]
+	if second.PID != 2 || !second.Aborted() || second.BlockedSessions != 0 {
+		t.Errorf("Expected aborted PID 2 blocking nobody, got: %+v", second)
+	}
+}
+
+// TestDetectIdleTransactionsThreshold tests that sessions idle for less than the threshold are left out
+func TestDetectIdleTransactionsThreshold(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	locks := []LockInfo{
+		{PID: 1, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "public.models",
+			State: "idle in transaction", StateChange: now.Add(-2 * time.Second)},
+		{PID: 2, Mode: "RowExclusiveLock", Granted: true, Type: "relation", Object: "public.files",
+			State: "idle in transaction", StateChange: now.Add(-2 * time.Minute)},
+	}
+
+	idleTxns := detectIdleTransactions(locks, nil, now, time.Minute)
+
+	if len(idleTxns) != 1 || idleTxns[0].PID != 2 {
+		t.Errorf("Expected only PID 2 idle for more than a minute, got: %+v", idleTxns)
+	}
+}
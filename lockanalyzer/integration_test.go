@@ -3,10 +3,14 @@ package lockanalyzer
 import (
 	"context"
 	"database/sql"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
 // Models are now defined in models_test.go
@@ -291,3 +295,624 @@ func TestPerformanceWithLargeDataset(t *testing.T) {
 		t.Error("Total number of locks cannot be negative")
 	}
 }
+
+// TestSnapshotSurvivesCollectorTimeout tests that a timed out collector does not abort the snapshot
+func TestSnapshotSurvivesCollectorTimeout(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx := context.Background()
+	tx, timestamp, err := beginSnapshot(ctx, tdb.DB)
+	if err != nil {
+		t.Fatalf("Error opening snapshot: %v", err)
+	}
+	defer tx.Rollback()
+
+	if timestamp.IsZero() {
+		t.Error("Snapshot timestamp should be read from the server")
+	}
+
+	snapshot := &Snapshot{}
+	opts := AnalyzerOptions{QueryTimeout: 50 * time.Millisecond}
+
+	slow := collector{
+		name: "slow",
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+			_, err := db.ExecContext(ctx, "SELECT pg_sleep(2)")
+			return err
+		},
+	}
+	runCollector(ctx, tx, opts, snapshot, slow)
+
+	for _, c := range collectors {
+		runCollector(ctx, tx, DefaultAnalyzerOptions(), snapshot, c)
+	}
+
+	if len(snapshot.CollectorErrors) != 1 {
+		t.Fatalf("Expected only the slow collector to fail, got: %v", snapshot.CollectorErrors)
+	}
+	if !snapshot.CollectorErrors[0].TimedOut {
+		t.Error("Slow collector should be reported as timed out")
+	}
+	if snapshot.ServerVersion == 0 || len(snapshot.Activity) == 0 || len(snapshot.Databases) == 0 {
+		t.Errorf("Collectors following the timeout should return data, got: %+v", snapshot)
+	}
+}
+
+// TestGetLocksSessionDetails tests that locks carry the details of their session
+func TestGetLocksSessionDetails(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SET LOCAL application_name = 'lockanalyzer_session_test'"); err != nil {
+		t.Fatalf("Error setting application name: %v", err)
+	}
+	if _, err := tx.NewUpdate().Model(&Model{ID: "660e8400-e29b-41d4-a716-446655440001", State: "session_test"}).Column("state").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("Error during update: %v", err)
+	}
+
+	locks := analyzeDB(t, tdb.DB).Locks
+
+	found := false
+	for _, lock := range locks {
+		if lock.ApplicationName != "lockanalyzer_session_test" {
+			continue
+		}
+		found = true
+		if lock.Username == "" {
+			t.Error("Lock should carry the session user")
+		}
+		if lock.State != "idle in transaction" {
+			t.Errorf("Expected state: idle in transaction, got: %s", lock.State)
+		}
+		if lock.XactStart.IsZero() {
+			t.Error("Lock should carry the transaction start time")
+		}
+		if lock.Query == "" {
+			t.Error("Lock should carry the session query")
+		}
+	}
+
+	if !found {
+		t.Error("Locks of the test session should be reported with its application name")
+	}
+}
+
+// TestGetLocksAdvisoryKeys tests that advisory locks are reported with their decoded keys
+func TestGetLocksAdvisoryKeys(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(4294967298), pg_advisory_xact_lock(42, -7)"); err != nil {
+		t.Fatalf("Error taking advisory locks: %v", err)
+	}
+
+	locks := analyzeDB(t, tdb.DB).Locks
+
+	found := make(map[string]bool)
+	for _, lock := range detectAdvisoryLocks(locks) {
+		found[lock.Key.String()] = len(lock.Holders) > 0
+	}
+
+	for _, key := range []string{"4294967298", "42, -7"} {
+		if !found[key] {
+			t.Errorf("Advisory lock %s should be reported with a holder", key)
+		}
+	}
+}
+
+// TestSchemaQualifiedNames tests that relations are reported with their schema
+func TestSchemaQualifiedNames(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := analyzeDB(t, tdb.DB).IndexAnalysis
+	for _, index := range indexes {
+		if index.Schema == "" || !strings.HasPrefix(index.Table, index.Schema+".") {
+			t.Errorf("Index %s should be schema-qualified, got table: %s", index.Name, index.Table)
+		}
+	}
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.NewUpdate().Model(&Model{ID: "660e8400-e29b-41d4-a716-446655440001", State: "schema_test"}).Column("state").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("Error during update: %v", err)
+	}
+
+	locks := analyzeDB(t, tdb.DB).Locks
+
+	found := false
+	for _, lock := range locks {
+		if lock.Object == "public.models" {
+			found = true
+			if lock.Schema != "public" {
+				t.Errorf("Expected schema: public, got: %s", lock.Schema)
+			}
+		}
+	}
+	if !found {
+		t.Error("Lock on public.models should be reported with its schema")
+	}
+}
+
+// TestIdleTransactionHolder tests that a session idle in transaction holding locks is reported
+func TestIdleTransactionHolder(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SET LOCAL application_name = 'lockanalyzer_idle_test'"); err != nil {
+		t.Fatalf("Error setting application name: %v", err)
+	}
+	if _, err := tx.NewUpdate().Model(&Model{ID: "660e8400-e29b-41d4-a716-446655440001", State: "idle_test"}).Column("state").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("Error during update: %v", err)
+	}
+
+	data, err := GenerateLocksReportContext(ctx, tdb.DB, DefaultAnalyzerOptions())
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	for _, txn := range data.IdleTxns {
+		if txn.ApplicationName == "lockanalyzer_idle_test" {
+			if len(txn.Locks) == 0 {
+				t.Error("Idle transaction should list the locks it holds")
+			}
+			return
+		}
+	}
+	t.Error("Session idle in transaction should be reported")
+}
+
+// TestRowWaitResolution tests that a wait on the transaction ID of another session is resolved to the row
+func TestRowWaitResolution(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holder, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer holder.Rollback()
+
+	model := &Model{ID: "660e8400-e29b-41d4-a716-446655440001", State: "row_wait_holder"}
+	if _, err := holder.NewUpdate().Model(model).Column("state").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("Error during update: %v", err)
+	}
+
+	// The second update waits for the transaction of the first one
+	done := make(chan error, 1)
+	go func() {
+		_, err := tdb.DB.NewUpdate().Model(&Model{ID: model.ID, State: "row_wait_waiter"}).Column("state").WherePK().Exec(ctx)
+		done <- err
+	}()
+
+	var found *RowWait
+	for i := 0; i < 50 && found == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		data, err := GenerateLocksReportContext(ctx, tdb.DB, DefaultAnalyzerOptions())
+		if err != nil {
+			t.Fatalf("Error generating report: %v", err)
+		}
+		for _, txn := range data.BlockedTxns {
+			if txn.RowWait != nil {
+				found = txn.RowWait
+			}
+		}
+	}
+
+	holder.Rollback()
+	if err := <-done; err != nil {
+		t.Errorf("Error during waiting update: %v", err)
+	}
+
+	if found == nil {
+		t.Fatal("Row wait should be resolved")
+	}
+	if found.Table != "public.models" || found.Page == "" || found.Tuple == "" {
+		t.Errorf("Expected a row of public.models, got: %+v", found)
+	}
+	if found.HolderPID == 0 || !strings.Contains(found.HolderQuery, "row_wait_holder") {
+		t.Errorf("Expected the holder and its query, got: %+v", found)
+	}
+}
+
+// TestGetActivityBlockingPIDs tests that the blocking PIDs are only read for the sessions waiting
+// for a lock
+func TestGetActivityBlockingPIDs(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holder, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer holder.Rollback()
+
+	var holderPID int
+	if err := holder.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&holderPID); err != nil {
+		t.Fatalf("Error reading backend PID: %v", err)
+	}
+	model := &Model{ID: "660e8400-e29b-41d4-a716-446655440001", State: "blocking_pids_holder"}
+	if _, err := holder.NewUpdate().Model(model).Column("state").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("Error during update: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tdb.DB.NewUpdate().Model(&Model{ID: model.ID, State: "blocking_pids_waiter"}).Column("state").WherePK().Exec(ctx)
+		done <- err
+	}()
+
+	var activity []ActivityRow
+	waiting := false
+	for i := 0; i < 50 && !waiting; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if activity, err = getActivityRows(ctx, tdb.DB, capabilities{}); err != nil {
+			t.Fatalf("Error reading activity: %v", err)
+		}
+		for _, session := range activity {
+			waiting = waiting || containsPID(session.BlockingPIDs, holderPID)
+		}
+	}
+
+	holder.Rollback()
+	if err := <-done; err != nil {
+		t.Errorf("Error during waiting update: %v", err)
+	}
+
+	if !waiting {
+		t.Fatal("The waiting session should be blocked by the holder")
+	}
+	for _, session := range activity {
+		if session.WaitEventType != "Lock" && len(session.BlockingPIDs) > 0 {
+			t.Errorf("Session %d not waiting for a lock should have no blocking PIDs, got: %v", session.PID, session.BlockingPIDs)
+		}
+	}
+}
+
+// TestPgRowLocks tests that rows locked by SELECT ... FOR UPDATE are found with pgrowlocks
+func TestPgRowLocks(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var pid int
+	if err := tx.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+		t.Fatalf("Error reading backend PID: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM models WHERE id = '660e8400-e29b-41d4-a716-446655440001' FOR UPDATE"); err != nil {
+		t.Fatalf("Error locking row: %v", err)
+	}
+
+	// A missing table does not stop the scan of the next ones
+	opts := DefaultAnalyzerOptions()
+	opts.RowLockTables = []string{"missing_table", "models"}
+	data, err := GenerateLocksReportContext(ctx, tdb.DB, opts)
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+	for _, collectorError := range data.CollectorErrors {
+		if collectorError.Collector == "row_locks" {
+			if collectorError.Error == errPgRowLocksMissing.Error() {
+				t.Skip("pgrowlocks is not installed")
+			}
+			if collectorError.Error != "table missing_table does not exist" {
+				t.Fatalf("Error reading row locks: %s", collectorError.Error)
+			}
+		}
+	}
+
+	for _, rowLock := range data.RowLocks {
+		if rowLock.PID == pid && rowLock.Table == "public.models" && rowLock.Mode == "For Update" {
+			return
+		}
+	}
+	t.Errorf("Row locked FOR UPDATE by PID %d should be reported, got: %+v", pid, data.RowLocks)
+}
+
+// TestPredicateLocks tests that the predicate locks of a serializable transaction are reported
+func TestPredicateLocks(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// A sequential scan locks the whole relation
+	if _, err := tx.NewSelect().Model((*Model)(nil)).Count(ctx); err != nil {
+		t.Fatalf("Error during select: %v", err)
+	}
+
+	data, err := GenerateLocksReportContext(ctx, tdb.DB, DefaultAnalyzerOptions())
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	for _, relation := range data.SSI.Relations {
+		if relation.Relation == "public.models" {
+			if !relation.Escalated() || relation.Sessions != 1 {
+				t.Errorf("Expected a relation predicate lock held by one session, got: %+v", relation)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected predicate locks on public.models, got: %+v", data.SSI.Relations)
+}
+
+// TestPreparedTransactions tests that a prepared transaction is reported with its locks
+func TestPreparedTransactions(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var maxPrepared int
+	if err := tdb.DB.QueryRowContext(ctx, "SELECT current_setting('max_prepared_transactions')::int").Scan(&maxPrepared); err != nil {
+		t.Fatalf("Error reading max_prepared_transactions: %v", err)
+	}
+	if maxPrepared == 0 {
+		t.Skip("max_prepared_transactions is 0")
+	}
+
+	conn, err := tdb.DB.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Error opening connection: %v", err)
+	}
+	defer conn.Close()
+
+	const gid = "lockanalyzer-test"
+	for _, query := range []string{
+		"BEGIN",
+		"UPDATE models SET state = 'prepared' WHERE id = '660e8400-e29b-41d4-a716-446655440001'",
+		"PREPARE TRANSACTION '" + gid + "'",
+	} {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			t.Fatalf("Error running %s: %v", query, err)
+		}
+	}
+	defer tdb.DB.ExecContext(context.Background(), "ROLLBACK PREPARED '"+gid+"'")
+
+	opts := DefaultAnalyzerOptions()
+	opts.LongTransactionThreshold = 0
+	data, err := GenerateLocksReportContext(ctx, tdb.DB, opts)
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	for _, txn := range data.PreparedTxns {
+		if txn.GID != gid {
+			continue
+		}
+		for _, lock := range txn.Locks {
+			if lock.Object == "public.models" && lock.Mode == "RowExclusiveLock" {
+				return
+			}
+		}
+		t.Fatalf("Expected the RowExclusiveLock on public.models, got: %+v", txn.Locks)
+	}
+	t.Errorf("Prepared transaction %s should be reported, got: %+v", gid, data.PreparedTxns)
+}
+
+// TestBlockedVacuum tests that a manual VACUUM waiting for a table lock is reported
+func TestBlockedVacuum(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holder, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer holder.Rollback()
+
+	if _, err := holder.ExecContext(ctx, "LOCK TABLE models IN SHARE MODE"); err != nil {
+		t.Fatalf("Error locking table: %v", err)
+	}
+
+	// VACUUM cannot run in a transaction block, it runs on its own connection
+	done := make(chan error, 1)
+	go func() {
+		_, err := tdb.DB.ExecContext(ctx, "VACUUM models")
+		done <- err
+	}()
+
+	var found *VacuumConflict
+	for i := 0; i < 50 && found == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		data, err := GenerateLocksReportContext(ctx, tdb.DB, DefaultAnalyzerOptions())
+		if err != nil {
+			t.Fatalf("Error generating report: %v", err)
+		}
+		for _, conflict := range data.Vacuum.Blocked {
+			if conflict.Object == "public.models" {
+				found = &conflict
+			}
+		}
+	}
+
+	holder.Rollback()
+	if err := <-done; err != nil {
+		t.Errorf("Error during vacuum: %v", err)
+	}
+
+	if found == nil {
+		t.Fatal("Blocked vacuum should be reported")
+	}
+	if found.Vacuum.Auto || found.VacuumMode != "ShareUpdateExclusiveLock" || found.OtherMode != "ShareLock" {
+		t.Errorf("Expected a manual VACUUM waiting for the SHARE lock, got: %+v", found)
+	}
+}
+
+// TestDDLQueue tests that a query queued behind an ALTER TABLE waiting for its lock is reported
+func TestDDLQueue(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reader, err := tdb.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer reader.Rollback()
+
+	if _, err := reader.NewSelect().Model((*Model)(nil)).Count(ctx); err != nil {
+		t.Fatalf("Error during select: %v", err)
+	}
+
+	// The ALTER TABLE waits for the reader, then a read queues behind the ALTER TABLE
+	done := make(chan error, 2)
+	go func() {
+		_, err := tdb.DB.ExecContext(ctx, "ALTER TABLE models ADD COLUMN ddl_queue_test int")
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	go func() {
+		_, err := tdb.DB.NewSelect().Model((*Model)(nil)).Count(ctx)
+		done <- err
+	}()
+
+	var found *DDLQueue
+	for i := 0; i < 50 && found == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		data, err := GenerateLocksReportContext(ctx, tdb.DB, DefaultAnalyzerOptions())
+		if err != nil {
+			t.Fatalf("Error generating report: %v", err)
+		}
+		for _, queue := range data.DDLQueues {
+			if queue.Object == "public.models" {
+				found = &queue
+			}
+		}
+	}
+
+	reader.Rollback()
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Error during queued statement: %v", err)
+		}
+	}
+
+	if found == nil {
+		t.Fatal("DDL queue should be reported")
+	}
+	if found.DDL.Mode != "AccessExclusiveLock" || len(found.Holders) != 1 || len(found.Queued) != 1 {
+		t.Errorf("Expected the ALTER TABLE with one holder and one queued read, got: %+v", found)
+	}
+}
+
+// TestOtherDatabaseLocks tests that a relation locked in another database is resolved through
+// a connection to that database
+func TestOtherDatabaseLocks(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	connect := func(ctx context.Context, database string) (*bun.DB, error) {
+		u, err := url.Parse(testDSN())
+		if err != nil {
+			return nil, err
+		}
+		u.Path = "/" + database
+		sqldb, err := sql.Open("postgres", u.String())
+		if err != nil {
+			return nil, err
+		}
+		return bun.NewDB(sqldb, pgdialect.New()), nil
+	}
+
+	other, err := connect(ctx, "postgres")
+	if err != nil {
+		t.Fatalf("Error opening the postgres database: %v", err)
+	}
+	defer other.Close()
+
+	tx, err := other.BeginTx(ctx, nil)
+	if err != nil {
+		t.Skipf("Cannot connect to the postgres database: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE lockanalyzer_other_db (id int) ON COMMIT DROP"); err != nil {
+		t.Fatalf("Error creating table: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE lockanalyzer_other_db IN SHARE MODE"); err != nil {
+		t.Fatalf("Error locking table: %v", err)
+	}
+
+	opts := DefaultAnalyzerOptions()
+	opts.Databases = []string{"postgres"}
+	data, err := GenerateReport(ctx, NewClusterSource(tdb.DB, connect), opts)
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	for _, lock := range data.Locks {
+		if lock.Mode == "ShareLock" && strings.HasSuffix(lock.Object, ".lockanalyzer_other_db") {
+			if lock.Database != "postgres" {
+				t.Errorf("Expected the lock in database postgres, got: %q", lock.Database)
+			}
+			return
+		}
+	}
+	t.Errorf("Lock of the postgres database should be resolved, collector errors: %+v", data.CollectorErrors)
+}
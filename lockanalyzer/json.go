@@ -0,0 +1,297 @@
+package lockanalyzer
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Durations are encoded in nanoseconds like any time.Duration, along with a milliseconds field
+// (e.g. WaitTimeMs next to WaitTime) so that consumers do not have to convert them.
+
+// milliseconds returns a duration in whole milliseconds
+func milliseconds(d time.Duration) int64 {
+	return d.Milliseconds()
+}
+
+// MarshalJSON encodes the lock with its wait time in milliseconds
+func (l LockInfo) MarshalJSON() ([]byte, error) {
+	type lockInfo LockInfo
+	return json.Marshal(struct {
+		lockInfo
+		WaitTimeMs int64
+	}{lockInfo(l), milliseconds(l.WaitTime)})
+}
+
+// MarshalJSON encodes the blocked transaction with its duration in milliseconds
+func (t BlockedTransaction) MarshalJSON() ([]byte, error) {
+	type blockedTransaction BlockedTransaction
+	return json.Marshal(struct {
+		blockedTransaction
+		DurationMs int64
+	}{blockedTransaction(t), milliseconds(t.Duration)})
+}
+
+// MarshalJSON encodes the long transaction with its duration in milliseconds
+func (t LongTransaction) MarshalJSON() ([]byte, error) {
+	type longTransaction LongTransaction
+	return json.Marshal(struct {
+		longTransaction
+		DurationMs int64
+	}{longTransaction(t), milliseconds(t.Duration)})
+}
+
+// MarshalJSON encodes the object conflict with the wait time of the waiter in milliseconds
+func (c ObjectConflict) MarshalJSON() ([]byte, error) {
+	type objectConflict ObjectConflict
+	return json.Marshal(struct {
+		objectConflict
+		WaitTimeMs int64
+	}{objectConflict(c), milliseconds(c.WaitTime)})
+}
+
+// MarshalJSON encodes the idle transaction with its idle time in milliseconds
+func (t IdleTransaction) MarshalJSON() ([]byte, error) {
+	type idleTransaction IdleTransaction
+	return json.Marshal(struct {
+		idleTransaction
+		IdleTimeMs int64
+	}{idleTransaction(t), milliseconds(t.IdleTime)})
+}
+
+// MarshalJSON encodes the prepared transaction with its age in milliseconds and its remediation
+func (t PreparedTransaction) MarshalJSON() ([]byte, error) {
+	type preparedTransaction PreparedTransaction
+	txn := preparedTransaction(t)
+	txn.Locks = emptyIfNil(txn.Locks)
+	return json.Marshal(struct {
+		preparedTransaction
+		AgeMs       int64
+		Remediation string
+	}{txn, milliseconds(t.Age), t.Remediation()})
+}
+
+// MarshalJSON encodes the advisory lock session with its wait time in milliseconds
+func (s AdvisoryLockSession) MarshalJSON() ([]byte, error) {
+	type advisoryLockSession AdvisoryLockSession
+	return json.Marshal(struct {
+		advisoryLockSession
+		WaitTimeMs int64
+	}{advisoryLockSession(s), milliseconds(s.WaitTime)})
+}
+
+// MarshalJSON encodes the statement statistics with their times in milliseconds
+func (s StatementStats) MarshalJSON() ([]byte, error) {
+	type statementStats StatementStats
+	return json.Marshal(struct {
+		statementStats
+		TotalTimeMs int64
+		MeanTimeMs  int64
+	}{statementStats(s), milliseconds(s.TotalTime), milliseconds(s.MeanTime)})
+}
+
+// MarshalJSON encodes the blocking tree node with its wait time in milliseconds
+func (n BlockingNode) MarshalJSON() ([]byte, error) {
+	type blockingNode BlockingNode
+	node := blockingNode(n)
+	node.Waiters = emptyIfNil(node.Waiters)
+	return json.Marshal(struct {
+		blockingNode
+		WaitTimeMs int64
+	}{node, milliseconds(n.WaitTime)})
+}
+
+// MarshalJSON encodes the blocking tree with its total wait time in milliseconds
+func (t BlockingTree) MarshalJSON() ([]byte, error) {
+	type blockingTree BlockingTree
+	return json.Marshal(struct {
+		blockingTree
+		TotalWaitTimeMs int64
+	}{blockingTree(t), milliseconds(t.TotalWaitTime)})
+}
+
+// MarshalJSON encodes the DDL queue with its recommendation
+func (q DDLQueue) MarshalJSON() ([]byte, error) {
+	type ddlQueue DDLQueue
+	queue := ddlQueue(q)
+	queue.Holders = emptyIfNil(queue.Holders)
+	queue.Queued = emptyIfNil(queue.Queued)
+	return json.Marshal(struct {
+		ddlQueue
+		Recommendation string
+	}{queue, q.Recommendation()})
+}
+
+// MarshalJSON encodes the DDL queue holder with its transaction age in milliseconds
+func (h DDLQueueHolder) MarshalJSON() ([]byte, error) {
+	type ddlQueueHolder DDLQueueHolder
+	return json.Marshal(struct {
+		ddlQueueHolder
+		TransactionAgeMs int64
+	}{ddlQueueHolder(h), milliseconds(h.TransactionAge)})
+}
+
+// MarshalJSON encodes the root blocker with its total wait time in milliseconds
+func (b RootBlocker) MarshalJSON() ([]byte, error) {
+	type rootBlocker RootBlocker
+	return json.Marshal(struct {
+		rootBlocker
+		TotalWaitTimeMs int64
+	}{rootBlocker(b), milliseconds(b.TotalWaitTime)})
+}
+
+// MarshalJSON encodes the vacuum with its kind
+func (v VacuumInfo) MarshalJSON() ([]byte, error) {
+	type vacuumInfo VacuumInfo
+	return json.Marshal(struct {
+		vacuumInfo
+		Kind string
+	}{vacuumInfo(v), v.Kind()})
+}
+
+// MarshalJSON encodes the vacuum conflict with its wait time in milliseconds
+func (c VacuumConflict) MarshalJSON() ([]byte, error) {
+	type vacuumConflict VacuumConflict
+	return json.Marshal(struct {
+		vacuumConflict
+		WaitTimeMs int64
+	}{vacuumConflict(c), milliseconds(c.WaitTime)})
+}
+
+// MarshalJSON encodes the vacuum report with both lists present
+func (r VacuumReport) MarshalJSON() ([]byte, error) {
+	type vacuumReport VacuumReport
+	report := vacuumReport(r)
+	report.Blocking = emptyIfNil(report.Blocking)
+	report.Blocked = emptyIfNil(report.Blocked)
+	return json.Marshal(report)
+}
+
+// MarshalJSON encodes the recovery conflicts with their total
+func (c RecoveryConflicts) MarshalJSON() ([]byte, error) {
+	type recoveryConflicts RecoveryConflicts
+	return json.Marshal(struct {
+		recoveryConflicts
+		Total int64
+	}{recoveryConflicts(c), c.Total()})
+}
+
+// MarshalJSON encodes the replay waiter with its wait time in milliseconds
+func (w ReplayWaiter) MarshalJSON() ([]byte, error) {
+	type replayWaiter ReplayWaiter
+	return json.Marshal(struct {
+		replayWaiter
+		WaitTimeMs int64
+	}{replayWaiter(w), milliseconds(w.WaitTime)})
+}
+
+// MarshalJSON encodes the standby report with its durations in milliseconds
+func (r StandbyReport) MarshalJSON() ([]byte, error) {
+	type standbyReport StandbyReport
+	report := standbyReport(r)
+	report.Conflicts = emptyIfNil(report.Conflicts)
+	report.Deltas = emptyIfNil(report.Deltas)
+	report.ReplayWaiters = emptyIfNil(report.ReplayWaiters)
+	return json.Marshal(struct {
+		standbyReport
+		ReplayLagMs      int64
+		SampleIntervalMs int64
+	}{report, milliseconds(r.ReplayLag), milliseconds(r.SampleInterval)})
+}
+
+// MarshalJSON encodes the predicate locks of a relation with their granularity
+func (p PredicateLockInfo) MarshalJSON() ([]byte, error) {
+	type predicateLockInfo PredicateLockInfo
+	return json.Marshal(struct {
+		predicateLockInfo
+		Granularity string
+		Escalated   bool
+	}{predicateLockInfo(p), p.Granularity(), p.Escalated()})
+}
+
+// MarshalJSON encodes the SSI report with its rollback ratio
+func (r SSIReport) MarshalJSON() ([]byte, error) {
+	type ssiReport SSIReport
+	report := ssiReport(r)
+	report.Relations = emptyIfNil(report.Relations)
+	return json.Marshal(struct {
+		ssiReport
+		RollbackRatio float64
+	}{report, r.RollbackRatio()})
+}
+
+// MarshalJSON encodes the blocked transaction group with its longest wait in milliseconds
+func (g BlockedTxnGroup) MarshalJSON() ([]byte, error) {
+	type blockedTxnGroup BlockedTxnGroup
+	return json.Marshal(struct {
+		blockedTxnGroup
+		MaxDurationMs int64
+	}{blockedTxnGroup(g), milliseconds(g.MaxDuration)})
+}
+
+// MarshalJSON encodes the long transaction group with its longest duration in milliseconds
+func (g LongTxnGroup) MarshalJSON() ([]byte, error) {
+	type longTxnGroup LongTxnGroup
+	return json.Marshal(struct {
+		longTxnGroup
+		MaxDurationMs int64
+	}{longTxnGroup(g), milliseconds(g.MaxDuration)})
+}
+
+// MarshalJSON encodes the conflict group with its longest wait in milliseconds
+func (g ConflictGroup) MarshalJSON() ([]byte, error) {
+	type conflictGroup ConflictGroup
+	return json.Marshal(struct {
+		conflictGroup
+		MaxWaitTimeMs int64
+	}{conflictGroup(g), milliseconds(g.MaxWaitTime)})
+}
+
+// MarshalJSON encodes the report with every list present, empty lists being encoded as []
+// rather than null, so that the JSON document always has the same shape, along with the groups
+// of blocked transactions, long transactions and object conflicts by query fingerprint
+func (d ReportData) MarshalJSON() ([]byte, error) {
+	type reportData ReportData
+	data := reportData(d)
+
+	if data.WaitGraph == nil {
+		data.WaitGraph = NewWaitGraph(nil)
+	}
+	if data.WaitGraph.Nodes == nil || data.WaitGraph.Edges == nil {
+		graph := *data.WaitGraph
+		graph.Nodes = emptyIfNil(graph.Nodes)
+		graph.Edges = emptyIfNil(graph.Edges)
+		data.WaitGraph = &graph
+	}
+	data.Locks = emptyIfNil(data.Locks)
+	data.RowLocks = emptyIfNil(data.RowLocks)
+	data.Deadlocks = emptyIfNil(data.Deadlocks)
+	data.BlockingTrees = emptyIfNil(data.BlockingTrees)
+	data.DDLQueues = emptyIfNil(data.DDLQueues)
+	data.BlockingChains = emptyIfNil(data.BlockingChains)
+	data.BlockedTxns = emptyIfNil(data.BlockedTxns)
+	data.LongTxns = emptyIfNil(data.LongTxns)
+	data.IdleTxns = emptyIfNil(data.IdleTxns)
+	data.PreparedTxns = emptyIfNil(data.PreparedTxns)
+	data.ObjectConflicts = emptyIfNil(data.ObjectConflicts)
+	data.AdvisoryLocks = emptyIfNil(data.AdvisoryLocks)
+	data.IndexAnalysis = emptyIfNil(data.IndexAnalysis)
+	data.Suggestions = emptyIfNil(data.Suggestions)
+	data.CollectorErrors = emptyIfNil(data.CollectorErrors)
+	data.Statements = emptyIfNil(data.Statements)
+	data.UnsupportedFeatures = emptyIfNil(data.UnsupportedFeatures)
+
+	return json.Marshal(struct {
+		reportData
+		BlockedTxnGroups []BlockedTxnGroup
+		LongTxnGroups    []LongTxnGroup
+		ConflictGroups   []ConflictGroup
+	}{data, emptyIfNil(d.BlockedTxnGroups()), emptyIfNil(d.LongTxnGroups()), emptyIfNil(d.ConflictGroups())})
+}
+
+// emptyIfNil returns an empty slice instead of a nil one
+func emptyIfNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
@@ -0,0 +1,86 @@
+package lockanalyzer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestReportDataJSON tests the typed fields and the stable shape of the JSON report
+func TestReportDataJSON(t *testing.T) {
+	data := &ReportData{
+		Timestamp: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Locks: []LockInfo{
+			{PID: 2, Mode: "ShareLock", Granted: false, WaitTime: 1500 * time.Millisecond},
+		},
+		BlockedTxns: []BlockedTransaction{
+			{PID: 2, Duration: 1500 * time.Millisecond, BlockingPIDs: []int{1}},
+		},
+		LongTxns: []LongTransaction{
+			{PID: 3, Duration: 7123 * time.Millisecond, QueryStart: time.Date(2024, 1, 1, 11, 59, 52, 877000000, time.UTC)},
+		},
+		ObjectConflicts: []ObjectConflict{
+			{Object: "public.projects", HolderPID: 1, WaiterPID: 2},
+		},
+		BlockingChains: []BlockingChain{
+			{PIDs: []int{2, 1}, Database: "shop"},
+		},
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Error encoding report: %v", err)
+	}
+
+	var decoded struct {
+		Timestamp   time.Time
+		Locks       []map[string]interface{}
+		BlockedTxns []map[string]interface{}
+		LongTxns    []map[string]interface{}
+		Deadlocks   []interface{}
+		RowLocks    []interface{}
+		WaitGraph   struct {
+			Nodes []int
+			Edges []WaitEdge
+		}
+		ObjectConflicts []struct{ HolderPID, WaiterPID int }
+		BlockingChains  []map[string]interface{}
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Error decoding report: %v", err)
+	}
+
+	if decoded.Locks[0]["WaitTimeMs"] != float64(1500) {
+		t.Errorf("Expected WaitTimeMs 1500, got: %v", decoded.Locks[0]["WaitTimeMs"])
+	}
+	if decoded.BlockedTxns[0]["PID"] != float64(2) || decoded.BlockedTxns[0]["DurationMs"] != float64(1500) {
+		t.Errorf("Expected PID 2 blocked for 1500ms, got: %v", decoded.BlockedTxns[0])
+	}
+	if decoded.LongTxns[0]["DurationMs"] != float64(7123) {
+		t.Errorf("Expected DurationMs 7123, got: %v", decoded.LongTxns[0]["DurationMs"])
+	}
+	if decoded.LongTxns[0]["QueryStart"] != "2024-01-01T11:59:52.877Z" {
+		t.Errorf("Expected RFC 3339 query start, got: %v", decoded.LongTxns[0]["QueryStart"])
+	}
+	if decoded.ObjectConflicts[0].HolderPID != 1 || decoded.ObjectConflicts[0].WaiterPID != 2 {
+		t.Errorf("Expected numeric PIDs, got: %+v", decoded.ObjectConflicts[0])
+	}
+
+	if decoded.BlockingChains[0]["Database"] != "shop" {
+		t.Errorf("Expected the database of the blocking chain, got: %v", decoded.BlockingChains[0])
+	}
+
+	// Empty lists are encoded as [] rather than null
+	if decoded.Deadlocks == nil || decoded.RowLocks == nil || decoded.WaitGraph.Nodes == nil || decoded.WaitGraph.Edges == nil {
+		t.Errorf("Empty lists should be encoded as []: %s", encoded)
+	}
+
+	// The report can be decoded back into its own types
+	var report ReportData
+	if err := json.Unmarshal(encoded, &report); err != nil {
+		t.Fatalf("Error decoding report data: %v", err)
+	}
+	if report.BlockedTxns[0].Duration != 1500*time.Millisecond || report.LongTxns[0].PID != 3 {
+		t.Errorf("Decoded report does not match, got: %+v", report)
+	}
+}
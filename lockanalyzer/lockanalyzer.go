@@ -5,101 +5,239 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/pbouamriou/lock-analyzer/lockmodes"
+
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
-// LockInfo contains detailed information about a lock
+// LockInfo contains detailed information about a lock and the session holding or waiting for it
 type LockInfo struct {
-	PID           int
-	Mode          string
-	Granted       bool
+	PID     int
+	Mode    string
+	Granted bool
+	// Database is the database of the locked object, or the one of the session for the objects
+	// shared by the whole server (transaction IDs, shared catalogs)
+	Database string
+	// DatabaseOID is the OID of the database of the locked object, 0 for shared objects
+	DatabaseOID   uint32
 	ObjectType    string
+	Schema        string
 	ObjectName    string
 	Page          string
 	Tuple         string
 	VirtualXID    string
 	TransactionID string
+	ClassID       uint32
+	ObjID         uint32
+	ObjSubID      int
+	WaitStart     time.Time
 	WaitTime      time.Duration
 	Query         string
 	Type          string
 	Object        string
+	// RowWait is the row waited for by a transactionid or tuple lock that is not granted
+	RowWait *RowWait
+	// Vacuum is set when the backend runs VACUUM, manually or as an autovacuum worker
+	Vacuum *VacuumInfo
+	// PreparedTransactionID is the transaction ID of the prepared transaction holding the lock,
+	// PID being 0
+	PreparedTransactionID string
+	// PreparedGID is the global identifier given to that prepared transaction
+	PreparedGID string
+
+	// Session details from pg_stat_activity
+	Username        string
+	ApplicationName string
+	ClientAddr      string
+	BackendType     string
+	State           string
+	XactStart       time.Time
+	QueryStart      time.Time
+	StateChange     time.Time
+	WaitEventType   string
+	WaitEvent       string
+}
+
+// Target returns a readable description of the object the lock is taken on,
+// or of the row waited for when a transaction ID or tuple wait could be resolved
+func (l LockInfo) Target() string {
+	switch {
+	case l.RowWait != nil:
+		return l.RowWait.String()
+	case l.TransactionID != "":
+		return "transaction " + l.TransactionID
+	case l.VirtualXID != "":
+		return "virtual transaction " + l.VirtualXID
+	case l.Tuple != "":
+		return fmt.Sprintf("%s (%s,%s)", l.Object, l.Page, l.Tuple)
+	case l.Page != "":
+		return fmt.Sprintf("%s (page %s)", l.Object, l.Page)
+	case l.Object != "" && l.Object != "N/A":
+		return l.Object
+	default:
+		return l.Type
+	}
 }
 
 // RowLockInfo contains information about row locks
 type RowLockInfo struct {
-	PID     int
-	Table   string
-	Page    string
-	Tuple   string
-	Mode    string
-	Granted bool
+	PID      int
+	Database string
+	Schema   string
+	Table    string
+	Page     string
+	Tuple    string
+	Mode     string
+	Granted  bool
+	// TransactionID is the transaction locking the row, set for the tables scanned with pgrowlocks
+	TransactionID string
+	// MultiXactID is set when the row is locked by several transactions (e.g. FOR SHARE by two sessions)
+	MultiXactID string
+	// BlockedModes are the row lock requests waiting for this lock (e.g. FOR KEY SHARE, taken by the
+	// foreign key checks of the rows referencing it), set for the tables scanned with pgrowlocks
+	BlockedModes []string
 }
 
 // BlockedTransaction contains information about a blocked transaction
 type BlockedTransaction struct {
-	PID       string
-	Duration  string
-	Query     string
-	WaitEvent string
+	PID          int
+	Database     string
+	Duration     time.Duration
+	BlockingPIDs []int
+	Query        string
+	WaitEvent    string
+	// RowWait is the row waited for, when the wait is on a transaction ID or a tuple
+	RowWait *RowWait
+	// Statement is the pg_stat_statements entry of the query, nil when unknown
+	Statement *StatementStats
 }
 
 // LongTransaction contains information about a long transaction
 type LongTransaction struct {
-	PID      string
-	Duration string
-	Query    string
+	PID        int
+	Database   string
+	Duration   time.Duration
+	QueryStart time.Time
+	Query      string
 }
 
-// ObjectConflict contains information about an object conflict
+// ObjectConflict is a lock waiting for an object locked by another backend in a conflicting mode
 type ObjectConflict struct {
-	Object         string
-	PIDs           []string
-	Mode           string
+	Database   string
+	Schema     string
+	Object     string
+	Type       string
+	HolderPID  int
+	HolderMode string
+	WaiterPID  int
+	WaiterMode string
+	// WaiterQuery is the query of the waiter, waiting for WaitTime
+	WaiterQuery    string
+	WaitTime       time.Duration
 	Recommendation string
 }
 
 // IndexInfo contains information about an index
 type IndexInfo struct {
-	Name  string
-	Table string
-	Size  string
-	Usage string
+	// Database is the database the report was taken from, indexes are not read from other databases
+	Database string
+	Schema   string
+	Name     string
+	Table    string
+	Size     string
+	Usage    string
 }
 
-// DeadlockInfo contains information about a potential deadlock
+// DeadlockParticipant contains information about a backend taking part in a deadlock cycle
+type DeadlockParticipant struct {
+	PID         int
+	Database    string
+	HeldLock    LockInfo
+	WaitingLock LockInfo
+	Query       string
+}
+
+// DeadlockInfo contains information about a deadlock in progress.
+// Each participant waits for a lock held by the next one, and the last one waits for the first.
+// When the sessions form several intertwined cycles, the participants are one of them.
 type DeadlockInfo struct {
-	Transaction1   LockInfo
-	Transaction2   LockInfo
+	Participants   []DeadlockParticipant
 	ConflictType   string
 	Recommendation string
 }
 
+// BlockingChain contains backends waiting for each other without forming a cycle.
+// The first PID is the waiter and the last one is the head of the chain.
+type BlockingChain struct {
+	PIDs []int
+	// Database is the database of the head of the chain
+	Database string
+}
+
 // ReportData contains all data needed to generate a report
 type ReportData struct {
 	Timestamp       time.Time
 	Locks           []LockInfo
+	WaitGraph       *WaitGraph
 	RowLocks        []RowLockInfo
 	Deadlocks       []DeadlockInfo
+	BlockingTrees   []BlockingTree
+	DDLQueues       []DDLQueue
+	BlockingChains  []BlockingChain
 	BlockedTxns     []BlockedTransaction
 	LongTxns        []LongTransaction
+	IdleTxns        []IdleTransaction
+	PreparedTxns    []PreparedTransaction
 	ObjectConflicts []ObjectConflict
+	AdvisoryLocks   []AdvisoryLockInfo
+	Vacuum          VacuumReport
+	SSI             SSIReport
+	// Standby describes the recovery conflicts when the server is a hot standby, nil otherwise
+	Standby         *StandbyReport
 	IndexAnalysis   []IndexInfo
 	Suggestions     []string
 	Summary         ReportSummary
+	CollectorErrors []CollectorError
+	// ServerVersion is the version of the server the snapshot was taken from (e.g. "14.5"), empty when unknown
+	ServerVersion string
+	// Statements are the statements run by the blocking and blocked sessions, from pg_stat_statements
+	Statements []LockStatement
+	// UnsupportedFeatures lists the features the server is too old for, whose data is missing from the report
+	UnsupportedFeatures []UnsupportedFeature
 }
 
 // ReportSummary contains a summary of detected issues
 type ReportSummary struct {
-	TotalLocks      int
-	BlockedTxns     int
-	LongTxns        int
-	Deadlocks       int
+	// TopRootBlocker is the session at the head of the largest blocking tree, nil when no session is blocked
+	TopRootBlocker *RootBlocker
+	RootBlockers   int
+	TotalLocks     int
+	BlockedTxns    int
+	LongTxns       int
+	IdleTxns       int
+	PreparedTxns   int
+	Deadlocks      int
+	// DDLQueues is the number of DDL statements with sessions queued behind their lock request
+	DDLQueues       int
+	BlockingChains  int
 	ObjectConflicts int
-	CriticalIssues  int
-	Warnings        int
-	Recommendations int
+	AdvisoryLocks   int
+	// VacuumConflicts is the number of lock conflicts between vacuums and other sessions
+	VacuumConflicts int
+	// RecoveryConflicts is the number of queries cancelled by recovery conflicts while the report was taken
+	RecoveryConflicts int
+	// ReplayWaiters is the number of sessions waiting for locks held by the WAL replay
+	ReplayWaiters int
+	// EscalatedPredicateLocks is the number of relations locked as a whole by serializable transactions
+	EscalatedPredicateLocks int
+	CriticalIssues          int
+	Warnings                int
+	Recommendations         int
 }
 
 // LockReportFormatter defines the interface for report formatters
@@ -110,6 +248,15 @@ type LockReportFormatter interface {
 
 // DetectBlockedTransactions detects blocked transactions in real-time
 func DetectBlockedTransactions(db *bun.DB) []string {
+	blockedQueries, err := DetectBlockedTransactionsContext(context.Background(), db)
+	if err != nil {
+		return []string{fmt.Sprintf("Error detecting blocked transactions: %v", err)}
+	}
+	return blockedQueries
+}
+
+// DetectBlockedTransactionsContext detects blocked transactions in real-time, honoring the context
+func DetectBlockedTransactionsContext(ctx context.Context, db bun.IDB) ([]string, error) {
 	var blockedQueries []string
 
 	query := `
@@ -126,9 +273,9 @@ func DetectBlockedTransactions(db *bun.DB) []string {
 		ORDER BY duration DESC
 	`
 
-	rows, err := db.QueryContext(context.Background(), query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return []string{fmt.Sprintf("Error detecting blocked transactions: %v", err)}
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -144,82 +291,155 @@ func DetectBlockedTransactions(db *bun.DB) []string {
 			pid, duration, queryText, waitEventType, waitEvent))
 	}
 
-	return blockedQueries
+	return blockedQueries, rows.Err()
 }
 
-// GenerateLocksReport generates a complete locks report and returns the data
-func GenerateLocksReport(db *bun.DB) (*ReportData, error) {
-	// Collect all data
-	data := &ReportData{
-		Timestamp: time.Now(),
+// GenerateLocksReport generates a complete locks report and returns the data.
+// The report uses the given options, or DefaultAnalyzerOptions() when none is passed.
+func GenerateLocksReport(db *bun.DB, opts ...AnalyzerOptions) (*ReportData, error) {
+	options := DefaultAnalyzerOptions()
+	if len(opts) > 0 {
+		options = opts[0]
 	}
+	return GenerateLocksReportContext(context.Background(), db, options)
+}
 
-	// Retrieve locks
-	locks, err := getLocks(db)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving locks: %v", err)
+// GenerateLocksReportContext generates a complete locks report from the live database, honoring the
+// context cancellation and running each collector within opts.QueryTimeout (see PostgresSource).
+// Collectors that fail or time out are listed in ReportData.CollectorErrors and the report is built
+// from the data that could be retrieved. The returned error is set when the options are invalid, or
+// when the context itself is done, along with the partial report.
+func GenerateLocksReportContext(ctx context.Context, db bun.IDB, opts AnalyzerOptions) (*ReportData, error) {
+	return GenerateReport(ctx, NewPostgresSource(db), opts)
+}
+
+// GenerateReport takes a snapshot from the source and analyzes it
+func GenerateReport(ctx context.Context, source Source, opts AnalyzerOptions) (*ReportData, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
 	}
-	data.Locks = locks
 
-	// Retrieve row locks
-	rowLocks, err := getRowLocks(db)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving row locks: %v", err)
+	snapshot, err := source.Snapshot(ctx, opts)
+	if snapshot == nil {
+		return nil, err
+	}
+
+	return Analyze(snapshot, opts), err
+}
+
+// Analyze builds the report of a snapshot. It does not access the database, so that snapshots
+// taken elsewhere or saved to a file can be analyzed. Objects of the schemas out of the opts scope
+// are left out.
+func Analyze(snapshot *Snapshot, opts AnalyzerOptions) *ReportData {
+	data := &ReportData{
+		Timestamp:           snapshot.Timestamp,
+		CollectorErrors:     snapshot.CollectorErrors,
+		ServerVersion:       versionName(snapshot.ServerVersion),
+		UnsupportedFeatures: unsupportedFeatures(snapshot),
 	}
-	data.RowLocks = rowLocks
+
+	// Build the collected data
+	data.Locks = buildLocks(snapshot)
+	data.WaitGraph = buildWaitGraph(snapshot.Activity, data.Locks)
+	data.RowLocks = buildRowLocks(data.Locks, snapshot)
+	data.IndexAnalysis = buildIndexes(snapshot.Indexes, snapshot.Databases)
+
+	// Keep the schemas in scope
+	filterSchemas(data, opts)
+
+	// Analyze long transactions
+	data.LongTxns = detectLongTransactions(snapshot.Activity, snapshot.Timestamp, opts.LongTransactionThreshold)
 
 	// Analyze deadlocks
-	deadlocks := detectDeadlocks(locks)
+	deadlocks := detectDeadlocks(data.WaitGraph, data.Locks)
 	data.Deadlocks = deadlocks
 
+	// Analyze blocking trees
+	data.BlockingTrees = detectBlockingTrees(data.WaitGraph, data.Locks)
+
+	// Analyze DDL lock queues
+	data.DDLQueues = detectDDLQueues(data.Locks, data.Timestamp)
+
+	// Analyze blocking chains
+	blockingChains := detectBlockingChains(data.WaitGraph, data.Locks, snapshot.Activity)
+	data.BlockingChains = blockingChains
+
 	// Analyze blocked transactions
-	blockedTxns := detectBlockedTransactions(locks)
+	blockedTxns := detectBlockedTransactions(data.Locks, data.WaitGraph, opts.LongWaitThreshold)
 	data.BlockedTxns = blockedTxns
 
-	// Analyze long transactions
-	longTxns := detectLongTransactions(db)
-	data.LongTxns = longTxns
+	// Link the blocking and blocked sessions to their statement
+	data.Statements = correlateStatements(data, snapshot)
+
+	// Analyze sessions idle in transaction holding locks
+	data.IdleTxns = detectIdleTransactions(data.Locks, data.WaitGraph, data.Timestamp, opts.IdleTransactionThreshold)
+
+	// Analyze orphaned prepared transactions
+	data.PreparedTxns = detectPreparedTransactions(snapshot.PreparedXacts, data.Locks, data.Timestamp, opts.PreparedTransactionThreshold)
 
 	// Analyze object conflicts
-	objectConflicts := detectObjectConflicts(locks)
+	objectConflicts := detectObjectConflicts(data.Locks)
 	data.ObjectConflicts = objectConflicts
 
-	// Analyze indexes
-	indexAnalysis := analyzeIndexes(db)
-	data.IndexAnalysis = indexAnalysis
+	// Analyze advisory locks
+	data.AdvisoryLocks = detectAdvisoryLocks(data.Locks)
+
+	// Analyze the lock conflicts involving vacuums
+	data.Vacuum = detectVacuumConflicts(data.Locks)
+
+	// Analyze the predicate locks of serializable transactions
+	data.SSI = detectPredicateLocks(snapshot, opts)
+
+	// Analyze the recovery conflicts of a standby
+	data.Standby = analyzeStandby(snapshot, data.Locks)
 
 	// Generate suggestions
-	suggestions := generateSuggestions(data)
+	suggestions := generateSuggestions(data, opts)
 	data.Suggestions = suggestions
 
 	// Calculate summary
 	data.Summary = calculateSummary(data)
 
-	return data, nil
+	return data
 }
 
 // calculateSummary calculates the summary of detected issues
 func calculateSummary(data *ReportData) ReportSummary {
 	summary := ReportSummary{
-		TotalLocks:      len(data.Locks),
-		BlockedTxns:     len(data.BlockedTxns),
-		LongTxns:        len(data.LongTxns),
-		Deadlocks:       len(data.Deadlocks),
-		ObjectConflicts: len(data.ObjectConflicts),
-		Recommendations: len(data.Suggestions),
+		TopRootBlocker:          topRootBlocker(data.BlockingTrees),
+		RootBlockers:            len(data.BlockingTrees),
+		TotalLocks:              len(data.Locks),
+		BlockedTxns:             len(data.BlockedTxns),
+		LongTxns:                len(data.LongTxns),
+		IdleTxns:                len(data.IdleTxns),
+		PreparedTxns:            len(data.PreparedTxns),
+		Deadlocks:               len(data.Deadlocks),
+		DDLQueues:               len(data.DDLQueues),
+		BlockingChains:          len(data.BlockingChains),
+		ObjectConflicts:         len(data.ObjectConflicts),
+		AdvisoryLocks:           countContendedAdvisoryLocks(data.AdvisoryLocks),
+		VacuumConflicts:         len(data.Vacuum.Blocking) + len(data.Vacuum.Blocked),
+		EscalatedPredicateLocks: data.SSI.EscalatedRelations,
+		Recommendations:         len(data.Suggestions),
 	}
 
 	// Calculate critical issues
-	summary.CriticalIssues = summary.Deadlocks + summary.BlockedTxns
+	summary.CriticalIssues = summary.Deadlocks + summary.BlockedTxns + summary.PreparedTxns + summary.DDLQueues
 
 	// Calculate warnings
-	summary.Warnings = summary.LongTxns + summary.ObjectConflicts
+	if data.Standby != nil {
+		summary.RecoveryConflicts = int(data.Standby.DeltaTotal())
+		summary.ReplayWaiters = len(data.Standby.ReplayWaiters)
+	}
+
+	summary.Warnings = summary.LongTxns + summary.IdleTxns + summary.ObjectConflicts + summary.AdvisoryLocks +
+		summary.VacuumConflicts + summary.EscalatedPredicateLocks + summary.RecoveryConflicts + summary.ReplayWaiters
 
 	return summary
 }
 
 // generateSuggestions generates suggestions based on analysis
-func generateSuggestions(data *ReportData) []string {
+func generateSuggestions(data *ReportData, opts AnalyzerOptions) []string {
 	var suggestions []string
 
 	// Suggestions based on blocked transactions
@@ -228,12 +448,43 @@ func generateSuggestions(data *ReportData) []string {
 		suggestions = append(suggestions, "Check lock acquisition order to avoid deadlocks")
 	}
 
+	// Suggestions based on the statements of the root blockers
+	oneOff, hot := rootBlockerStatements(data.BlockingTrees)
+	if oneOff {
+		suggestions = append(suggestions, "Run one-off statements blocking the application, such as maintenance or manual queries, outside peak hours and with a short lock_timeout")
+	}
+	if hot {
+		suggestions = append(suggestions, "Frequent application statements are blocking other sessions: shorten the transactions running them and take their locks as late as possible")
+	}
+
 	// Suggestions based on long transactions
 	if len(data.LongTxns) > 0 {
 		suggestions = append(suggestions, "Split long transactions into smaller ones")
 		suggestions = append(suggestions, "Optimize queries to reduce execution time")
 	}
 
+	// Suggestions based on sessions idle in transaction
+	if len(data.IdleTxns) > 0 {
+		suggestions = append(suggestions, "Make sure the application commits or rolls back as soon as its work is done")
+		suggestions = append(suggestions, "Set idle_in_transaction_session_timeout to release locks held by forgotten transactions")
+	}
+
+	// Suggestions based on DDL lock queues
+	if len(data.DDLQueues) > 0 {
+		suggestions = append(suggestions, "Run DDL with a short lock_timeout (SET lock_timeout = '"+ddlLockTimeout+"') and retry it, so that a migration waiting for its lock does not queue every query on the table")
+	}
+
+	// Suggestions based on the rows locked with pgrowlocks
+	if blocksForeignKeyChecks(data.RowLocks) {
+		suggestions = append(suggestions, "Rows locked with SELECT ... FOR UPDATE also block the foreign key checks of the rows referencing them: use FOR NO KEY UPDATE when the key is not modified")
+	}
+
+	// Suggestions based on prepared transactions
+	if len(data.PreparedTxns) > 0 {
+		suggestions = append(suggestions, "Resolve the prepared transactions left by the transaction manager with COMMIT PREPARED or ROLLBACK PREPARED: their locks are never released otherwise")
+		suggestions = append(suggestions, "Set max_prepared_transactions to 0 when two-phase commit is not used")
+	}
+
 	// Suggestions based on object conflicts
 	if len(data.ObjectConflicts) > 0 {
 		suggestions = append(suggestions, "Review lock acquisition strategy")
@@ -246,8 +497,45 @@ func generateSuggestions(data *ReportData) []string {
 		suggestions = append(suggestions, "Standardize table access order to avoid deadlocks")
 	}
 
+	// Suggestions based on advisory lock contention
+	if countContendedAdvisoryLocks(data.AdvisoryLocks) > 0 {
+		suggestions = append(suggestions, "Check the jobs holding contended advisory locks and prefer pg_try_advisory_lock for optional work")
+	}
+
+	// Suggestions based on vacuum conflicts
+	if len(data.Vacuum.Blocking) > 0 {
+		suggestions = append(suggestions, "Set lock_timeout on migrations so that DDL queued behind a vacuum fails fast instead of blocking every query on the table")
+	}
+	if len(data.Vacuum.Blocked) > 0 {
+		suggestions = append(suggestions, "End the transactions blocking vacuum: tables that are not vacuumed bloat and approach transaction ID wraparound")
+	}
+
+	// Suggestions based on predicate lock escalation
+	if data.SSI.EscalatedRelations > 0 {
+		suggestions = append(suggestions, "Raise max_pred_locks_per_relation or max_pred_locks_per_transaction, and index the columns filtered by serializable transactions, so that predicate locks are not promoted to whole relations")
+		suggestions = append(suggestions, "Retry serialization failures (SQLSTATE 40001) and keep serializable transactions short; declare read-only transactions as READ ONLY")
+	}
+
+	// Suggestions based on recovery conflicts
+	if standby := data.Standby; standby != nil {
+		var snapshotConflicts, lockConflicts int64
+		for _, conflicts := range standby.Conflicts {
+			snapshotConflicts += conflicts.Snapshot
+			lockConflicts += conflicts.Lock + conflicts.BufferPin
+		}
+		if snapshotConflicts > 0 && standby.Settings["hot_standby_feedback"] == "off" {
+			suggestions = append(suggestions, "Enable hot_standby_feedback to avoid snapshot conflicts, at the cost of delaying the cleanup of the primary")
+		}
+		if snapshotConflicts+lockConflicts > 0 {
+			suggestions = append(suggestions, "Raise max_standby_streaming_delay on replicas running long queries, or route those queries to a replica dedicated to reporting")
+		}
+		if len(standby.ReplayWaiters) > 0 || lockConflicts > 0 {
+			suggestions = append(suggestions, "Avoid DDL and LOCK TABLE on the primary during read peaks, and disable vacuum_truncate on hot tables: their AccessExclusiveLock is replayed on the standby")
+		}
+	}
+
 	// General suggestions
-	if len(data.Locks) > 10 {
+	if len(data.Locks) > opts.LockCountThreshold {
 		suggestions = append(suggestions, "Consider reviewing transaction patterns")
 		suggestions = append(suggestions, "Monitor lock wait times regularly")
 	}
@@ -255,269 +543,596 @@ func generateSuggestions(data *ReportData) []string {
 	return suggestions
 }
 
-// getLocks retrieves all active locks
-func getLocks(db *bun.DB) ([]LockInfo, error) {
-	query := `
+// getLockRows retrieves the rows of pg_locks. Before PostgreSQL 14, pg_locks has no waitstart:
+// the wait is assumed to start with the current state or query of the session when the snapshot
+// is analyzed.
+func getLockRows(ctx context.Context, db bun.IDB, caps capabilities) ([]LockRow, error) {
+	query := fmt.Sprintf(`
 		SELECT 
 			l.pid,
-			l.mode,
-			l.granted,
-			CASE 
-				WHEN l.relation IS NOT NULL THEN t.relname
-				WHEN l.database IS NOT NULL THEN 'database'
-				WHEN l.page IS NOT NULL THEN 'page'
-				WHEN l.tuple IS NOT NULL THEN 'tuple'
-				WHEN l.virtualxid IS NOT NULL THEN 'virtualxid'
-				WHEN l.transactionid IS NOT NULL THEN 'transactionid'
-				ELSE 'unknown'
-			END as object_type,
-			CASE 
-				WHEN l.relation IS NOT NULL THEN t.relname
-				ELSE 'N/A'
-			END as object_name,
+			l.locktype,
+			l.database,
+			l.relation,
 			l.page,
 			l.tuple,
 			l.virtualxid,
-			l.transactionid
+			l.transactionid,
+			l.classid,
+			l.objid,
+			l.objsubid,
+			l.virtualtransaction,
+			l.mode,
+			l.granted,
+			%s AS waitstart
 		FROM pg_locks l
-		LEFT JOIN pg_class t ON l.relation = t.oid
-		WHERE l.pid != pg_backend_pid()
+		WHERE l.pid IS DISTINCT FROM pg_backend_pid()
 		ORDER BY l.pid, l.mode;
-	`
+	`, caps.column(FeatureLockWaitStart, "l.waitstart", "timestamptz"))
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var locks []LockInfo
+	var locks []LockRow
 	for rows.Next() {
-		var lock LockInfo
-		var page, tuple, virtualxid, transactionid sql.NullString
-
-		err := rows.Scan(&lock.PID, &lock.Mode, &lock.Granted, &lock.ObjectType, &lock.ObjectName,
-			&page, &tuple, &virtualxid, &transactionid)
+		var lock LockRow
+		var pid, database, relation, classID, objID sql.NullInt64
+		var page, tuple, virtualxid, transactionid, virtualTransaction sql.NullString
+		var objSubID sql.NullInt32
+		var waitStart sql.NullTime
+
+		err := rows.Scan(&pid, &lock.LockType, &database, &relation, &page, &tuple, &virtualxid, &transactionid,
+			&classID, &objID, &objSubID, &virtualTransaction, &lock.Mode, &lock.Granted, &waitStart)
 		if err != nil {
 			continue
 		}
 
-		if page.Valid {
-			lock.Page = page.String
-		}
-		if tuple.Valid {
-			lock.Tuple = tuple.String
-		}
-		if virtualxid.Valid {
-			lock.VirtualXID = virtualxid.String
+		lock.PID = int(pid.Int64)
+		lock.Database = uint32(database.Int64)
+		lock.Relation = uint32(relation.Int64)
+		lock.Page = page.String
+		lock.Tuple = tuple.String
+		lock.VirtualXID = virtualxid.String
+		lock.TransactionID = transactionid.String
+		lock.ClassID = uint32(classID.Int64)
+		lock.ObjID = uint32(objID.Int64)
+		lock.ObjSubID = int(objSubID.Int32)
+		lock.VirtualTransaction = virtualTransaction.String
+		lock.WaitStart = waitStart.Time
+
+		locks = append(locks, lock)
+	}
+
+	return locks, rows.Err()
+}
+
+// getActivityRows retrieves the rows of pg_stat_activity along with the PIDs blocking each session.
+// pg_blocking_pids() reads the shared lock manager state, so it is only called for the sessions
+// waiting for a lock. leader_pid (PostgreSQL 13) and query_id (PostgreSQL 14) are left empty on
+// older servers.
+func getActivityRows(ctx context.Context, db bun.IDB, caps capabilities) ([]ActivityRow, error) {
+	query := fmt.Sprintf(`
+		SELECT 
+			pid,
+			%s AS leader_pid,
+			%s AS query_id,
+			datname,
+			usename,
+			application_name,
+			host(client_addr) AS client_addr,
+			backend_type,
+			state,
+			xact_start,
+			query_start,
+			state_change,
+			wait_event_type,
+			wait_event,
+			query,
+			CASE WHEN wait_event_type = 'Lock' THEN pg_blocking_pids(pid) END AS blocking_pids
+		FROM pg_stat_activity
+		WHERE pid != pg_backend_pid()
+		ORDER BY pid
+	`, caps.column(FeatureParallelLeader, "leader_pid", "int"), caps.column(FeatureQueryID, "query_id", "bigint"))
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []ActivityRow
+	for rows.Next() {
+		var session sessionColumns
+		var pid int
+		var blockingPIDs []int64
+
+		err := rows.Scan(&pid, &session.leaderPID, &session.queryID, &session.database, &session.username, &session.applicationName, &session.clientAddr,
+			&session.backendType, &session.state, &session.xactStart, &session.queryStart, &session.stateChange,
+			&session.waitEventType, &session.waitEvent, &session.query, pgdialect.Array(&blockingPIDs))
+		if err != nil {
+			continue
 		}
-		if transactionid.Valid {
-			lock.TransactionID = transactionid.String
+
+		// blocking_pids is NULL for the sessions not waiting for a lock
+		row := session.row(pid)
+		for _, blocker := range blockingPIDs {
+			row.BlockingPIDs = append(row.BlockingPIDs, int(blocker))
 		}
 
-		lock.Type = lock.ObjectType
-		lock.Object = lock.ObjectName
+		activity = append(activity, row)
+	}
+
+	return activity, rows.Err()
+}
 
-		locks = append(locks, lock)
+// sessionColumns holds the nullable pg_stat_activity columns
+type sessionColumns struct {
+	leaderPID       sql.NullInt64
+	queryID         sql.NullInt64
+	database        sql.NullString
+	username        sql.NullString
+	applicationName sql.NullString
+	clientAddr      sql.NullString
+	backendType     sql.NullString
+	state           sql.NullString
+	xactStart       sql.NullTime
+	queryStart      sql.NullTime
+	stateChange     sql.NullTime
+	waitEventType   sql.NullString
+	waitEvent       sql.NullString
+	query           sql.NullString
+}
+
+// row returns the activity row of a session, leaving missing values empty
+func (s sessionColumns) row(pid int) ActivityRow {
+	return ActivityRow{
+		PID:             pid,
+		LeaderPID:       int(s.leaderPID.Int64),
+		QueryID:         s.queryID.Int64,
+		Database:        s.database.String,
+		Username:        s.username.String,
+		ApplicationName: s.applicationName.String,
+		ClientAddr:      s.clientAddr.String,
+		BackendType:     s.backendType.String,
+		State:           s.state.String,
+		XactStart:       s.xactStart.Time,
+		QueryStart:      s.queryStart.Time,
+		StateChange:     s.stateChange.Time,
+		WaitEventType:   s.waitEventType.String,
+		WaitEvent:       s.waitEvent.String,
+		Query:           s.query.String,
+	}
+}
+
+// getRelationRows retrieves the given relations of the current database and the shared catalogs.
+// The OIDs are those of the collected lock rows rather than a new read of pg_locks, which is not
+// transactional and would not match the locks of the snapshot.
+func getRelationRows(ctx context.Context, db bun.IDB, oids []uint32) ([]RelationRow, error) {
+	if len(oids) == 0 {
+		return nil, nil
 	}
+	return queryRelationRows(ctx, db, "c.oid IN (?)", bun.In(oids))
+}
 
-	return locks, nil
+// getDatabaseRelationRows retrieves the given relations of the database db is connected to
+func getDatabaseRelationRows(ctx context.Context, db bun.IDB, oids []uint32) ([]RelationRow, error) {
+	return queryRelationRows(ctx, db, "c.oid IN (?) AND NOT c.relisshared", bun.In(oids))
 }
 
-// getRowLocks retrieves row locks
-func getRowLocks(db *bun.DB) ([]RowLockInfo, error) {
+// queryRelationRows retrieves the relations of pg_class matching the condition, along with the
+// OID of their database (0 for shared catalogs). The condition may refer to the current database as d.
+func queryRelationRows(ctx context.Context, db bun.IDB, condition string, args ...interface{}) ([]RelationRow, error) {
 	query := `
 		SELECT 
-			l.pid,
-			t.relname,
-			l.page,
-			l.tuple,
-			l.mode,
-			l.granted
-		FROM pg_locks l
-		LEFT JOIN pg_class t ON l.relation = t.oid
-		WHERE l.pid != pg_backend_pid()
-		AND l.page IS NOT NULL
-		ORDER BY l.pid;
+			CASE WHEN c.relisshared THEN 0 ELSE d.oid END,
+			c.oid,
+			n.nspname,
+			c.relname,
+			c.relkind
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_database d ON d.datname = current_database()
+		WHERE ` + condition + `
+		ORDER BY c.oid
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var rowLocks []RowLockInfo
+	var relations []RelationRow
 	for rows.Next() {
-		var rowLock RowLockInfo
-		var table sql.NullString
+		var relation RelationRow
+		var database, oid int64
 
-		err := rows.Scan(&rowLock.PID, &table, &rowLock.Page, &rowLock.Tuple, &rowLock.Mode, &rowLock.Granted)
-		if err != nil {
+		if err := rows.Scan(&database, &oid, &relation.Schema, &relation.Name, &relation.Kind); err != nil {
 			continue
 		}
+		relation.Database = uint32(database)
+		relation.OID = uint32(oid)
+
+		relations = append(relations, relation)
+	}
+
+	return relations, rows.Err()
+}
+
+// detectDeadlocks detects deadlocks in progress from the cycles of the wait graph
+func detectDeadlocks(graph *WaitGraph, locks []LockInfo) []DeadlockInfo {
+	var deadlocks []DeadlockInfo
 
-		if table.Valid {
-			rowLock.Table = table.String
+	if graph == nil {
+		return deadlocks
+	}
+
+	for _, cycle := range graph.Cycles() {
+		participants := make([]DeadlockParticipant, len(cycle))
+		for i, pid := range cycle {
+			participants[i].PID = pid
+			participants[i].WaitingLock = waitingLock(locks, pid)
+			participants[i].Database = participants[i].WaitingLock.Database
+			participants[i].Query = participants[i].WaitingLock.Query
+		}
+
+		// Each participant holds the lock the previous one is waiting for
+		for i := range participants {
+			previous := participants[(i+len(participants)-1)%len(participants)]
+			participants[i].HeldLock = heldLock(locks, participants[i].PID, previous.WaitingLock)
 		}
 
-		rowLocks = append(rowLocks, rowLock)
+		deadlocks = append(deadlocks, DeadlockInfo{
+			Participants:   participants,
+			ConflictType:   fmt.Sprintf("Deadlock in progress between %d sessions", len(participants)),
+			Recommendation: "Review transaction order",
+		})
 	}
 
-	return rowLocks, nil
+	return deadlocks
 }
 
-// detectDeadlocks detects potential deadlocks
-func detectDeadlocks(locks []LockInfo) []DeadlockInfo {
-	var deadlocks []DeadlockInfo
+// detectBlockingChains detects chains of backends waiting for each other outside of deadlock cycles.
+// The database of a chain is the one of the locks of its head, or else of its session.
+func detectBlockingChains(graph *WaitGraph, locks []LockInfo, activity []ActivityRow) []BlockingChain {
+	var chains []BlockingChain
+
+	if graph == nil {
+		return chains
+	}
+
+	inCycle := graph.cycleMembers()
 
-	// Simplified logic to detect deadlocks
-	// In practice, a more complex analysis would be needed
-	for i, lock1 := range locks {
-		for j, lock2 := range locks {
-			if i >= j {
+	var walk func(path []int)
+	walk = func(path []int) {
+		current := path[len(path)-1]
+		extended := false
+		for _, blocker := range graph.BlockersOf(current) {
+			if inCycle[blocker] || containsPID(path, blocker) {
 				continue
 			}
+			walk(append(append([]int(nil), path...), blocker))
+			extended = true
+		}
+		if !extended && len(path) > 1 {
+			chains = append(chains, BlockingChain{PIDs: path, Database: chainDatabase(locks, activity, current)})
+		}
+	}
+
+	// Chains start from waiters nobody is waiting for
+	for _, pid := range graph.Nodes {
+		if graph.IsWaiting(pid) && !graph.IsBlocking(pid) && !inCycle[pid] {
+			walk([]int{pid})
+		}
+	}
 
-			if lock1.PID != lock2.PID &&
-				lock1.Object == lock2.Object &&
-				lock1.Granted != lock2.Granted {
+	return chains
+}
 
-				deadlock := DeadlockInfo{
-					Transaction1:   lock1,
-					Transaction2:   lock2,
-					ConflictType:   "Lock conflict",
-					Recommendation: "Review transaction order",
-				}
-				deadlocks = append(deadlocks, deadlock)
-			}
+// chainDatabase returns the database of the head of a blocking chain
+func chainDatabase(locks []LockInfo, activity []ActivityRow, head int) string {
+	if database := sessionNode(locks, head).Database; database != "" {
+		return database
+	}
+	for _, session := range activity {
+		if session.PID == head {
+			return session.Database
 		}
 	}
+	return ""
+}
 
-	return deadlocks
+// waitingLock returns the lock a backend is waiting for, or a lock carrying only the PID
+func waitingLock(locks []LockInfo, pid int) LockInfo {
+	for _, lock := range locks {
+		if lock.PID == pid && !lock.Granted {
+			return lock
+		}
+	}
+	return LockInfo{PID: pid}
+}
+
+// heldLock returns the granted lock of a backend on the object targeted by a waiting lock
+func heldLock(locks []LockInfo, pid int, waiting LockInfo) LockInfo {
+	for _, lock := range locks {
+		if lock.PID == pid && lock.Granted && sameLockTarget(lock, waiting) {
+			return lock
+		}
+	}
+	return LockInfo{PID: pid}
 }
 
-// detectBlockedTransactions detects blocked transactions
-func detectBlockedTransactions(locks []LockInfo) []BlockedTransaction {
+// sameLockTarget reports whether two locks are taken on the same lockable object
+func sameLockTarget(a, b LockInfo) bool {
+	return a.DatabaseOID == b.DatabaseOID &&
+		a.Object == b.Object &&
+		a.Page == b.Page &&
+		a.Tuple == b.Tuple &&
+		a.TransactionID == b.TransactionID &&
+		a.VirtualXID == b.VirtualXID
+}
+
+// containsPID reports whether a PID is present in a list
+func containsPID(pids []int, pid int) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// detectBlockedTransactions detects the transactions waiting for at least threshold, longest waits first
+func detectBlockedTransactions(locks []LockInfo, graph *WaitGraph, threshold time.Duration) []BlockedTransaction {
 	var blocked []BlockedTransaction
 
-	// Simplified logic to detect blocked transactions
 	for _, lock := range locks {
-		if !lock.Granted {
-			blocked = append(blocked, BlockedTransaction{
-				PID:       fmt.Sprintf("%d", lock.PID),
-				Duration:  "unknown",
+		if !lock.Granted && lock.WaitTime >= threshold {
+			txn := BlockedTransaction{
+				PID:       lock.PID,
+				Database:  lock.Database,
+				Duration:  lock.WaitTime,
 				Query:     lock.Query,
-				WaitEvent: "lock",
-			})
+				WaitEvent: waitEvent(lock),
+				RowWait:   lock.RowWait,
+			}
+			if graph != nil {
+				txn.BlockingPIDs = graph.BlockersOf(lock.PID)
+			}
+			blocked = append(blocked, txn)
 		}
 	}
 
+	sort.SliceStable(blocked, func(i, j int) bool {
+		return blocked[i].Duration > blocked[j].Duration
+	})
+
 	return blocked
 }
 
-// detectLongTransactions detects long transactions
-func detectLongTransactions(db *bun.DB) []LongTransaction {
-	query := `
-		SELECT 
-			pid,
-			now() - query_start AS duration,
-			query
-		FROM pg_stat_activity 
-		WHERE state = 'active' 
-		AND pid != pg_backend_pid()
-		AND now() - query_start > interval '5 seconds'
-		ORDER BY duration DESC
-	`
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil
+// waitEvent describes what a waiting lock is waiting on
+func waitEvent(lock LockInfo) string {
+	if lock.WaitEventType == "" {
+		return "lock"
 	}
-	defer rows.Close()
+	if lock.WaitEvent == "" {
+		return lock.WaitEventType
+	}
+	return lock.WaitEventType + ": " + lock.WaitEvent
+}
 
+// detectLongTransactions detects the active queries running for longer than threshold, oldest first
+func detectLongTransactions(activity []ActivityRow, timestamp time.Time, threshold time.Duration) []LongTransaction {
 	var longTxns []LongTransaction
-	for rows.Next() {
-		var txn LongTransaction
-		var duration, query sql.NullString
 
-		err := rows.Scan(&txn.PID, &duration, &query)
-		if err != nil {
+	for _, session := range activity {
+		if session.State != "active" || session.QueryStart.IsZero() {
 			continue
 		}
-
-		if duration.Valid {
-			txn.Duration = duration.String
+		// Parallel workers run the query of their leader, which is reported instead
+		if session.LeaderPID != 0 && session.LeaderPID != session.PID {
+			continue
 		}
-		if query.Valid {
-			txn.Query = query.String
+
+		duration := timestamp.Sub(session.QueryStart)
+		if duration <= threshold {
+			continue
 		}
 
-		longTxns = append(longTxns, txn)
+		longTxns = append(longTxns, LongTransaction{
+			PID:        session.PID,
+			Database:   session.Database,
+			Duration:   duration,
+			QueryStart: session.QueryStart,
+			Query:      session.Query,
+		})
 	}
 
+	sort.SliceStable(longTxns, func(i, j int) bool {
+		return longTxns[i].QueryStart.Before(longTxns[j].QueryStart)
+	})
+
 	return longTxns
 }
 
-// detectObjectConflicts detects object conflicts
+// detectObjectConflicts pairs each waiting lock with the granted locks of other backends
+// it conflicts with on the same object, according to the PostgreSQL lock conflict matrix
 func detectObjectConflicts(locks []LockInfo) []ObjectConflict {
-	objectMap := make(map[string][]string)
-
+	objectMap := make(map[string][]LockInfo)
 	for _, lock := range locks {
-		if lock.Object != "" {
-			objectMap[lock.Object] = append(objectMap[lock.Object], fmt.Sprintf("%d", lock.PID))
-		}
+		key := lockTag(lock)
+		objectMap[key] = append(objectMap[key], lock)
 	}
 
 	var conflicts []ObjectConflict
-	for object, pids := range objectMap {
-		if len(pids) > 1 {
-			conflicts = append(conflicts, ObjectConflict{
-				Object:         object,
-				PIDs:           pids,
-				Mode:           "multiple",
-				Recommendation: "Review access patterns",
-			})
+	for _, objectLocks := range objectMap {
+		for _, waiter := range objectLocks {
+			if waiter.Granted {
+				continue
+			}
+			for _, holder := range objectLocks {
+				if !holder.Granted || holder.PID == waiter.PID || !lockmodes.ModesConflict(holder.Mode, waiter.Mode) {
+					continue
+				}
+				conflicts = append(conflicts, ObjectConflict{
+					Database:       holder.Database,
+					Schema:         holder.Schema,
+					Object:         holder.Target(),
+					Type:           holder.Type,
+					HolderPID:      holder.PID,
+					HolderMode:     holder.Mode,
+					WaiterPID:      waiter.PID,
+					WaiterMode:     waiter.Mode,
+					WaiterQuery:    waiter.Query,
+					WaitTime:       waiter.WaitTime,
+					Recommendation: conflictRecommendation(holder, waiter),
+				})
+			}
 		}
 	}
 
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Database != conflicts[j].Database {
+			return conflicts[i].Database < conflicts[j].Database
+		}
+		if conflicts[i].Object != conflicts[j].Object {
+			return conflicts[i].Object < conflicts[j].Object
+		}
+		if conflicts[i].WaiterPID != conflicts[j].WaiterPID {
+			return conflicts[i].WaiterPID < conflicts[j].WaiterPID
+		}
+		return conflicts[i].HolderPID < conflicts[j].HolderPID
+	})
+
 	return conflicts
 }
 
-// analyzeIndexes analyzes indexes
-func analyzeIndexes(db *bun.DB) []IndexInfo {
+// lockTag identifies the object of a lock, like the lock tag of the server: two locks only
+// conflict when they have the same tag
+func lockTag(lock LockInfo) string {
+	return fmt.Sprintf("%d/%s/%s/%s/%s/%s/%s/%d/%d/%d", lock.DatabaseOID, lock.Type, lock.Object, lock.Page, lock.Tuple,
+		lock.TransactionID, lock.VirtualXID, lock.ClassID, lock.ObjID, lock.ObjSubID)
+}
+
+// conflictRecommendation suggests how to avoid a conflict from the modes involved
+func conflictRecommendation(holder, waiter LockInfo) string {
+	holderMode, _ := lockmodes.ParseMode(holder.Mode)
+	waiterMode, _ := lockmodes.ParseMode(waiter.Mode)
+
+	switch {
+	case holderMode == lockmodes.AccessExclusive || waiterMode == lockmodes.AccessExclusive:
+		return "Schedule schema changes and VACUUM FULL outside busy periods"
+	case holder.Type == "transactionid" || holder.Type == "tuple":
+		return "Keep transactions modifying the same rows short"
+	case holderMode == lockmodes.Share || waiterMode == lockmodes.Share:
+		return "Build indexes with CREATE INDEX CONCURRENTLY"
+	case holderMode == lockmodes.ShareUpdateExclusive && waiterMode == lockmodes.ShareUpdateExclusive:
+		return "Avoid running VACUUM, ANALYZE or concurrent index builds on the same table at once"
+	case holder.Type == "advisory":
+		return "Review how the application takes this advisory lock"
+	default:
+		return "Review access patterns"
+	}
+}
+
+// getIndexRows retrieves the indexes of the user schemas in the opts scope, largest first. The
+// schema patterns are applied by the server so that the size of the indexes out of scope is not read.
+func getIndexRows(ctx context.Context, db bun.IDB, opts AnalyzerOptions) ([]IndexRow, error) {
+	conditions := []string{
+		"n.nspname NOT IN ('pg_catalog', 'information_schema')",
+		"n.nspname !~ '^pg_(toast|temp_)'",
+	}
+	var args []interface{}
+	if len(opts.IncludeSchemas) > 0 {
+		conditions = append(conditions, "n.nspname ~ ANY(?)")
+		args = append(args, pgdialect.Array(globRegexps(opts.IncludeSchemas)))
+	}
+	if len(opts.ExcludeSchemas) > 0 {
+		conditions = append(conditions, "NOT n.nspname ~ ANY(?)")
+		args = append(args, pgdialect.Array(globRegexps(opts.ExcludeSchemas)))
+	}
+
 	query := `
 		SELECT 
-			indexname,
-			tablename,
-			pg_size_pretty(pg_relation_size(indexname::regclass)) as size
-		FROM pg_indexes 
-		WHERE schemaname = 'public'
-		ORDER BY pg_relation_size(indexname::regclass) DESC
+			n.nspname,
+			i.relname,
+			t.relname,
+			pg_relation_size(i.oid) AS size
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = i.relnamespace
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY size DESC
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	defer rows.Close()
 
-	var indexes []IndexInfo
+	var indexes []IndexRow
 	for rows.Next() {
-		var index IndexInfo
-		var size sql.NullString
+		var index IndexRow
 
-		err := rows.Scan(&index.Name, &index.Table, &size)
-		if err != nil {
+		if err := rows.Scan(&index.Schema, &index.Name, &index.Table, &index.SizeBytes); err != nil {
 			continue
 		}
 
-		if size.Valid {
-			index.Size = size.String
-		}
-
 		indexes = append(indexes, index)
 	}
 
-	return indexes
+	return indexes, rows.Err()
+}
+
+// analyzedSettings are the server settings read for the analysis
+var analyzedSettings = append([]string{
+	"max_pred_locks_per_transaction",
+	"max_pred_locks_per_relation",
+	"max_pred_locks_per_page",
+	"track_activity_query_size",
+}, standbySettings...)
+
+// getSettings retrieves the analyzed server settings, by name, as shown by SHOW (e.g. 30s).
+// Settings that do not exist on the server version are left out.
+func getSettings(ctx context.Context, db bun.IDB) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, current_setting(name) FROM pg_settings WHERE name IN (?)", bun.In(analyzedSettings))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var name, setting string
+		if err := rows.Scan(&name, &setting); err != nil {
+			continue
+		}
+		settings[name] = setting
+	}
+
+	return settings, rows.Err()
+}
+
+// getDatabaseStats retrieves the statistics of the current database
+func getDatabaseStats(ctx context.Context, db bun.IDB) (DatabaseStatsRow, error) {
+	query := `
+		SELECT
+			datname,
+			xact_commit,
+			xact_rollback,
+			deadlocks,
+			stats_reset
+		FROM pg_stat_database
+		WHERE datname = current_database()
+	`
+
+	var stats DatabaseStatsRow
+	var statsReset sql.NullTime
+	err := db.QueryRowContext(ctx, query).Scan(&stats.Name, &stats.XactCommit, &stats.XactRollback, &stats.Deadlocks, &statsReset)
+	stats.StatsReset = statsReset.Time
+	return stats, err
 }
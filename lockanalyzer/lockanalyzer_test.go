@@ -60,10 +60,7 @@ func TestGetLocks(t *testing.T) {
 	tdb := setupTestDB(t, "fixture_test.yml")
 	defer tdb.cleanupTestDB()
 
-	locks, err := getLocks(tdb.DB)
-	if err != nil {
-		t.Fatalf("Error retrieving locks: %v", err)
-	}
+	locks := analyzeDB(t, tdb.DB).Locks
 
 	// Debug: display type and value
 	t.Logf("Locks type: %T, Value: %v, Is nil: %v", locks, locks, locks == nil)
@@ -81,10 +78,7 @@ func TestGetRowLocks(t *testing.T) {
 	tdb := setupTestDB(t, "fixture_test.yml")
 	defer tdb.cleanupTestDB()
 
-	rowLocks, err := getRowLocks(tdb.DB)
-	if err != nil {
-		t.Fatalf("Error retrieving row locks: %v", err)
-	}
+	rowLocks := analyzeDB(t, tdb.DB).RowLocks
 
 	// Verify that the function doesn't return an error
 	// In Go, an empty slice [] is considered nil, which is normal
@@ -99,7 +93,7 @@ func TestDetectLongTransactions(t *testing.T) {
 	tdb := setupTestDB(t, "fixture_test.yml")
 	defer tdb.cleanupTestDB()
 
-	longTxns := detectLongTransactions(tdb.DB)
+	longTxns := analyzeDB(t, tdb.DB).LongTxns
 
 	// Without active transactions, there should not be any long transactions
 	if len(longTxns) > 0 {
@@ -112,10 +106,7 @@ func TestDetectObjectConflicts(t *testing.T) {
 	tdb := setupTestDB(t, "fixture_test.yml")
 	defer tdb.cleanupTestDB()
 
-	locks, err := getLocks(tdb.DB)
-	if err != nil {
-		t.Fatalf("Error retrieving locks: %v", err)
-	}
+	locks := analyzeDB(t, tdb.DB).Locks
 
 	conflicts := detectObjectConflicts(locks)
 
@@ -132,7 +123,7 @@ func TestAnalyzeIndexes(t *testing.T) {
 	tdb := setupTestDB(t, "fixture_test.yml")
 	defer tdb.cleanupTestDB()
 
-	indexes := analyzeIndexes(tdb.DB)
+	indexes := analyzeDB(t, tdb.DB).IndexAnalysis
 
 	// There should be at least a few indexes
 	if len(indexes) == 0 {
@@ -159,13 +150,13 @@ func TestCalculateSummary(t *testing.T) {
 			{PID: 2, Mode: "ShareLock", Granted: false},
 		},
 		BlockedTxns: []BlockedTransaction{
-			{PID: "2", Duration: "10s"},
+			{PID: 2, Duration: 10 * time.Second},
 		},
 		LongTxns: []LongTransaction{
-			{PID: "1", Duration: "30s"},
+			{PID: 1, Duration: 30 * time.Second},
 		},
 		ObjectConflicts: []ObjectConflict{
-			{Object: "projects", PIDs: []string{"1", "2"}},
+			{Object: "projects", HolderPID: 1, WaiterPID: 2},
 		},
 		Suggestions: []string{"Test suggestion"},
 	}
@@ -206,21 +197,21 @@ func TestCalculateSummary(t *testing.T) {
 func TestGenerateSuggestions(t *testing.T) {
 	data := &ReportData{
 		BlockedTxns: []BlockedTransaction{
-			{PID: "1", Duration: "10s"},
+			{PID: 1, Duration: 10 * time.Second},
 		},
 		LongTxns: []LongTransaction{
-			{PID: "2", Duration: "30s"},
+			{PID: 2, Duration: 30 * time.Second},
 		},
 		ObjectConflicts: []ObjectConflict{
 			{Object: "projects"},
 		},
 		Deadlocks: []DeadlockInfo{
-			{Transaction1: LockInfo{PID: 1}, Transaction2: LockInfo{PID: 2}},
+			{Participants: []DeadlockParticipant{{PID: 1}, {PID: 2}}},
 		},
 		Locks: make([]LockInfo, 15), // More than 10 locks
 	}
 
-	suggestions := generateSuggestions(data)
+	suggestions := generateSuggestions(data, DefaultAnalyzerOptions())
 
 	// Verify that there are suggestions
 	if len(suggestions) == 0 {
@@ -257,25 +248,106 @@ func TestGenerateSuggestions(t *testing.T) {
 // TestDetectDeadlocks tests deadlock detection
 func TestDetectDeadlocks(t *testing.T) {
 	locks := []LockInfo{
-		{PID: 1, Mode: "ExclusiveLock", Granted: true, Object: "table1"},
-		{PID: 2, Mode: "ExclusiveLock", Granted: false, Object: "table2"},
-		{PID: 1, Mode: "ShareLock", Granted: false, Object: "table2"},
-		{PID: 2, Mode: "ShareLock", Granted: true, Object: "table1"},
+		{PID: 1, Mode: "RowExclusiveLock", Granted: true, Object: "table1"},
+		{PID: 1, Mode: "ShareLock", Granted: false, Object: "table2", Query: "UPDATE table2"},
+		{PID: 2, Mode: "RowExclusiveLock", Granted: true, Object: "table2"},
+		{PID: 2, Mode: "ShareLock", Granted: false, Object: "table3", Query: "UPDATE table3"},
+		{PID: 3, Mode: "RowExclusiveLock", Granted: true, Object: "table3"},
+		{PID: 3, Mode: "ShareLock", Granted: false, Object: "table1", Query: "UPDATE table1"},
+		{PID: 4, Mode: "ShareLock", Granted: false, Object: "table1"},
+	}
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 1, Blocker: 2},
+		{Waiter: 2, Blocker: 3},
+		{Waiter: 3, Blocker: 1},
+		{Waiter: 4, Blocker: 1},
+	})
+
+	deadlocks := detectDeadlocks(graph, locks)
+
+	// The three-way cycle is a single deadlock, PID 4 is only blocked
+	if len(deadlocks) != 1 {
+		t.Fatalf("Expected 1 deadlock, got: %d", len(deadlocks))
+	}
+
+	participants := deadlocks[0].Participants
+	if len(participants) != 3 {
+		t.Fatalf("Expected 3 participants, got: %d", len(participants))
+	}
+
+	expected := []struct {
+		pid     int
+		held    string
+		waiting string
+		query   string
+	}{
+		{1, "table1", "table2", "UPDATE table2"},
+		{2, "table2", "table3", "UPDATE table3"},
+		{3, "table3", "table1", "UPDATE table1"},
+	}
+	for i, e := range expected {
+		p := participants[i]
+		if p.PID != e.pid {
+			t.Errorf("Participant %d: expected PID %d, got: %d", i, e.pid, p.PID)
+		}
+		if p.HeldLock.Object != e.held {
+			t.Errorf("Participant %d: expected held lock on %s, got: %s", i, e.held, p.HeldLock.Object)
+		}
+		if p.WaitingLock.Object != e.waiting {
+			t.Errorf("Participant %d: expected waiting lock on %s, got: %s", i, e.waiting, p.WaitingLock.Object)
+		}
+		if p.Query != e.query {
+			t.Errorf("Participant %d: expected query %q, got: %q", i, e.query, p.Query)
+		}
 	}
 
-	deadlocks := detectDeadlocks(locks)
+	// Plain blocking is not a deadlock
+	blocking := NewWaitGraph([]WaitEdge{{Waiter: 4, Blocker: 1}})
+	if deadlocks := detectDeadlocks(blocking, locks); len(deadlocks) != 0 {
+		t.Errorf("Expected no deadlock for simple blocking, got: %d", len(deadlocks))
+	}
+}
 
-	// Verify deadlock structure
-	if len(deadlocks) > 0 {
-		for _, deadlock := range deadlocks {
-			if deadlock.Transaction1.PID == 0 {
-				t.Error("Deadlock should have valid transaction 1")
-			}
-			if deadlock.Transaction2.PID == 0 {
-				t.Error("Deadlock should have valid transaction 2")
-			}
+// TestDetectBlockingChains tests detection of blocking chains
+func TestDetectBlockingChains(t *testing.T) {
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 3, Blocker: 2},
+		{Waiter: 2, Blocker: 1},
+		{Waiter: 5, Blocker: 6},
+		{Waiter: 6, Blocker: 5},
+		{Waiter: 7, Blocker: 5},
+	})
+
+	locks := []LockInfo{
+		{PID: 1, Database: "shop", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 2, Database: "shop", Mode: "ShareLock", Granted: false},
+	}
+	chains := detectBlockingChains(graph, locks, nil)
+
+	// PID 7 waits for a deadlock cycle, which is reported separately
+	if len(chains) != 1 {
+		t.Fatalf("Expected 1 blocking chain, got: %v", chains)
+	}
+
+	expected := []int{3, 2, 1}
+	if len(chains[0].PIDs) != len(expected) {
+		t.Fatalf("Expected chain %v, got: %v", expected, chains[0].PIDs)
+	}
+	for i, pid := range expected {
+		if chains[0].PIDs[i] != pid {
+			t.Errorf("Expected chain %v, got: %v", expected, chains[0].PIDs)
+			break
 		}
 	}
+	if chains[0].Database != "shop" {
+		t.Errorf("Expected the database of the chain head, got: %q", chains[0].Database)
+	}
+
+	// A head without collected locks takes the database of its session
+	activity := []ActivityRow{{PID: 1, Database: "billing"}}
+	if chains := detectBlockingChains(graph, nil, activity); len(chains) != 1 || chains[0].Database != "billing" {
+		t.Errorf("Expected the database of the head session, got: %+v", chains)
+	}
 }
 
 // TestDetectBlockedTransactionsFromLocks tests detection of blocked transactions from locks
@@ -285,39 +357,97 @@ func TestDetectBlockedTransactionsFromLocks(t *testing.T) {
 		{PID: 2, Mode: "ShareLock", Granted: true, Object: "table2"},
 	}
 
-	blocked := detectBlockedTransactions(locks)
+	blocked := detectBlockedTransactions(locks, nil, 0)
 
 	// Verify that blocked transactions are detected
 	if len(blocked) > 0 {
 		for _, txn := range blocked {
-			if txn.PID == "" {
+			if txn.PID == 0 {
 				t.Error("Blocked transaction should have valid PID")
 			}
 		}
 	}
 }
 
-// TestDetectObjectConflictsFromLocks tests detection of object conflicts from locks
+// TestDetectBlockedTransactionsWaitTime tests that blocked transactions carry their wait and blockers
+func TestDetectBlockedTransactionsWaitTime(t *testing.T) {
+	locks := []LockInfo{
+		{PID: 1, Mode: "AccessExclusiveLock", Granted: true, Object: "table1"},
+		{PID: 2, Mode: "RowExclusiveLock", Granted: false, Object: "table1", WaitTime: 2 * time.Second,
+			WaitEventType: "Lock", WaitEvent: "relation"},
+		{PID: 3, Mode: "AccessShareLock", Granted: false, Object: "table1", WaitTime: 90 * time.Second},
+	}
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 2, Blocker: 1},
+		{Waiter: 3, Blocker: 1},
+		{Waiter: 3, Blocker: 2},
+	})
+
+	blocked := detectBlockedTransactions(locks, graph, 0)
+
+	if len(blocked) != 2 {
+		t.Fatalf("Expected 2 blocked transactions, got: %d", len(blocked))
+	}
+
+	// Longest wait first
+	if blocked[0].PID != 3 || blocked[0].Duration != 90*time.Second {
+		t.Errorf("Expected PID 3 waiting 90s first, got: PID %d waiting %v", blocked[0].PID, blocked[0].Duration)
+	}
+	if len(blocked[0].BlockingPIDs) != 2 {
+		t.Errorf("Expected PID 3 blocked by 2 sessions, got: %v", blocked[0].BlockingPIDs)
+	}
+	if blocked[1].WaitEvent != "Lock: relation" {
+		t.Errorf("Expected wait event: Lock: relation, got: %s", blocked[1].WaitEvent)
+	}
+	if blocked[1].Duration != 2*time.Second {
+		t.Errorf("Expected duration: 2s, got: %v", blocked[1].Duration)
+	}
+}
+
+// TestDetectObjectConflictsFromLocks tests that only conflicting holder/waiter pairs are reported
 func TestDetectObjectConflictsFromLocks(t *testing.T) {
 	locks := []LockInfo{
-		{PID: 1, Mode: "ExclusiveLock", Granted: true, Object: "table1"},
-		{PID: 2, Mode: "ShareLock", Granted: false, Object: "table1"},
-		{PID: 3, Mode: "ExclusiveLock", Granted: false, Object: "table1"},
+		// Readers never conflict with each other
+		{PID: 1, Mode: "AccessShareLock", Granted: true, Type: "relation", Object: "public.projects"},
+		{PID: 2, Mode: "AccessShareLock", Granted: true, Type: "relation", Object: "public.projects"},
+		// ALTER TABLE waits for both readers, a third reader waits behind it without conflicting with them
+		{PID: 3, Mode: "AccessExclusiveLock", Granted: false, Type: "relation", Object: "public.projects"},
+		{PID: 4, Mode: "AccessShareLock", Granted: false, Type: "relation", Object: "public.projects"},
+		// Row update waiting for another transaction
+		{PID: 5, Mode: "ExclusiveLock", Granted: true, Type: "transactionid", Object: "N/A", TransactionID: "1234"},
+		{PID: 6, Mode: "ShareLock", Granted: false, Type: "transactionid", Object: "N/A", TransactionID: "1234"},
+		// Same mode on another transaction: no conflict
+		{PID: 7, Mode: "ShareLock", Granted: false, Type: "transactionid", Object: "N/A", TransactionID: "5678"},
 	}
 
 	conflicts := detectObjectConflicts(locks)
 
-	// Verify that conflicts have correct information
-	if len(conflicts) > 0 {
-		for _, conflict := range conflicts {
-			if conflict.Object == "" {
-				t.Error("Object conflict should have valid object name")
-			}
-			if len(conflict.PIDs) == 0 {
-				t.Error("Object conflict should have PIDs")
-			}
+	if len(conflicts) != 3 {
+		t.Fatalf("Expected 3 conflicts, got: %+v", conflicts)
+	}
+
+	expected := []struct {
+		object     string
+		holderPID  int
+		waiterPID  int
+		waiterMode string
+	}{
+		{"public.projects", 1, 3, "AccessExclusiveLock"},
+		{"public.projects", 2, 3, "AccessExclusiveLock"},
+		{"transaction 1234", 5, 6, "ShareLock"},
+	}
+	for i, e := range expected {
+		conflict := conflicts[i]
+		if conflict.Object != e.object || conflict.HolderPID != e.holderPID || conflict.WaiterPID != e.waiterPID || conflict.WaiterMode != e.waiterMode {
+			t.Errorf("Expected %s held by %d and waited by %d in %s, got: %+v", e.object, e.holderPID, e.waiterPID, e.waiterMode, conflict)
+		}
+		if conflict.Recommendation == "" {
+			t.Error("Object conflict should have a recommendation")
 		}
 	}
+	if conflicts[0].HolderMode != "AccessShareLock" {
+		t.Errorf("Expected holder mode: AccessShareLock, got: %s", conflicts[0].HolderMode)
+	}
 }
 
 // Utility function to check if a string contains a substring
@@ -329,3 +459,32 @@ func contains(s, substr string) bool {
 func containsSubstring(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+// TestDetectBlockedTransactionsThreshold tests that waits shorter than the threshold are left out
+func TestDetectBlockedTransactionsThreshold(t *testing.T) {
+	locks := []LockInfo{
+		{PID: 2, Mode: "RowExclusiveLock", Granted: false, Object: "table1", WaitTime: 200 * time.Millisecond},
+		{PID: 3, Mode: "AccessShareLock", Granted: false, Object: "table1", WaitTime: 3 * time.Second},
+	}
+
+	blocked := detectBlockedTransactions(locks, nil, time.Second)
+
+	if len(blocked) != 1 || blocked[0].PID != 3 {
+		t.Errorf("Expected only PID 3 waiting for more than a second, got: %+v", blocked)
+	}
+}
+
+// TestGenerateSuggestionsLockCountThreshold tests the lock count above which general suggestions are made
+func TestGenerateSuggestionsLockCountThreshold(t *testing.T) {
+	data := &ReportData{Locks: make([]LockInfo, 5)}
+
+	opts := DefaultAnalyzerOptions()
+	if suggestions := generateSuggestions(data, opts); len(suggestions) != 0 {
+		t.Errorf("5 locks should not trigger suggestions with the default threshold, got: %v", suggestions)
+	}
+
+	opts.LockCountThreshold = 3
+	if suggestions := generateSuggestions(data, opts); len(suggestions) == 0 {
+		t.Error("5 locks should trigger suggestions above a threshold of 3")
+	}
+}
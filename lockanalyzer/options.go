@@ -0,0 +1,88 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"time"
+)
+
+// AnalyzerOptions contains the settings used to collect and analyze lock data
+type AnalyzerOptions struct {
+	// QueryTimeout bounds the duration of each collector (0 disables the timeout)
+	QueryTimeout time.Duration
+
+	// IncludeSchemas restricts the analysis to the schemas matching one of these glob patterns
+	// (e.g. "tenant_*"). All schemas are analyzed when empty.
+	IncludeSchemas []string
+
+	// ExcludeSchemas removes the schemas matching one of these glob patterns from the analysis
+	ExcludeSchemas []string
+
+	// LongTransactionThreshold is the duration after which an active query is reported as a long transaction
+	LongTransactionThreshold time.Duration
+
+	// LongWaitThreshold is the minimum lock wait reported as a blocked transaction (0 reports every wait)
+	LongWaitThreshold time.Duration
+
+	// IdleTransactionThreshold is the minimum time a session holding locks must have been idle in
+	// transaction to be reported (0 reports every such session)
+	IdleTransactionThreshold time.Duration
+
+	// PreparedTransactionThreshold is the age after which a transaction prepared for two-phase commit
+	// is reported as orphaned (0 reports every prepared transaction)
+	PreparedTransactionThreshold time.Duration
+
+	// LockCountThreshold is the number of locks above which general suggestions are made
+	LockCountThreshold int
+
+	// ConflictSampleInterval is the time between the two samples of pg_stat_database_conflicts taken
+	// on a standby to count the recovery conflicts happening meanwhile (0 takes a single sample).
+	// The samples are taken after the snapshot, each within QueryTimeout.
+	ConflictSampleInterval time.Duration
+
+	// Databases are the other databases of the server, as glob patterns ("*" for all of them),
+	// whose locked relations are resolved through a connection of their own (see NewClusterSource).
+	// pg_class only describes the relations of the current database: without it, the relations
+	// locked in other databases are reported by OID.
+	Databases []string
+
+	// RowLockTables are the tables whose locked rows are read with the pgrowlocks extension
+	// (e.g. "public.orders"). pgrowlocks scans the whole table, so only hot tables should be listed.
+	RowLockTables []string
+}
+
+// DefaultAnalyzerOptions returns the default analyzer settings
+func DefaultAnalyzerOptions() AnalyzerOptions {
+	return AnalyzerOptions{
+		QueryTimeout:                 10 * time.Second,
+		LongTransactionThreshold:     5 * time.Second,
+		PreparedTransactionThreshold: time.Minute,
+		LockCountThreshold:           10,
+		ConflictSampleInterval:       time.Second,
+	}
+}
+
+// Validate checks that the options can be used to generate a report
+func (o AnalyzerOptions) Validate() error {
+	if o.LongTransactionThreshold < 0 || o.LongWaitThreshold < 0 || o.IdleTransactionThreshold < 0 ||
+		o.PreparedTransactionThreshold < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if o.LockCountThreshold < 0 {
+		return fmt.Errorf("lock count threshold must not be negative")
+	}
+	if o.ConflictSampleInterval < 0 {
+		return fmt.Errorf("conflict sample interval must not be negative")
+	}
+	for _, table := range o.RowLockTables {
+		if table == "" {
+			return fmt.Errorf("row lock tables must not be empty")
+		}
+	}
+	if err := validatePatterns("schema", o.IncludeSchemas); err != nil {
+		return err
+	}
+	if err := validatePatterns("schema", o.ExcludeSchemas); err != nil {
+		return err
+	}
+	return validatePatterns("database", o.Databases)
+}
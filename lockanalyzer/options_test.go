@@ -0,0 +1,64 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDefaultAnalyzerOptions tests the default thresholds
+func TestDefaultAnalyzerOptions(t *testing.T) {
+	opts := DefaultAnalyzerOptions()
+
+	if opts.LongTransactionThreshold != 5*time.Second {
+		t.Errorf("Expected long transaction threshold: 5s, got: %v", opts.LongTransactionThreshold)
+	}
+	if opts.PreparedTransactionThreshold != time.Minute {
+		t.Errorf("Expected prepared transaction threshold: 1m, got: %v", opts.PreparedTransactionThreshold)
+	}
+	if opts.LockCountThreshold != 10 {
+		t.Errorf("Expected lock count threshold: 10, got: %d", opts.LockCountThreshold)
+	}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Default options should be valid, got: %v", err)
+	}
+}
+
+// TestAnalyzerOptionsValidate tests that negative thresholds are rejected
+func TestAnalyzerOptionsValidate(t *testing.T) {
+	opts := DefaultAnalyzerOptions()
+	opts.LongWaitThreshold = -time.Second
+	if err := opts.Validate(); err == nil {
+		t.Error("Negative wait threshold should be rejected")
+	}
+
+	opts = DefaultAnalyzerOptions()
+	opts.PreparedTransactionThreshold = -time.Minute
+	if err := opts.Validate(); err == nil {
+		t.Error("Negative prepared transaction threshold should be rejected")
+	}
+
+	opts = DefaultAnalyzerOptions()
+	opts.LockCountThreshold = -1
+	if err := opts.Validate(); err == nil {
+		t.Error("Negative lock count threshold should be rejected")
+	}
+
+	opts = DefaultAnalyzerOptions()
+	opts.RowLockTables = []string{"public.orders", ""}
+	if err := opts.Validate(); err == nil {
+		t.Error("Empty row lock table should be rejected")
+	}
+
+	opts = DefaultAnalyzerOptions()
+	opts.ConflictSampleInterval = -time.Second
+	if err := opts.Validate(); err == nil {
+		t.Error("Negative conflict sample interval should be rejected")
+	}
+
+	// The conflict samples are taken apart from the collector timeouts
+	opts = DefaultAnalyzerOptions()
+	opts.QueryTimeout = 500 * time.Millisecond
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Conflict sample interval longer than the query timeout should be accepted, got: %v", err)
+	}
+}
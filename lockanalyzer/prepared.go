@@ -0,0 +1,179 @@
+package lockanalyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbouamriou/lock-analyzer/lockmodes"
+
+	"github.com/uptrace/bun"
+)
+
+// A transaction prepared for two-phase commit (PREPARE TRANSACTION) is detached from its session:
+// it keeps its locks until COMMIT PREPARED or ROLLBACK PREPARED, even across server restarts, and
+// never shows up in pg_stat_activity. Its locks are listed in pg_locks with a NULL pid and a
+// virtual transaction of the form -1/<xid>. When the transaction manager that prepared it is gone,
+// nothing will ever release them.
+
+// preparedState is the state given to the locks held by a prepared transaction
+const preparedState = "prepared"
+
+// PreparedTransaction contains information about a transaction prepared for two-phase commit
+type PreparedTransaction struct {
+	GID           string
+	TransactionID string
+	Owner         string
+	Database      string
+	Prepared      time.Time
+	// Age is the time elapsed since the transaction was prepared, at the report timestamp
+	Age   time.Duration
+	Locks []LockInfo
+	// BlockedSessions is the number of sessions waiting for a lock conflicting with its locks
+	BlockedSessions int
+}
+
+// Remediation tells how to release the locks of the prepared transaction
+func (t PreparedTransaction) Remediation() string {
+	gid := strings.ReplaceAll(t.GID, "'", "''")
+	return fmt.Sprintf("Check with the transaction manager whether it must be committed, then run "+
+		"COMMIT PREPARED '%s' or ROLLBACK PREPARED '%s' as %s in database %s", gid, gid, t.Owner, t.Database)
+}
+
+// getPreparedXactRows retrieves the rows of pg_prepared_xacts
+func getPreparedXactRows(ctx context.Context, db bun.IDB) ([]PreparedXactRow, error) {
+	query := `
+		SELECT
+			transaction::text,
+			gid,
+			prepared,
+			owner,
+			database
+		FROM pg_prepared_xacts
+		ORDER BY prepared
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var preparedXacts []PreparedXactRow
+	for rows.Next() {
+		var row PreparedXactRow
+		if err := rows.Scan(&row.TransactionID, &row.GID, &row.Prepared, &row.Owner, &row.Database); err != nil {
+			continue
+		}
+		preparedXacts = append(preparedXacts, row)
+	}
+
+	return preparedXacts, rows.Err()
+}
+
+// preparedTransactionID returns the transaction ID of the prepared transaction holding a lock,
+// or an empty string when the lock is held by a backend
+func preparedTransactionID(row LockRow) string {
+	if row.PID != 0 {
+		return ""
+	}
+	backend, xid, ok := strings.Cut(row.VirtualTransaction, "/")
+	if !ok || backend != "-1" {
+		return ""
+	}
+	return xid
+}
+
+// preparedNode returns the wait graph node standing for a prepared transaction. Having no backend,
+// it is identified by its transaction ID, negated not to clash with a PID.
+func preparedNode(xid string) int {
+	id, err := strconv.Atoi(xid)
+	if err != nil {
+		return 0
+	}
+	return -id
+}
+
+// lockNode returns the wait graph node of the holder of a lock: its backend, or its prepared transaction
+func lockNode(lock LockInfo) int {
+	if lock.PreparedTransactionID != "" {
+		return preparedNode(lock.PreparedTransactionID)
+	}
+	return lock.PID
+}
+
+// preparedBlockers returns the wait graph nodes of the prepared transactions holding a lock
+// conflicting with the one a backend waits for
+func preparedBlockers(locks []LockInfo, pid int) []int {
+	waiting := waitingLock(locks, pid)
+	if waiting.Mode == "" {
+		return nil
+	}
+
+	var nodes []int
+	for _, lock := range locks {
+		if lock.PreparedTransactionID == "" || !lock.Granted || lockTag(lock) != lockTag(waiting) {
+			continue
+		}
+		if lockmodes.ModesConflict(lock.Mode, waiting.Mode) && !containsPID(nodes, lockNode(lock)) {
+			nodes = append(nodes, lockNode(lock))
+		}
+	}
+	return nodes
+}
+
+// detectPreparedTransactions lists the transactions prepared for at least threshold, with the locks
+// they hold, the ones blocking the most sessions first
+func detectPreparedTransactions(preparedXacts []PreparedXactRow, locks []LockInfo, timestamp time.Time, threshold time.Duration) []PreparedTransaction {
+	var preparedTxns []PreparedTransaction
+	for _, row := range preparedXacts {
+		txn := PreparedTransaction{
+			GID:           row.GID,
+			TransactionID: row.TransactionID,
+			Owner:         row.Owner,
+			Database:      row.Database,
+			Prepared:      row.Prepared,
+		}
+		if timestamp.After(row.Prepared) {
+			txn.Age = timestamp.Sub(row.Prepared)
+		}
+		if txn.Age < threshold {
+			continue
+		}
+
+		held := make(map[string][]LockInfo)
+		for _, lock := range locks {
+			if lock.PreparedTransactionID == row.TransactionID && lock.Granted {
+				txn.Locks = append(txn.Locks, lock)
+				held[lockTag(lock)] = append(held[lockTag(lock)], lock)
+			}
+		}
+
+		blocked := make(map[int]bool)
+		for _, lock := range locks {
+			if lock.Granted {
+				continue
+			}
+			for _, holder := range held[lockTag(lock)] {
+				if lockmodes.ModesConflict(holder.Mode, lock.Mode) {
+					blocked[lock.PID] = true
+				}
+			}
+		}
+		txn.BlockedSessions = len(blocked)
+
+		preparedTxns = append(preparedTxns, txn)
+	}
+
+	sort.SliceStable(preparedTxns, func(i, j int) bool {
+		if preparedTxns[i].BlockedSessions != preparedTxns[j].BlockedSessions {
+			return preparedTxns[i].BlockedSessions > preparedTxns[j].BlockedSessions
+		}
+		return preparedTxns[i].Age > preparedTxns[j].Age
+	})
+
+	return preparedTxns
+}
@@ -0,0 +1,127 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDetectPreparedTransactions tests that prepared transactions are reported with their locks
+// and the sessions they block
+func TestDetectPreparedTransactions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		Timestamp: now,
+		Relations: []RelationRow{{OID: 16400, Schema: "public", Name: "orders", Kind: "r"}},
+		Locks: []LockRow{
+			{LockType: "relation", Relation: 16400, VirtualTransaction: "-1/777", Mode: "RowExclusiveLock", Granted: true},
+			{LockType: "transactionid", TransactionID: "777", VirtualTransaction: "-1/777", Mode: "ExclusiveLock", Granted: true},
+			{LockType: "relation", Relation: 16400, VirtualTransaction: "-1/888", Mode: "AccessShareLock", Granted: true},
+			// PID 5 waits for the row updated by the first prepared transaction, PID 6 for the table
+			{PID: 5, LockType: "transactionid", TransactionID: "777", VirtualTransaction: "5/10", Mode: "ShareLock", Granted: false},
+			{PID: 6, LockType: "relation", Relation: 16400, VirtualTransaction: "6/3", Mode: "AccessExclusiveLock", Granted: false},
+		},
+		PreparedXacts: []PreparedXactRow{
+			{TransactionID: "888", GID: "recent", Prepared: now.Add(-time.Hour), Owner: "app", Database: "shop"},
+			{TransactionID: "777", GID: "order-42", Prepared: now.Add(-48 * time.Hour), Owner: "app", Database: "shop"},
+			{TransactionID: "999", GID: "just-prepared", Prepared: now.Add(-time.Second), Owner: "app", Database: "shop"},
+		},
+	}
+
+	locks := buildLocks(snapshot)
+	if locks[0].PreparedTransactionID == "" || locks[0].State != preparedState || locks[0].Username != "app" {
+		t.Errorf("Locks of prepared transactions should be attributed, got: %+v", locks[0])
+	}
+
+	txns := detectPreparedTransactions(snapshot.PreparedXacts, locks, now, 5*time.Second)
+
+	if len(txns) != 2 {
+		t.Fatalf("Expected 2 prepared transactions older than the threshold, got: %+v", txns)
+	}
+	txn := txns[0]
+	if txn.GID != "order-42" || txn.Age != 48*time.Hour || len(txn.Locks) != 2 || txn.BlockedSessions != 2 {
+		t.Errorf("Expected order-42 holding 2 locks and blocking 2 sessions first, got: %+v", txn)
+	}
+	if txns[1].GID != "recent" || len(txns[1].Locks) != 1 || txns[1].BlockedSessions != 1 {
+		t.Errorf("Expected recent blocking the AccessExclusiveLock, got: %+v", txns[1])
+	}
+
+	txn.GID = "it's"
+	expected := "Check with the transaction manager whether it must be committed, then run " +
+		"COMMIT PREPARED 'it''s' or ROLLBACK PREPARED 'it''s' as app in database shop"
+	if txn.Remediation() != expected {
+		t.Errorf("Unexpected remediation: %s", txn.Remediation())
+	}
+}
+
+// TestPreparedTransactionBlockingTrees tests that each prepared transaction is a node of its own
+// in the wait graph, so that each blocking tree names its GID
+func TestPreparedTransactionBlockingTrees(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		Timestamp: now,
+		Relations: []RelationRow{{OID: 16400, Schema: "public", Name: "orders", Kind: "r"}},
+		Locks: []LockRow{
+			{LockType: "transactionid", TransactionID: "777", VirtualTransaction: "-1/777", Mode: "ExclusiveLock", Granted: true},
+			{LockType: "relation", Relation: 16400, VirtualTransaction: "-1/888", Mode: "AccessShareLock", Granted: true},
+			{LockType: "relation", Relation: 16400, VirtualTransaction: "-1/999", Mode: "RowExclusiveLock", Granted: true},
+			{PID: 5, LockType: "transactionid", TransactionID: "777", VirtualTransaction: "5/10", Mode: "ShareLock", Granted: false},
+			{PID: 6, LockType: "relation", Relation: 16400, VirtualTransaction: "6/3", Mode: "AccessExclusiveLock", Granted: false},
+		},
+		Activity: []ActivityRow{
+			{PID: 5, State: "active", BlockingPIDs: []int{0}},
+			{PID: 6, State: "active", BlockingPIDs: []int{0}},
+		},
+		PreparedXacts: []PreparedXactRow{
+			{TransactionID: "777", GID: "order-42", Prepared: now.Add(-48 * time.Hour), Owner: "app", Database: "shop"},
+			{TransactionID: "888", GID: "report", Prepared: now.Add(-time.Hour), Owner: "app", Database: "shop"},
+			{TransactionID: "999", GID: "invoice-7", Prepared: now.Add(-time.Hour), Owner: "app", Database: "shop"},
+		},
+	}
+
+	locks := buildLocks(snapshot)
+	graph := buildWaitGraph(snapshot.Activity, locks)
+	if blockers := graph.BlockersOf(5); len(blockers) != 1 || blockers[0] != -777 {
+		t.Errorf("Expected PID 5 to wait for prepared transaction 777 alone, got: %v", blockers)
+	}
+	if blockers := graph.BlockersOf(6); len(blockers) != 2 || !containsPID(blockers, -888) || !containsPID(blockers, -999) {
+		t.Errorf("Expected PID 6 to wait for prepared transactions 888 and 999, got: %v", blockers)
+	}
+
+	trees := detectBlockingTrees(graph, locks)
+	gids := make(map[string]int)
+	for _, tree := range trees {
+		if len(tree.Root.Waiters) != 1 {
+			t.Errorf("Expected a single waiter under %s, got: %+v", tree.Root.GID, tree.Root.Waiters)
+			continue
+		}
+		gids[tree.Root.GID] = tree.Root.Waiters[0].PID
+	}
+	if len(trees) != 3 || gids["order-42"] != 5 || gids["report"] != 6 || gids["invoice-7"] != 6 {
+		t.Errorf("Expected a tree per prepared transaction, got: %+v", trees)
+	}
+
+	// Without the locks of the prepared transactions, the waits are kept on PID 0
+	graph = buildWaitGraph(snapshot.Activity, nil)
+	if blockers := graph.BlockersOf(5); len(blockers) != 1 || blockers[0] != 0 {
+		t.Errorf("Expected PID 5 to wait for PID 0, got: %v", blockers)
+	}
+}
+
+// TestPreparedTransactionID tests the recognition of the locks held by prepared transactions
+func TestPreparedTransactionID(t *testing.T) {
+	tests := []struct {
+		row      LockRow
+		expected string
+	}{
+		{LockRow{VirtualTransaction: "-1/777"}, "777"},
+		{LockRow{PID: 12, VirtualTransaction: "3/45"}, ""},
+		// Predicate locks of committed serializable transactions have no PID either
+		{LockRow{Mode: predicateLockMode}, ""},
+	}
+
+	for _, test := range tests {
+		if xid := preparedTransactionID(test.row); xid != test.expected {
+			t.Errorf("preparedTransactionID(%+v) = %q, expected %q", test.row, xid, test.expected)
+		}
+	}
+}
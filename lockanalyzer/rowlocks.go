@@ -0,0 +1,225 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pbouamriou/lock-analyzer/lockmodes"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// PostgreSQL stores row locks in the header of the locked tuples: pg_locks only shows the tuple
+// locks taken while waiting for a row, not the rows locked by SELECT ... FOR UPDATE/SHARE or by
+// updates. The pgrowlocks extension reads them from the tuple headers. It scans the whole table,
+// so it is only run on the tables listed in AnalyzerOptions.RowLockTables.
+
+// errPgRowLocksMissing is returned when row locks are requested without the pgrowlocks extension
+var errPgRowLocksMissing = errors.New("the pgrowlocks extension is not installed (CREATE EXTENSION pgrowlocks)")
+
+// getPgRowLocks scans the given tables with pgrowlocks, returning the qualified names of the
+// scanned tables along with their locked rows. A table that cannot be scanned does not stop the
+// scan of the others, and the errors of all the tables are returned joined.
+func getPgRowLocks(ctx context.Context, db bun.IDB, tables []string) ([]string, []RowLockRow, error) {
+	var scanned []string
+	var rowLocks []RowLockRow
+	var errs []error
+	for _, table := range tables {
+		name, rows, err := scanRowLocks(ctx, db, table)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scanned = append(scanned, name)
+		rowLocks = append(rowLocks, rows...)
+	}
+
+	return scanned, rowLocks, errors.Join(errs...)
+}
+
+// scanRowLocks returns the qualified name of a table along with its locked rows. Inside a
+// transaction, the table is scanned in a savepoint so that its failure does not abort the
+// transaction for the next tables.
+func scanRowLocks(ctx context.Context, db bun.IDB, table string) (string, []RowLockRow, error) {
+	tx, ok := db.(bun.Tx)
+	if !ok {
+		return lookupRowLocks(ctx, db, table)
+	}
+
+	savepoint, err := tx.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	name, rows, err := lookupRowLocks(ctx, savepoint, table)
+	if err != nil {
+		_ = savepoint.Rollback()
+		return "", nil, err
+	}
+	return name, rows, savepoint.Commit()
+}
+
+// lookupRowLocks resolves a table name and returns its qualified name along with its locked rows
+func lookupRowLocks(ctx context.Context, db bun.IDB, table string) (string, []RowLockRow, error) {
+	var oid int64
+	var schema, name string
+	err := db.QueryRowContext(ctx, `
+		SELECT c.oid, n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = to_regclass(?)
+	`, table).Scan(&oid, &schema, &name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, fmt.Errorf("table %s does not exist", table)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("table %s: %v", table, err)
+	}
+
+	rows, err := getTableRowLocks(ctx, db, oid, schema, name)
+	if err != nil {
+		return "", nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	return qualifiedName(schema, name), rows, nil
+}
+
+// getTableRowLocks returns the locked rows of a table
+func getTableRowLocks(ctx context.Context, db bun.IDB, oid int64, schema, name string) ([]RowLockRow, error) {
+	query := `
+		SELECT
+			locked_row::text,
+			locker::text,
+			multi,
+			xids::text[],
+			modes,
+			pids
+		FROM pgrowlocks(?::regclass::text)
+	`
+
+	rows, err := db.QueryContext(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rowLocks []RowLockRow
+	for rows.Next() {
+		row := RowLockRow{Schema: schema, Table: name}
+		var pids []int64
+
+		err := rows.Scan(&row.LockedRow, &row.Locker, &row.Multi,
+			pgdialect.Array(&row.XIDs), pgdialect.Array(&row.Modes), pgdialect.Array(&pids))
+		if err != nil {
+			continue
+		}
+		for _, pid := range pids {
+			row.PIDs = append(row.PIDs, int(pid))
+		}
+
+		rowLocks = append(rowLocks, row)
+	}
+
+	return rowLocks, rows.Err()
+}
+
+// buildRowLocks returns the page and tuple locks of pg_locks along with the rows locked in the
+// tables scanned with pgrowlocks, one entry per locking transaction. For the scanned tables, the
+// granted tuple locks of pg_locks are left out: they are held by the first backend waiting for
+// a row, not by the transactions locking it.
+func buildRowLocks(locks []LockInfo, snapshot *Snapshot) []RowLockInfo {
+	// pgrowlocks runs in the current database, unknown in the snapshots saved before databases were
+	_, current := databaseNames(snapshot.Databases)
+	scanned := make(map[string]bool, len(snapshot.RowLockTables))
+	for _, table := range snapshot.RowLockTables {
+		scanned[table] = true
+	}
+
+	var rowLocks []RowLockInfo
+	for _, lock := range locks {
+		if lock.Page == "" || (lock.Granted && scanned[lock.ObjectName] && (current == "" || lock.Database == current)) {
+			continue
+		}
+		rowLocks = append(rowLocks, RowLockInfo{
+			PID:      lock.PID,
+			Database: lock.Database,
+			Schema:   lock.Schema,
+			Table:    lock.ObjectName,
+			Page:     lock.Page,
+			Tuple:    lock.Tuple,
+			Mode:     lock.Mode,
+			Granted:  lock.Granted,
+		})
+	}
+
+	for _, row := range snapshot.RowLocks {
+		page, tuple := parseTID(row.LockedRow)
+		for i, xid := range row.XIDs {
+			rowLock := RowLockInfo{
+				Database:      current,
+				Schema:        row.Schema,
+				Table:         qualifiedName(row.Schema, row.Table),
+				Page:          page,
+				Tuple:         tuple,
+				Granted:       true,
+				TransactionID: xid,
+			}
+			if i < len(row.Modes) {
+				rowLock.Mode = row.Modes[i]
+				rowLock.BlockedModes = blockedRowModes(row.Modes[i])
+			}
+			if i < len(row.PIDs) {
+				rowLock.PID = row.PIDs[i]
+			}
+			if row.Multi {
+				rowLock.MultiXactID = row.Locker
+			}
+			rowLocks = append(rowLocks, rowLock)
+		}
+	}
+
+	sort.SliceStable(rowLocks, func(i, j int) bool {
+		if rowLocks[i].Database != rowLocks[j].Database {
+			return rowLocks[i].Database < rowLocks[j].Database
+		}
+		return rowLocks[i].Table < rowLocks[j].Table
+	})
+
+	return rowLocks
+}
+
+// blockedRowModes returns the row-level modes conflicting with the mode of a row lock read with
+// pgrowlocks, from the weakest to the strongest
+func blockedRowModes(name string) []string {
+	mode, err := lockmodes.ParseRowMode(name)
+	if err != nil {
+		return nil
+	}
+	var blocked []string
+	for other := lockmodes.ForKeyShare; other <= lockmodes.ForUpdate; other++ {
+		if lockmodes.RowConflicts(mode, other) {
+			blocked = append(blocked, other.String())
+		}
+	}
+	return blocked
+}
+
+// blocksForeignKeyChecks reports whether rows are locked with SELECT ... FOR UPDATE, which also
+// blocks the FOR KEY SHARE locks of foreign key checks, rather than by an update of their key
+func blocksForeignKeyChecks(rowLocks []RowLockInfo) bool {
+	for _, rowLock := range rowLocks {
+		mode, err := lockmodes.ParseRowMode(rowLock.Mode)
+		if err == nil && strings.HasPrefix(rowLock.Mode, "For ") && lockmodes.RowConflicts(mode, lockmodes.ForKeyShare) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTID splits a tuple identifier such as (12,4) into its page and tuple numbers
+func parseTID(tid string) (string, string) {
+	page, tuple, _ := strings.Cut(strings.Trim(tid, "()"), ",")
+	return page, tuple
+}
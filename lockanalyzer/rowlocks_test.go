@@ -0,0 +1,89 @@
+package lockanalyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestBuildRowLocks tests that the rows read with pgrowlocks are merged with the tuple locks of pg_locks
+func TestBuildRowLocks(t *testing.T) {
+	locks := []LockInfo{
+		// First waiter for a row of a scanned table, and the session queued behind it
+		{PID: 2, Type: "tuple", Schema: "public", ObjectName: "public.orders", Page: "0", Tuple: "1", Mode: "ExclusiveLock", Granted: true},
+		{PID: 3, Type: "tuple", Schema: "public", ObjectName: "public.orders", Page: "0", Tuple: "1", Mode: "ExclusiveLock", Granted: false},
+		// Tuple lock of a table that was not scanned
+		{PID: 4, Type: "tuple", Schema: "public", ObjectName: "public.files", Page: "3", Tuple: "9", Mode: "ExclusiveLock", Granted: true},
+	}
+	snapshot := &Snapshot{
+		RowLockTables: []string{"public.orders"},
+		RowLocks: []RowLockRow{
+			{Schema: "public", Table: "orders", LockedRow: "(0,1)", Locker: "5", Multi: true,
+				XIDs: []string{"750", "751"}, Modes: []string{"For Key Share", "For Share"}, PIDs: []int{1, 6}},
+			{Schema: "public", Table: "orders", LockedRow: "(0,2)", Locker: "752",
+				XIDs: []string{"752"}, Modes: []string{"For Update"}, PIDs: []int{7}},
+		},
+	}
+
+	rowLocks := buildRowLocks(locks, snapshot)
+
+	if len(rowLocks) != 5 {
+		t.Fatalf("Expected 5 row locks, got: %+v", rowLocks)
+	}
+	if rowLocks[0].Table != "public.files" || rowLocks[0].PID != 4 {
+		t.Errorf("Expected the tuple lock of the unscanned table first, got: %+v", rowLocks[0])
+	}
+	if rowLocks[1].PID != 3 || rowLocks[1].Granted {
+		t.Errorf("Expected the waiting tuple lock of PID 3, got: %+v", rowLocks[1])
+	}
+	for _, rowLock := range rowLocks {
+		if rowLock.PID == 2 {
+			t.Errorf("Granted tuple lock of a scanned table should be left out, got: %+v", rowLock)
+		}
+	}
+
+	shared := rowLocks[3]
+	if shared.PID != 6 || shared.Page != "0" || shared.Tuple != "1" || shared.Mode != "For Share" ||
+		shared.TransactionID != "751" || shared.MultiXactID != "5" || !shared.Granted {
+		t.Errorf("Expected row (0,1) shared by PID 6 through multixact 5, got: %+v", shared)
+	}
+	if rowLocks[4].MultiXactID != "" || rowLocks[4].Mode != "For Update" || rowLocks[4].Tuple != "2" {
+		t.Errorf("Expected row (0,2) locked FOR UPDATE by a single transaction, got: %+v", rowLocks[4])
+	}
+
+	// The conflicting row modes tell which lock requests wait for each row
+	if !reflect.DeepEqual(rowLocks[2].BlockedModes, []string{"FOR UPDATE"}) {
+		t.Errorf("Expected FOR KEY SHARE to only block FOR UPDATE, got: %v", rowLocks[2].BlockedModes)
+	}
+	if !reflect.DeepEqual(shared.BlockedModes, []string{"FOR NO KEY UPDATE", "FOR UPDATE"}) {
+		t.Errorf("Expected FOR SHARE to block the updates, got: %v", shared.BlockedModes)
+	}
+	if len(rowLocks[4].BlockedModes) != 4 || rowLocks[0].BlockedModes != nil {
+		t.Errorf("Expected FOR UPDATE to block every row lock and tuple locks no mode, got: %v, %v",
+			rowLocks[4].BlockedModes, rowLocks[0].BlockedModes)
+	}
+	if !blocksForeignKeyChecks(rowLocks) || blocksForeignKeyChecks(rowLocks[:4]) {
+		t.Error("Expected only the row locked FOR UPDATE to block foreign key checks")
+	}
+	if blocksForeignKeyChecks([]RowLockInfo{{Mode: "Update"}}) {
+		t.Error("Expected an update of the key not to be reported as a FOR UPDATE lock")
+	}
+}
+
+// TestRowLocksCollectorWithoutExtension tests that the extensions already collected tell that
+// pgrowlocks is missing, without querying the server
+func TestRowLocksCollectorWithoutExtension(t *testing.T) {
+	opts := DefaultAnalyzerOptions()
+	opts.RowLockTables = []string{"public.orders"}
+	snapshot := &Snapshot{Extensions: map[string]string{"pg_stat_statements": "1.10"}}
+
+	for _, c := range collectors {
+		if c.name == "row_locks" {
+			runCollector(context.Background(), nil, opts, snapshot, c)
+		}
+	}
+
+	if len(snapshot.CollectorErrors) != 1 || snapshot.CollectorErrors[0].Error != errPgRowLocksMissing.Error() {
+		t.Errorf("Expected the missing extension to be reported once, got: %+v", snapshot.CollectorErrors)
+	}
+}
@@ -0,0 +1,162 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RowWait is the row a backend waits for when its lock wait is on a transaction ID or a tuple.
+//
+// A backend updating or locking a row already modified by another transaction takes a tuple lock
+// on the row, then waits for a ShareLock on the transaction ID of the modifying transaction.
+// The next backends wanting the same row wait for the tuple lock of the first one. pg_locks only
+// shows the transaction ID wait, so the row is recovered from the tuple locks of the waiters.
+type RowWait struct {
+	Schema string
+	// Table is the schema-qualified table, empty when the row could not be located
+	Table         string
+	Page          string
+	Tuple         string
+	TransactionID string
+	// HolderPID is the backend of the transaction that modified or locked the row
+	HolderPID   int
+	HolderQuery string
+}
+
+// String describes the row wait (e.g. row (0,1) of public.projects held by PID 42)
+func (w RowWait) String() string {
+	row := "row"
+	if w.Page != "" && w.Tuple != "" {
+		row = fmt.Sprintf("row (%s,%s)", w.Page, w.Tuple)
+	}
+	if w.Table != "" {
+		row += " of " + w.Table
+	}
+	if w.HolderPID == 0 {
+		return row + " modified by transaction " + w.TransactionID
+	}
+	return row + " held by PID " + strconv.Itoa(w.HolderPID)
+}
+
+// resolveRowWaits sets the row waited for on the transactionid and tuple locks that are not granted.
+// tables lists the locked relations that can hold rows, by tableTag.
+func resolveRowWaits(locks []LockInfo, tables map[string]bool) {
+	xidHolders := make(map[string]LockInfo)
+	xidWaits := make(map[int]string)
+	tupleHolders := make(map[string]int)
+	for _, lock := range locks {
+		switch {
+		case lock.Type == "transactionid" && lock.Granted && lock.Mode == "ExclusiveLock":
+			xidHolders[lock.TransactionID] = lock
+		case lock.Type == "transactionid" && !lock.Granted:
+			xidWaits[lock.PID] = lock.TransactionID
+		case lock.Type == "tuple" && lock.Granted:
+			tupleHolders[tupleTag(lock)] = lock.PID
+		}
+	}
+
+	for i, lock := range locks {
+		if lock.Granted {
+			continue
+		}
+
+		var wait RowWait
+		switch lock.Type {
+		case "transactionid":
+			wait.TransactionID = lock.TransactionID
+			if tuple, ok := heldTupleLock(locks, lock.PID); ok {
+				wait.Schema, wait.Table, wait.Page, wait.Tuple = tuple.Schema, tuple.Object, tuple.Page, tuple.Tuple
+			} else if relation, ok := modifiedRelation(locks, tables, lock.PID, xidHolders[lock.TransactionID].PID); ok {
+				wait.Schema, wait.Table = relation.Schema, relation.Object
+			}
+		case "tuple":
+			// The backend queues behind the first waiter, which waits for the modifying transaction
+			wait.Schema, wait.Table, wait.Page, wait.Tuple = lock.Schema, lock.Object, lock.Page, lock.Tuple
+			firstWaiter, ok := tupleHolders[tupleTag(lock)]
+			if !ok {
+				continue
+			}
+			wait.TransactionID = xidWaits[firstWaiter]
+			if wait.TransactionID == "" {
+				wait.HolderPID = firstWaiter
+			}
+		default:
+			continue
+		}
+
+		if holder, ok := xidHolders[wait.TransactionID]; ok && wait.TransactionID != "" {
+			wait.HolderPID = holder.PID
+			wait.HolderQuery = holder.Query
+		} else if wait.HolderPID != 0 {
+			wait.HolderQuery = sessionQuery(locks, wait.HolderPID)
+		}
+
+		locks[i].RowWait = &wait
+	}
+}
+
+// tupleTag identifies the row of a tuple lock
+func tupleTag(lock LockInfo) string {
+	return tableTag(lock.DatabaseOID, lock.Object) + "/" + lock.Page + "/" + lock.Tuple
+}
+
+// tableTag identifies a relation among the relations of every database
+func tableTag(database uint32, name string) string {
+	return strconv.FormatUint(uint64(database), 10) + "/" + name
+}
+
+// heldTupleLock returns the tuple lock held by a backend, when it holds exactly one
+func heldTupleLock(locks []LockInfo, pid int) (LockInfo, bool) {
+	var found []LockInfo
+	for _, lock := range locks {
+		if lock.PID == pid && lock.Type == "tuple" && lock.Granted {
+			found = append(found, lock)
+		}
+	}
+	if len(found) != 1 {
+		return LockInfo{}, false
+	}
+	return found[0], true
+}
+
+// modifiedRelation returns the table locked for row changes by both the waiter and the holder,
+// when there is exactly one: without tuple lock (e.g. when waiting for a unique key inserted by
+// another transaction), it is the only table the row can belong to
+func modifiedRelation(locks []LockInfo, tables map[string]bool, waiterPID, holderPID int) (LockInfo, bool) {
+	if holderPID == 0 {
+		return LockInfo{}, false
+	}
+
+	holderRelations := make(map[string]bool)
+	for _, lock := range locks {
+		if lock.PID == holderPID && lock.Type == "relation" && isRowLevelMode(lock.Mode) && tables[tableTag(lock.DatabaseOID, lock.Object)] {
+			holderRelations[tableTag(lock.DatabaseOID, lock.Object)] = true
+		}
+	}
+
+	var found []LockInfo
+	for _, lock := range locks {
+		if lock.PID == waiterPID && lock.Type == "relation" && isRowLevelMode(lock.Mode) && holderRelations[tableTag(lock.DatabaseOID, lock.Object)] {
+			found = append(found, lock)
+		}
+	}
+	if len(found) != 1 {
+		return LockInfo{}, false
+	}
+	return found[0], true
+}
+
+// isRowLevelMode reports whether a relation lock mode is taken to lock or modify rows
+func isRowLevelMode(mode string) bool {
+	return mode == "RowShareLock" || mode == "RowExclusiveLock"
+}
+
+// sessionQuery returns the query of a backend from its locks
+func sessionQuery(locks []LockInfo, pid int) string {
+	for _, lock := range locks {
+		if lock.PID == pid {
+			return lock.Query
+		}
+	}
+	return ""
+}
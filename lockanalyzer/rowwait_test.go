@@ -0,0 +1,83 @@
+package lockanalyzer
+
+import "testing"
+
+// TestResolveRowWaits tests that transactionid and tuple waits are resolved to the row and its holder
+func TestResolveRowWaits(t *testing.T) {
+	tables := map[string]bool{"public.models": true}
+	locks := []LockInfo{
+		// PID 1 updated the row and is idle in transaction
+		{PID: 1, Type: "relation", Object: "public.models", Schema: "public", Mode: "RowExclusiveLock", Granted: true, Query: "UPDATE models SET state = 'a'"},
+		{PID: 1, Type: "relation", Object: "public.models_pkey", Schema: "public", Mode: "RowExclusiveLock", Granted: true, Query: "UPDATE models SET state = 'a'"},
+		{PID: 1, Type: "transactionid", Object: "N/A", TransactionID: "1234", Mode: "ExclusiveLock", Granted: true, Query: "UPDATE models SET state = 'a'"},
+		// PID 2 holds the tuple lock and waits for the transaction of PID 1
+		{PID: 2, Type: "relation", Object: "public.models", Schema: "public", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 2, Type: "tuple", Object: "public.models", Schema: "public", Page: "0", Tuple: "3", Mode: "ExclusiveLock", Granted: true},
+		{PID: 2, Type: "transactionid", Object: "N/A", TransactionID: "1234", Mode: "ShareLock", Granted: false},
+		// PID 3 queues behind PID 2 for the tuple lock
+		{PID: 3, Type: "relation", Object: "public.models", Schema: "public", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 3, Type: "tuple", Object: "public.models", Schema: "public", Page: "0", Tuple: "3", Mode: "ExclusiveLock", Granted: false},
+	}
+
+	resolveRowWaits(locks, tables)
+
+	for _, i := range []int{5, 7} {
+		wait := locks[i].RowWait
+		if wait == nil {
+			t.Fatalf("Row wait of PID %d should be resolved", locks[i].PID)
+		}
+		if wait.Table != "public.models" || wait.Schema != "public" || wait.Page != "0" || wait.Tuple != "3" {
+			t.Errorf("Expected row (0,3) of public.models, got: %+v", wait)
+		}
+		if wait.HolderPID != 1 || wait.HolderQuery != "UPDATE models SET state = 'a'" || wait.TransactionID != "1234" {
+			t.Errorf("Expected row held by PID 1, got: %+v", wait)
+		}
+		if wait.String() != "row (0,3) of public.models held by PID 1" {
+			t.Errorf("Unexpected description: %s", wait.String())
+		}
+	}
+
+	for i, lock := range locks {
+		if lock.Granted && lock.RowWait != nil {
+			t.Errorf("Granted lock %d should not have a row wait", i)
+		}
+	}
+	if locks[5].Target() != "row (0,3) of public.models held by PID 1" {
+		t.Errorf("Expected the row as target, got: %s", locks[5].Target())
+	}
+}
+
+// TestResolveRowWaitsWithoutTupleLock tests a wait for a unique key inserted by another transaction,
+// where only the tables locked by both transactions locate the row
+func TestResolveRowWaitsWithoutTupleLock(t *testing.T) {
+	tables := map[string]bool{tableTag(0, "public.models"): true, tableTag(0, "public.files"): true}
+	locks := []LockInfo{
+		{PID: 1, Type: "relation", Object: "public.models", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 1, Type: "relation", Object: "public.models_pkey", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 1, Type: "relation", Object: "public.files", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 1, Type: "transactionid", TransactionID: "1234", Mode: "ExclusiveLock", Granted: true},
+		{PID: 2, Type: "relation", Object: "public.models", Schema: "public", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 2, Type: "relation", Object: "public.models_pkey", Mode: "RowExclusiveLock", Granted: true},
+		{PID: 2, Type: "transactionid", TransactionID: "1234", Mode: "ShareLock", Granted: false},
+	}
+
+	resolveRowWaits(locks, tables)
+
+	wait := locks[6].RowWait
+	if wait == nil || wait.Table != "public.models" || wait.Page != "" || wait.HolderPID != 1 {
+		t.Fatalf("Expected a row of public.models held by PID 1, got: %+v", wait)
+	}
+	if wait.String() != "row of public.models held by PID 1" {
+		t.Errorf("Unexpected description: %s", wait.String())
+	}
+
+	// With two candidate tables, the row cannot be located but the holder is known
+	locks[6].RowWait = nil
+	locks = append(locks, LockInfo{PID: 2, Type: "relation", Object: "public.files", Mode: "RowExclusiveLock", Granted: true})
+	resolveRowWaits(locks, tables)
+
+	wait = locks[6].RowWait
+	if wait == nil || wait.Table != "" || wait.HolderPID != 1 {
+		t.Errorf("Expected an unlocated row held by PID 1, got: %+v", wait)
+	}
+}
@@ -0,0 +1,198 @@
+package lockanalyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// qualifiedName returns the schema-qualified name of a relation, each part quoted when needed so
+// that names containing dots or upper case letters cannot be mistaken for other objects
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return quoteIdent(name)
+	}
+	return quoteIdent(schema) + "." + quoteIdent(name)
+}
+
+// quotedKeywords are the keywords quote_ident quotes, all but the unreserved ones (PostgreSQL 17)
+var quotedKeywords = wordSet(`
+	all analyse analyze and any array as asc asymmetric authorization between bigint binary bit
+	boolean both case cast char character check coalesce collate collation column concurrently
+	constraint create cross current_catalog current_date current_role current_schema current_time
+	current_timestamp current_user dec decimal default deferrable desc distinct do else end except
+	exists extract false fetch float for foreign freeze from full grant greatest group grouping
+	having ilike in initially inner inout int integer intersect interval into is isnull join json
+	json_array json_arrayagg json_exists json_object json_objectagg json_query json_scalar
+	json_serialize json_table json_value lateral leading least left like limit localtime
+	localtimestamp merge_action national natural nchar none normalize not notnull null nullif
+	numeric offset on only or order out outer overlaps overlay placing position precision primary
+	real references returning right row select session_user setof similar smallint some substring
+	symmetric system_user table tablesample then time timestamp to trailing treat trim true union
+	unique user using values varchar variadic verbose when where window with xmlattributes
+	xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse xmlpi xmlroot xmlserialize
+	xmltable`)
+
+// wordSet returns the set of the whitespace separated words of a text
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(text) {
+		words[word] = true
+	}
+	return words
+}
+
+// quoteIdent quotes an identifier the way quote_ident does: unless made of lower case letters,
+// digits and underscores without leading digit, or when a keyword
+func quoteIdent(name string) string {
+	safe := name != "" && !quotedKeywords[name]
+	for i := 0; i < len(name) && safe; i++ {
+		c := name[i]
+		safe = c == '_' || (c >= 'a' && c <= 'z') || (i > 0 && isDigit(c))
+	}
+	if safe {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// validatePatterns checks that the schema or database patterns are valid glob patterns
+func validatePatterns(kind string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", kind, pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesPattern reports whether the schema or database name matches one of the glob patterns
+func matchesPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexps converts glob patterns to anchored regular expressions matching the same names, so
+// that the server can apply them: "*" matches any sequence, "?" a single character, and character
+// classes and escaped characters are kept
+func globRegexps(patterns []string) []string {
+	regexps := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		var b strings.Builder
+		b.WriteByte('^')
+		for i := 0; i < len(pattern); i++ {
+			switch c := pattern[i]; c {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteByte('.')
+			case '[':
+				end := strings.IndexByte(pattern[i+1:], ']')
+				if end < 0 {
+					b.WriteString(regexp.QuoteMeta(pattern[i:]))
+					i = len(pattern)
+					continue
+				}
+				class := pattern[i+1 : i+1+end]
+				b.WriteByte('[')
+				if strings.HasPrefix(class, "^") {
+					b.WriteByte('^')
+					class = class[1:]
+				}
+				for j := 0; j < len(class); j++ {
+					switch {
+					case class[j] == '\\' && j+1 < len(class) && class[j+1] == '-':
+						b.WriteString(`\-`)
+						j++
+					case class[j] == '\\' && j+1 < len(class):
+						b.WriteString(regexp.QuoteMeta(class[j+1 : j+2]))
+						j++
+					case class[j] == '-':
+						b.WriteByte('-')
+					default:
+						b.WriteString(regexp.QuoteMeta(class[j : j+1]))
+					}
+				}
+				b.WriteByte(']')
+				i += end + 1
+			case '\\':
+				if i+1 < len(pattern) {
+					i++
+				}
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			default:
+				b.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		b.WriteByte('$')
+		regexps = append(regexps, b.String())
+	}
+	return regexps
+}
+
+// SchemaInScope reports whether objects of the given schema are analyzed.
+// A schema is in scope when it matches one of IncludeSchemas (or IncludeSchemas is empty)
+// and none of ExcludeSchemas. Objects without schema (transactions, advisory locks...) are always in scope.
+func (o AnalyzerOptions) SchemaInScope(schema string) bool {
+	if schema == "" {
+		return true
+	}
+	if len(o.IncludeSchemas) > 0 && !matchesPattern(o.IncludeSchemas, schema) {
+		return false
+	}
+	return !matchesPattern(o.ExcludeSchemas, schema)
+}
+
+// filterSchemas removes the objects of the schemas out of scope from the collected data
+func filterSchemas(data *ReportData, opts AnalyzerOptions) {
+	if len(opts.IncludeSchemas) == 0 && len(opts.ExcludeSchemas) == 0 {
+		return
+	}
+
+	// Sessions waiting for an object out of scope leave the wait graph, and so the deadlocks,
+	// blocking trees, chains and blocked transactions derived from it
+	waitingOutOfScope := make(map[int]bool)
+	for _, lock := range data.Locks {
+		if !lock.Granted && !opts.SchemaInScope(lock.Schema) {
+			waitingOutOfScope[lock.PID] = true
+		}
+	}
+	if data.WaitGraph != nil {
+		var edges []WaitEdge
+		for _, edge := range data.WaitGraph.Edges {
+			if !waitingOutOfScope[edge.Waiter] {
+				edges = append(edges, edge)
+			}
+		}
+		data.WaitGraph = NewWaitGraph(edges)
+	}
+
+	var locks []LockInfo
+	for _, lock := range data.Locks {
+		if opts.SchemaInScope(lock.Schema) {
+			locks = append(locks, lock)
+		}
+	}
+	data.Locks = locks
+
+	var rowLocks []RowLockInfo
+	for _, rowLock := range data.RowLocks {
+		if opts.SchemaInScope(rowLock.Schema) {
+			rowLocks = append(rowLocks, rowLock)
+		}
+	}
+	data.RowLocks = rowLocks
+
+	var indexes []IndexInfo
+	for _, index := range data.IndexAnalysis {
+		if opts.SchemaInScope(index.Schema) {
+			indexes = append(indexes, index)
+		}
+	}
+	data.IndexAnalysis = indexes
+}
@@ -0,0 +1,142 @@
+package lockanalyzer
+
+import (
+	"path"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestSchemaInScope tests the include and exclude schema patterns
+func TestSchemaInScope(t *testing.T) {
+	opts := DefaultAnalyzerOptions()
+	opts.IncludeSchemas = []string{"tenant_*", "public"}
+	opts.ExcludeSchemas = []string{"tenant_archive*"}
+
+	tests := []struct {
+		schema  string
+		inScope bool
+	}{
+		{"public", true},
+		{"tenant_42", true},
+		{"tenant_archive_2023", false},
+		{"billing", false},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		if got := opts.SchemaInScope(tt.schema); got != tt.inScope {
+			t.Errorf("SchemaInScope(%q) = %v, expected %v", tt.schema, got, tt.inScope)
+		}
+	}
+
+	// Without patterns every schema is in scope
+	if !DefaultAnalyzerOptions().SchemaInScope("billing") {
+		t.Error("All schemas should be in scope by default")
+	}
+}
+
+// TestValidateSchemaPatterns tests that malformed schema patterns are rejected
+func TestValidateSchemaPatterns(t *testing.T) {
+	opts := DefaultAnalyzerOptions()
+	opts.ExcludeSchemas = []string{"tenant_[0-9"}
+
+	if err := opts.Validate(); err == nil {
+		t.Error("Malformed schema pattern should be rejected")
+	}
+
+	opts.ExcludeSchemas = []string{"tenant_[0-9]*"}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Valid schema pattern should be accepted, got: %v", err)
+	}
+}
+
+// TestFilterSchemas tests that objects of the schemas out of scope are removed from the report
+func TestFilterSchemas(t *testing.T) {
+	data := &ReportData{
+		Locks: []LockInfo{
+			{PID: 1, Schema: "tenant_a", Object: "tenant_a.orders"},
+			{PID: 2, Schema: "tenant_b", Object: "tenant_b.orders"},
+			{PID: 3, Type: "transactionid", Object: "N/A"},
+		},
+		RowLocks: []RowLockInfo{
+			{PID: 1, Schema: "tenant_a", Table: "tenant_a.orders"},
+			{PID: 2, Schema: "tenant_b", Table: "tenant_b.orders"},
+		},
+		IndexAnalysis: []IndexInfo{
+			{Schema: "tenant_b", Name: "tenant_b.orders_pkey", Table: "tenant_b.orders"},
+		},
+		// PID 4 waits for PID 2 on tenant_b, PID 5 for PID 1 on tenant_a
+		WaitGraph: NewWaitGraph([]WaitEdge{{Waiter: 4, Blocker: 2}, {Waiter: 5, Blocker: 1}}),
+	}
+	data.Locks = append(data.Locks,
+		LockInfo{PID: 4, Schema: "tenant_b", Object: "tenant_b.orders"},
+		LockInfo{PID: 5, Schema: "tenant_a", Object: "tenant_a.orders"})
+
+	opts := DefaultAnalyzerOptions()
+	opts.ExcludeSchemas = []string{"tenant_b"}
+	filterSchemas(data, opts)
+
+	if len(data.Locks) != 3 || data.Locks[0].Object != "tenant_a.orders" || data.Locks[1].PID != 3 {
+		t.Errorf("Expected tenant_a and schemaless locks, got: %+v", data.Locks)
+	}
+	if len(data.RowLocks) != 1 || data.RowLocks[0].Table != "tenant_a.orders" {
+		t.Errorf("Expected tenant_a row locks, got: %+v", data.RowLocks)
+	}
+	if len(data.IndexAnalysis) != 0 {
+		t.Errorf("Expected no index, got: %+v", data.IndexAnalysis)
+	}
+	if !reflect.DeepEqual(data.WaitGraph.Edges, []WaitEdge{{Waiter: 5, Blocker: 1}}) || !reflect.DeepEqual(data.WaitGraph.Nodes, []int{1, 5}) {
+		t.Errorf("Expected only the wait on tenant_a in the wait graph, got: %+v", data.WaitGraph)
+	}
+
+	// Identically named tables of different schemas are distinct conflicts
+	conflicts := detectObjectConflicts([]LockInfo{
+		{PID: 1, Mode: "AccessExclusiveLock", Granted: true, Type: "relation", Schema: "tenant_a", Object: "tenant_a.orders"},
+		{PID: 2, Mode: "AccessExclusiveLock", Granted: false, Type: "relation", Schema: "tenant_b", Object: "tenant_b.orders"},
+	})
+	if len(conflicts) != 0 {
+		t.Errorf("Tables of different schemas should not conflict, got: %+v", conflicts)
+	}
+}
+
+// TestQualifiedName tests that names are quoted like quote_ident does
+func TestQualifiedName(t *testing.T) {
+	tests := []struct {
+		schema, name, expected string
+	}{
+		{"public", "orders", "public.orders"},
+		{"", "orders_2024", "orders_2024"},
+		{"Tenant", "orders", `"Tenant".orders`},
+		{"a.b", "c", `"a.b".c`},
+		{"a", "b.c", `a."b.c"`},
+		{"public", "user", `public."user"`},
+		{"public", `say "hi"`, `public."say ""hi"""`},
+		{"public", "2fa", `public."2fa"`},
+		{"public", "price$", `public."price$"`},
+	}
+	for _, tt := range tests {
+		if got := qualifiedName(tt.schema, tt.name); got != tt.expected {
+			t.Errorf("qualifiedName(%q, %q): expected %s, got: %s", tt.schema, tt.name, tt.expected, got)
+		}
+	}
+}
+
+// TestGlobRegexps tests that the regular expressions sent to the server match the same schemas as
+// the glob patterns
+func TestGlobRegexps(t *testing.T) {
+	patterns := []string{"tenant_*", "public", "app?", "shard_[0-9]*", "[^a-c]x", `a\*b`, "v1.2", `[\-z]`}
+	names := []string{"tenant_", "tenant_42", "public", "publicx", "app1", "app", "apps2", "shard_3", "shard_x",
+		"dx", "ax", "a*b", "axb", "v1.2", "v1x2", "-", "z", "y"}
+
+	regexps := globRegexps(patterns)
+	for i, pattern := range patterns {
+		re := regexp.MustCompile(regexps[i])
+		for _, name := range names {
+			expected, _ := path.Match(pattern, name)
+			if got := re.MatchString(name); got != expected {
+				t.Errorf("Pattern %q as %q on %q: expected %v, got: %v", pattern, regexps[i], name, expected, got)
+			}
+		}
+	}
+}
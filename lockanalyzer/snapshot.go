@@ -0,0 +1,301 @@
+package lockanalyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Snapshot contains the raw rows read from the server for one report.
+// It holds no analysis, so that it can be saved and analyzed later or elsewhere with Analyze.
+type Snapshot struct {
+	Timestamp     time.Time
+	ServerVersion int
+	// Extensions are the versions of the extensions installed in the database the snapshot was
+	// taken from, by name (nil in the snapshots saved before extensions were collected)
+	Extensions map[string]string
+	// Databases are the databases of the server, pg_locks and pg_stat_activity covering all of them
+	Databases []DatabaseRow
+	Locks     []LockRow
+	Activity  []ActivityRow
+	// VacuumProgress are the rows of pg_stat_progress_vacuum, one per backend running VACUUM
+	VacuumProgress []VacuumProgressRow
+	Relations      []RelationRow
+	Indexes        []IndexRow
+	// RowLockTables are the tables scanned with pgrowlocks, by qualified name
+	RowLockTables []string
+	RowLocks      []RowLockRow
+	// DatabaseStats are the statistics of the analyzed database in pg_stat_database
+	DatabaseStats DatabaseStatsRow
+	// Settings holds the server settings used by the analysis, by name
+	Settings map[string]string
+	// PreparedXacts are the transactions prepared for two-phase commit, in every database
+	PreparedXacts []PreparedXactRow
+	// InRecovery is set when the server is a hot standby, LastReplayTime being the commit time
+	// of the last replayed transaction
+	InRecovery     bool
+	LastReplayTime time.Time
+	// ConflictSamples are the samples of pg_stat_database_conflicts taken on a standby, in order
+	ConflictSamples []ConflictSample
+	// Statements are the pg_stat_statements entries of the queries run by the blocking and
+	// blocked sessions
+	Statements      []StatementRow
+	CollectorErrors []CollectorError
+}
+
+// DatabaseRow is a row of pg_database
+type DatabaseRow struct {
+	OID  uint32
+	Name string
+	// Current is set for the database the snapshot was taken from
+	Current bool
+}
+
+// LockRow is a row of pg_locks. PID is 0 for the predicate locks (SIReadLock) kept after
+// their serializable transaction committed, and for the locks of prepared transactions.
+type LockRow struct {
+	PID      int
+	LockType string
+	// Database is the OID of the database of the locked object, 0 for objects shared by the
+	// whole server (transaction IDs, shared catalogs)
+	Database      uint32
+	Relation      uint32
+	Page          string
+	Tuple         string
+	VirtualXID    string
+	TransactionID string
+	ClassID       uint32
+	ObjID         uint32
+	ObjSubID      int
+	// VirtualTransaction is the virtual transaction holding or waiting for the lock,
+	// -1/<xid> for a prepared transaction
+	VirtualTransaction string
+	Mode               string
+	Granted            bool
+	WaitStart          time.Time
+}
+
+// ActivityRow is a row of pg_stat_activity, along with the result of pg_blocking_pids() for the session
+type ActivityRow struct {
+	PID int
+	// LeaderPID is the leader of a parallel worker, or the PID of a leader itself
+	// (0 otherwise, and before PostgreSQL 13)
+	LeaderPID int
+	// QueryID identifies the running query like pg_stat_statements.queryid (0 when
+	// compute_query_id is off, and before PostgreSQL 14)
+	QueryID int64
+	// Database is the database the session is connected to, empty for background processes
+	Database        string
+	Username        string
+	ApplicationName string
+	ClientAddr      string
+	BackendType     string
+	State           string
+	XactStart       time.Time
+	QueryStart      time.Time
+	StateChange     time.Time
+	WaitEventType   string
+	WaitEvent       string
+	Query           string
+	BlockingPIDs    []int
+}
+
+// RelationRow is a row of pg_class referenced by a lock. pg_class is per database: relations
+// are identified by the OID of their database and their own OID.
+type RelationRow struct {
+	// Database is the OID of the database of the relation, 0 for the catalogs shared by all databases
+	Database uint32
+	OID      uint32
+	Schema   string
+	Name     string
+	// Kind is the relkind of the relation (r for tables, i for indexes...)
+	Kind string
+}
+
+// IndexRow describes an index of a user schema
+type IndexRow struct {
+	Schema    string
+	Name      string
+	Table     string
+	SizeBytes int64
+}
+
+// RowLockRow is a row locked in a table scanned with pgrowlocks
+type RowLockRow struct {
+	Schema string
+	Table  string
+	// LockedRow is the tuple identifier of the row, e.g. (0,3)
+	LockedRow string
+	// Locker is the transaction ID locking the row, or the multixact ID when Multi is set
+	Locker string
+	Multi  bool
+	// XIDs, Modes and PIDs describe each transaction locking the row
+	XIDs  []string
+	Modes []string
+	PIDs  []int
+}
+
+// DatabaseStatsRow is the row of pg_stat_database of the analyzed database
+type DatabaseStatsRow struct {
+	Name         string
+	XactCommit   int64
+	XactRollback int64
+	Deadlocks    int64
+	StatsReset   time.Time
+}
+
+// Source produces the snapshots analyzed by the reports
+type Source interface {
+	// Snapshot returns the data of one report. A partial snapshot may be returned along with an error
+	// when the context is done.
+	Snapshot(ctx context.Context, opts AnalyzerOptions) (*Snapshot, error)
+}
+
+// Connector opens a connection to another database of the same server. The caller closes it.
+type Connector func(ctx context.Context, database string) (*bun.DB, error)
+
+// PostgresSource reads snapshots from a live PostgreSQL server
+type PostgresSource struct {
+	db      bun.IDB
+	connect Connector
+}
+
+// NewPostgresSource creates a source reading snapshots from the given database.
+// Relations locked in other databases are left unresolved.
+func NewPostgresSource(db bun.IDB) *PostgresSource {
+	return &PostgresSource{db: db}
+}
+
+// NewClusterSource creates a source reading snapshots from the given database and resolving the
+// relations locked in the databases matching AnalyzerOptions.Databases through connections opened
+// with connect, so that a single snapshot covers the whole server.
+func NewClusterSource(db bun.IDB, connect Connector) *PostgresSource {
+	return &PostgresSource{db: db, connect: connect}
+}
+
+// Snapshot reads the data of one report, running each collector within opts.QueryTimeout.
+// All collectors run in a single read-only REPEATABLE READ transaction and the snapshot timestamp is
+// the server time of that transaction. On a standby, the recovery conflicts are sampled once the
+// transaction is over (see collectConflictSamples). Collectors that fail or time out are listed in
+// Snapshot.CollectorErrors and the snapshot holds the data that could be retrieved.
+// The returned error is only set when the context itself is done, along with the partial snapshot.
+func (s *PostgresSource) Snapshot(ctx context.Context, opts AnalyzerOptions) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	db := s.db
+
+	// Open the transaction shared by all collectors
+	tx, timestamp, err := beginSnapshot(ctx, db)
+	if err != nil {
+		// Collect without transaction rather than returning nothing
+		snapshot.Timestamp = time.Now()
+		snapshot.CollectorErrors = append(snapshot.CollectorErrors, CollectorError{
+			Collector: snapshotCollector,
+			Error:     err.Error(),
+			TimedOut:  errors.Is(err, context.DeadlineExceeded),
+		})
+	} else {
+		snapshot.Timestamp = timestamp
+		db = tx
+	}
+
+	for _, c := range collectors {
+		if c.enabled != nil && !c.enabled(opts, snapshot) {
+			continue
+		}
+		runCollector(ctx, db, opts, snapshot, c)
+	}
+	// The snapshot ends before the recovery conflicts are sampled
+	if err == nil {
+		_ = tx.Rollback()
+	}
+
+	if snapshot.InRecovery {
+		s.collectConflictSamples(ctx, opts, snapshot)
+	}
+
+	if len(opts.Databases) > 0 {
+		s.collectDatabaseRelations(ctx, opts, snapshot)
+	}
+
+	return snapshot, ctx.Err()
+}
+
+// FileSource reads a snapshot saved as JSON with WriteSnapshot
+type FileSource struct {
+	path string
+}
+
+// NewFileSource creates a source reading the snapshot saved in the given file
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Snapshot reads the snapshot from the file
+func (s *FileSource) Snapshot(ctx context.Context, opts AnalyzerOptions) (*Snapshot, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot file %s: %v", s.path, err)
+	}
+	defer file.Close()
+
+	return ReadSnapshot(file)
+}
+
+// WriteSnapshot saves a snapshot as JSON
+func WriteSnapshot(snapshot *Snapshot, output io.Writer) error {
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		return fmt.Errorf("error encoding snapshot: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a snapshot saved as JSON with WriteSnapshot
+func ReadSnapshot(input io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(input).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding snapshot: %v", err)
+	}
+	return &snapshot, nil
+}
+
+// PreparedXactRow is a row of pg_prepared_xacts
+type PreparedXactRow struct {
+	TransactionID string
+	GID           string
+	Prepared      time.Time
+	Owner         string
+	Database      string
+}
+
+// VacuumProgressRow is a row of pg_stat_progress_vacuum
+type VacuumProgressRow struct {
+	PID             int
+	Relation        uint32
+	Phase           string
+	HeapBlksTotal   int64
+	HeapBlksScanned int64
+}
+
+// ConflictRow is a row of pg_stat_database_conflicts
+type ConflictRow struct {
+	Database   string
+	Tablespace int64
+	Lock       int64
+	Snapshot   int64
+	BufferPin  int64
+	Deadlock   int64
+}
+
+// ConflictSample is a sample of pg_stat_database_conflicts, taken at Time
+type ConflictSample struct {
+	Time      time.Time
+	Databases []ConflictRow
+}
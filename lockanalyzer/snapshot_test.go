@@ -0,0 +1,161 @@
+package lockanalyzer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// createTestSnapshot creates a snapshot where PID 2 waits for a row locked by PID 1,
+// PID 1 being idle in transaction
+func createTestSnapshot() *Snapshot {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return &Snapshot{
+		Timestamp:     now,
+		ServerVersion: 160002,
+		Locks: []LockRow{
+			{PID: 1, LockType: "relation", Relation: 16400, Mode: "RowExclusiveLock", Granted: true},
+			{PID: 1, LockType: "transactionid", TransactionID: "1234", Mode: "ExclusiveLock", Granted: true},
+			{PID: 2, LockType: "relation", Relation: 16400, Mode: "RowExclusiveLock", Granted: true},
+			{PID: 2, LockType: "tuple", Relation: 16400, Page: "0", Tuple: "3", Mode: "ExclusiveLock", Granted: true},
+			{PID: 2, LockType: "transactionid", TransactionID: "1234", Mode: "ShareLock", Granted: false,
+				WaitStart: now.Add(-4 * time.Second)},
+			{PID: 2, LockType: "tuple", Relation: 16400, Page: "0", Tuple: "5", Mode: "SIReadLock", Granted: true},
+			{PID: 3, LockType: "relation", Relation: 99999, Mode: "AccessShareLock", Granted: true},
+		},
+		Activity: []ActivityRow{
+			{PID: 1, ApplicationName: "api", State: "idle in transaction", StateChange: now.Add(-time.Minute),
+				Query: "UPDATE models SET state = 'done'"},
+			{PID: 2, ApplicationName: "worker", State: "active", QueryStart: now.Add(-8 * time.Second),
+				StateChange: now.Add(-8 * time.Second), WaitEventType: "Lock", WaitEvent: "transactionid",
+				Query: "UPDATE models SET state = 'failed'", BlockingPIDs: []int{1}},
+			{PID: 3, State: "active", QueryStart: now.Add(-time.Second), Query: "SELECT 1"},
+		},
+		Relations: []RelationRow{
+			{OID: 16400, Schema: "public", Name: "models"},
+		},
+		Indexes: []IndexRow{
+			{Schema: "public", Name: "models_pkey", Table: "models", SizeBytes: 16384},
+		},
+	}
+}
+
+// TestAnalyze tests the analysis of a snapshot without database
+func TestAnalyze(t *testing.T) {
+	data := Analyze(createTestSnapshot(), DefaultAnalyzerOptions())
+
+	if len(data.Locks) != 6 {
+		t.Fatalf("Expected 6 locks, got: %d", len(data.Locks))
+	}
+	if data.Locks[1].Object != "public.models" || data.Locks[1].ApplicationName != "api" {
+		t.Errorf("Locks should be joined with relations and sessions, got: %+v", data.Locks[1])
+	}
+	if data.Locks[5].Object != "99999" {
+		t.Errorf("Unknown relations should be named after their OID, got: %s", data.Locks[5].Object)
+	}
+
+	if len(data.BlockedTxns) != 1 || data.BlockedTxns[0].PID != 2 {
+		t.Fatalf("Expected PID 2 blocked, got: %+v", data.BlockedTxns)
+	}
+	if data.BlockedTxns[0].Duration != 4*time.Second {
+		t.Errorf("Expected a 4s wait from pg_locks.waitstart, got: %v", data.BlockedTxns[0].Duration)
+	}
+	if len(data.BlockedTxns[0].BlockingPIDs) != 1 || data.BlockedTxns[0].BlockingPIDs[0] != 1 {
+		t.Errorf("Expected PID 2 blocked by PID 1, got: %v", data.BlockedTxns[0].BlockingPIDs)
+	}
+
+	if len(data.LongTxns) != 1 || data.LongTxns[0].PID != 2 || data.LongTxns[0].Duration != 8*time.Second {
+		t.Errorf("Expected PID 2 running for 8s, got: %+v", data.LongTxns)
+	}
+	if len(data.IdleTxns) != 1 || data.IdleTxns[0].PID != 1 || data.IdleTxns[0].BlockedSessions != 1 {
+		t.Errorf("Expected PID 1 idle in transaction blocking 1 session, got: %+v", data.IdleTxns)
+	}
+	if len(data.RowLocks) != 1 || data.RowLocks[0].Table != "public.models" || data.RowLocks[0].Tuple != "3" {
+		t.Errorf("Expected the tuple lock of PID 2, got: %+v", data.RowLocks)
+	}
+	if len(data.IndexAnalysis) != 1 || data.IndexAnalysis[0].Name != "public.models_pkey" || data.IndexAnalysis[0].Size != "16 kB" {
+		t.Errorf("Expected public.models_pkey of 16 kB, got: %+v", data.IndexAnalysis)
+	}
+	if len(data.SSI.Relations) != 1 || data.SSI.Relations[0].TupleLocks != 1 || data.Summary.EscalatedPredicateLocks != 0 {
+		t.Errorf("Expected the predicate lock of PID 2 on public.models, got: %+v", data.SSI)
+	}
+	if data.Summary.TotalLocks != 6 || data.Summary.BlockedTxns != 1 {
+		t.Errorf("Unexpected summary: %+v", data.Summary)
+	}
+	if top := data.Summary.TopRootBlocker; top == nil || top.PID != 1 || top.TransitivelyBlocked != 1 {
+		t.Errorf("Expected PID 1 as top root blocker, got: %+v", top)
+	}
+}
+
+// TestAnalyzeWaitStartFallback tests the wait start of servers without pg_locks.waitstart
+func TestAnalyzeWaitStartFallback(t *testing.T) {
+	snapshot := createTestSnapshot()
+	snapshot.ServerVersion = 130011
+	for i := range snapshot.Locks {
+		snapshot.Locks[i].WaitStart = time.Time{}
+	}
+
+	data := Analyze(snapshot, DefaultAnalyzerOptions())
+
+	if len(data.BlockedTxns) != 1 || data.BlockedTxns[0].Duration != 8*time.Second {
+		t.Errorf("Expected the wait to start with the session state change, got: %+v", data.BlockedTxns)
+	}
+}
+
+// TestFileSource tests that a saved snapshot is analyzed like the original one
+func TestFileSource(t *testing.T) {
+	snapshot := createTestSnapshot()
+
+	var buf bytes.Buffer
+	if err := WriteSnapshot(snapshot, &buf); err != nil {
+		t.Fatalf("Error writing snapshot: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Error writing snapshot file: %v", err)
+	}
+
+	data, err := GenerateReport(context.Background(), NewFileSource(path), DefaultAnalyzerOptions())
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	expected := Analyze(snapshot, DefaultAnalyzerOptions())
+	if !data.Timestamp.Equal(expected.Timestamp) {
+		t.Errorf("Expected timestamp %v, got: %v", expected.Timestamp, data.Timestamp)
+	}
+	if !reflect.DeepEqual(data.Summary, expected.Summary) {
+		t.Errorf("Expected summary %+v, got: %+v", expected.Summary, data.Summary)
+	}
+
+	if _, err := NewFileSource(filepath.Join(t.TempDir(), "missing.json")).Snapshot(context.Background(), DefaultAnalyzerOptions()); err == nil {
+		t.Error("A missing snapshot file should be reported")
+	}
+}
+
+// TestPrettySize tests that sizes are formatted like pg_size_pretty()
+func TestPrettySize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 bytes"},
+		{10239, "10239 bytes"},
+		{10240, "10 kB"},
+		{16384, "16 kB"},
+		{20 * 1024 * 1024, "20 MB"},
+		{3 * 1024 * 1024 * 1024, "3072 MB"},
+		{30 * 1024 * 1024 * 1024, "30 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := prettySize(tt.size); got != tt.expected {
+			t.Errorf("prettySize(%d) = %s, expected %s", tt.size, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package lockanalyzer
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// predicateLockMode is the mode of the predicate locks taken by serializable transactions
+const predicateLockMode = "SIReadLock"
+
+// Serializable transactions take predicate locks (SIReadLock) on the tuples they read. When a
+// transaction holds more than max_pred_locks_per_page tuple locks on a page, they are promoted to
+// a page lock, and beyond max_pred_locks_per_relation page/tuple locks on a relation, to a
+// relation lock. Sequential scans take relation locks directly. The coarser the lock, the more
+// writes conflict with it, which shows up as serialization failures (SQLSTATE 40001).
+
+// PredicateLockInfo aggregates the predicate locks taken on a relation
+type PredicateLockInfo struct {
+	Database      string
+	Schema        string
+	Relation      string
+	TupleLocks    int
+	PageLocks     int
+	RelationLocks int
+	// Sessions is the number of running transactions holding predicate locks on the relation
+	Sessions int
+}
+
+// Escalated reports whether the relation is locked as a whole, any write to it then being
+// a potential serialization conflict
+func (p PredicateLockInfo) Escalated() bool {
+	return p.RelationLocks > 0
+}
+
+// Granularity returns the coarsest granularity of the predicate locks: relation, page or tuple
+func (p PredicateLockInfo) Granularity() string {
+	switch {
+	case p.RelationLocks > 0:
+		return "relation"
+	case p.PageLocks > 0:
+		return "page"
+	default:
+		return "tuple"
+	}
+}
+
+// SSIReport describes the predicate locks of serializable transactions along with the
+// transaction counters of the database
+type SSIReport struct {
+	// Relations are the relations with predicate locks, escalated relations first
+	Relations          []PredicateLockInfo
+	TotalLocks         int
+	EscalatedRelations int
+	// Sessions is the number of running transactions holding predicate locks
+	Sessions int
+	// CommittedLocks are the predicate locks kept after their transaction committed,
+	// until the overlapping serializable transactions end
+	CommittedLocks int
+
+	// PostgreSQL does not count serialization failures: they are part of the rollbacks
+	XactCommit   int64
+	XactRollback int64
+	StatsReset   time.Time
+
+	// RelationEscalationThreshold and PageEscalationThreshold are the number of page/tuple locks
+	// of a transaction on a relation, and of tuple locks on a page, beyond which they are promoted
+	// (0 when unknown)
+	RelationEscalationThreshold int
+	PageEscalationThreshold     int
+}
+
+// Transactions returns the number of transactions of the database that ended since the stats reset
+func (r SSIReport) Transactions() int64 {
+	return r.XactCommit + r.XactRollback
+}
+
+// RollbackRatio returns the share of the transactions of the database that rolled back
+func (r SSIReport) RollbackRatio() float64 {
+	if r.Transactions() == 0 {
+		return 0
+	}
+	return float64(r.XactRollback) / float64(r.Transactions())
+}
+
+// detectPredicateLocks aggregates the predicate locks of the snapshot by relation
+func detectPredicateLocks(snapshot *Snapshot, opts AnalyzerOptions) SSIReport {
+	report := SSIReport{
+		XactCommit:   snapshot.DatabaseStats.XactCommit,
+		XactRollback: snapshot.DatabaseStats.XactRollback,
+		StatsReset:   snapshot.DatabaseStats.StatsReset,
+	}
+	report.RelationEscalationThreshold, report.PageEscalationThreshold = escalationThresholds(snapshot.Settings)
+
+	databases, _ := databaseNames(snapshot.Databases)
+	names := newRelationIndex(snapshot.Relations)
+
+	relations := make(map[relationKey]*PredicateLockInfo)
+	relationSessions := make(map[relationKey]map[int]bool)
+	sessions := make(map[int]bool)
+	for _, row := range snapshot.Locks {
+		if row.Mode != predicateLockMode {
+			continue
+		}
+
+		relation, ok := names.lookup(row.Database, row.Relation)
+		if !ok {
+			relation = RelationRow{Name: strconv.FormatUint(uint64(row.Relation), 10)}
+		}
+		if !opts.SchemaInScope(relation.Schema) {
+			continue
+		}
+
+		key := relationKey{database: row.Database, oid: row.Relation}
+		info := relations[key]
+		if info == nil {
+			info = &PredicateLockInfo{
+				Database: databases[row.Database],
+				Schema:   relation.Schema,
+				Relation: qualifiedName(relation.Schema, relation.Name),
+			}
+			relations[key] = info
+			relationSessions[key] = make(map[int]bool)
+		}
+		switch row.LockType {
+		case "relation":
+			info.RelationLocks++
+		case "page":
+			info.PageLocks++
+		default:
+			info.TupleLocks++
+		}
+
+		report.TotalLocks++
+		if row.PID == 0 {
+			report.CommittedLocks++
+			continue
+		}
+		sessions[row.PID] = true
+		relationSessions[key][row.PID] = true
+	}
+
+	for key, info := range relations {
+		info.Sessions = len(relationSessions[key])
+		if info.Escalated() {
+			report.EscalatedRelations++
+		}
+		report.Relations = append(report.Relations, *info)
+	}
+	report.Sessions = len(sessions)
+
+	sort.Slice(report.Relations, func(i, j int) bool {
+		a, b := report.Relations[i], report.Relations[j]
+		if a.Escalated() != b.Escalated() {
+			return a.Escalated()
+		}
+		if a.TupleLocks+a.PageLocks+a.RelationLocks != b.TupleLocks+b.PageLocks+b.RelationLocks {
+			return a.TupleLocks+a.PageLocks+a.RelationLocks > b.TupleLocks+b.PageLocks+b.RelationLocks
+		}
+		if a.Relation != b.Relation {
+			return a.Relation < b.Relation
+		}
+		return a.Database < b.Database
+	})
+
+	return report
+}
+
+// escalationThresholds returns the predicate lock promotion thresholds from the server settings.
+// A negative max_pred_locks_per_relation is a divisor of max_pred_locks_per_transaction.
+func escalationThresholds(settings map[string]string) (int, int) {
+	perTransaction, _ := strconv.Atoi(settings["max_pred_locks_per_transaction"])
+	perRelation, _ := strconv.Atoi(settings["max_pred_locks_per_relation"])
+	perPage, _ := strconv.Atoi(settings["max_pred_locks_per_page"])
+
+	if perRelation < 0 {
+		perRelation = perTransaction / -perRelation
+	}
+	return perRelation, perPage
+}
@@ -0,0 +1,62 @@
+package lockanalyzer
+
+import "testing"
+
+// TestDetectPredicateLocks tests the aggregation of predicate locks by relation and granularity
+func TestDetectPredicateLocks(t *testing.T) {
+	snapshot := &Snapshot{
+		Relations: []RelationRow{
+			{OID: 1, Schema: "public", Name: "orders", Kind: "r"},
+			{OID: 2, Schema: "public", Name: "customers", Kind: "r"},
+			{OID: 3, Schema: "audit", Name: "events", Kind: "r"},
+		},
+		Locks: []LockRow{
+			// PID 10 scanned orders sequentially, PID 11 read two pages of it
+			{PID: 10, LockType: "relation", Relation: 1, Mode: predicateLockMode, Granted: true},
+			{PID: 11, LockType: "page", Relation: 1, Page: "0", Mode: predicateLockMode, Granted: true},
+			{PID: 11, LockType: "page", Relation: 1, Page: "1", Mode: predicateLockMode, Granted: true},
+			// PID 11 read rows of customers, one lock being kept for a committed transaction
+			{PID: 11, LockType: "tuple", Relation: 2, Page: "0", Tuple: "1", Mode: predicateLockMode, Granted: true},
+			{PID: 0, LockType: "tuple", Relation: 2, Page: "0", Tuple: "2", Mode: predicateLockMode, Granted: true},
+			{PID: 12, LockType: "relation", Relation: 3, Mode: predicateLockMode, Granted: true},
+			// Regular locks are left out
+			{PID: 10, LockType: "relation", Relation: 1, Mode: "AccessShareLock", Granted: true},
+		},
+		DatabaseStats: DatabaseStatsRow{XactCommit: 90, XactRollback: 10},
+		Settings: map[string]string{
+			"max_pred_locks_per_transaction": "64",
+			"max_pred_locks_per_relation":    "-2",
+			"max_pred_locks_per_page":        "2",
+		},
+	}
+
+	report := detectPredicateLocks(snapshot, AnalyzerOptions{ExcludeSchemas: []string{"audit"}})
+
+	if len(report.Relations) != 2 {
+		t.Fatalf("Expected 2 relations with predicate locks, got: %+v", report.Relations)
+	}
+	orders := report.Relations[0]
+	if orders.Relation != "public.orders" || !orders.Escalated() || orders.Granularity() != "relation" {
+		t.Errorf("Expected escalated public.orders first, got: %+v", orders)
+	}
+	if orders.RelationLocks != 1 || orders.PageLocks != 2 || orders.TupleLocks != 0 || orders.Sessions != 2 {
+		t.Errorf("Unexpected predicate locks on public.orders: %+v", orders)
+	}
+	customers := report.Relations[1]
+	if customers.Escalated() || customers.Granularity() != "tuple" || customers.TupleLocks != 2 || customers.Sessions != 1 {
+		t.Errorf("Unexpected predicate locks on public.customers: %+v", customers)
+	}
+
+	if report.TotalLocks != 5 || report.EscalatedRelations != 1 || report.Sessions != 2 || report.CommittedLocks != 1 {
+		t.Errorf("Unexpected totals: %+v", report)
+	}
+	if report.RelationEscalationThreshold != 32 || report.PageEscalationThreshold != 2 {
+		t.Errorf("Expected thresholds 32 and 2, got: %d and %d", report.RelationEscalationThreshold, report.PageEscalationThreshold)
+	}
+	if report.Transactions() != 100 || report.RollbackRatio() != 0.1 {
+		t.Errorf("Expected 100 transactions with 10%% rolled back, got: %d and %v", report.Transactions(), report.RollbackRatio())
+	}
+	if (SSIReport{}).RollbackRatio() != 0 {
+		t.Error("Rollback ratio should be 0 without transactions")
+	}
+}
@@ -0,0 +1,258 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// On a hot standby, the startup process replays the WAL of the primary, including the
+// AccessExclusiveLocks taken there by DDL, LOCK TABLE or the truncation of tables by VACUUM.
+// Queries needing a lock held by the replay wait for the startup process, and queries holding
+// up the replay (locks, snapshots still needing removed rows, pinned buffers) are cancelled after
+// max_standby_streaming_delay. Contention therefore shows up as cancelled queries, counted by
+// pg_stat_database_conflicts, rather than as long waits in pg_locks.
+
+// conflictSamplesCollector is the name under which a failure to sample the recovery conflicts is
+// recorded
+const conflictSamplesCollector = "recovery_conflicts"
+
+// startupBackendType is the backend_type of the process replaying the WAL in pg_stat_activity
+const startupBackendType = "startup"
+
+// standbySettings are the settings describing how the standby handles recovery conflicts
+var standbySettings = []string{
+	"max_standby_streaming_delay",
+	"max_standby_archive_delay",
+	"hot_standby_feedback",
+}
+
+// RecoveryConflicts counts the queries cancelled by recovery conflicts in a database
+type RecoveryConflicts struct {
+	Database   string
+	Tablespace int64
+	Lock       int64
+	Snapshot   int64
+	BufferPin  int64
+	Deadlock   int64
+}
+
+// Total returns the number of cancelled queries
+func (c RecoveryConflicts) Total() int64 {
+	return c.Tablespace + c.Lock + c.Snapshot + c.BufferPin + c.Deadlock
+}
+
+// ReplayWaiter is a session waiting for a lock held by the startup process
+type ReplayWaiter struct {
+	PID         int
+	Database    string
+	WaitTime    time.Duration
+	WaitingLock LockInfo
+	Query       string
+}
+
+// StandbyReport describes the recovery conflicts of a hot standby
+type StandbyReport struct {
+	// ReplayLag is the time elapsed since the last replayed transaction committed on the primary
+	// (0 when unknown). It also grows when the primary is idle.
+	ReplayLag      time.Duration
+	LastReplayTime time.Time
+	// Conflicts are the queries cancelled since the statistics were reset, per database with conflicts
+	Conflicts []RecoveryConflicts
+	// Deltas are the queries cancelled during the sample interval, per database
+	// (empty when a single sample was taken)
+	Deltas         []RecoveryConflicts
+	SampleInterval time.Duration
+	// StartupPID is the process replaying the WAL, StartupWaitEvent what it waits for, if anything
+	StartupPID       int
+	StartupWaitEvent string
+	ReplayWaiters    []ReplayWaiter
+	// Settings are the standby settings, by name
+	Settings map[string]string
+}
+
+// DeltaTotal returns the number of queries cancelled during the sample interval
+func (r StandbyReport) DeltaTotal() int64 {
+	var total int64
+	for _, delta := range r.Deltas {
+		total += delta.Total()
+	}
+	return total
+}
+
+// getRecoveryState reports whether the server is a standby in recovery, with the commit time of
+// the last replayed transaction
+func getRecoveryState(ctx context.Context, db bun.IDB) (bool, time.Time, error) {
+	var inRecovery bool
+	var lastReplay sql.NullTime
+	err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery(), pg_last_xact_replay_timestamp()").Scan(&inRecovery, &lastReplay)
+	return inRecovery, lastReplay.Time, err
+}
+
+// collectConflictSamples samples pg_stat_database_conflicts twice, opts.ConflictSampleInterval
+// apart, so that the conflicts happening while the report is taken can be told from the old ones.
+// A single sample is taken when the interval is 0. The samples are read once the snapshot
+// transaction is over: statistics read in a transaction are cached until its end, and waiting
+// inside it would hold the snapshot open. Each sample runs within opts.QueryTimeout, the interval
+// between them being waited for outside of the timeouts.
+func (s *PostgresSource) collectConflictSamples(ctx context.Context, opts AnalyzerOptions, snapshot *Snapshot) {
+	sample := collector{
+		name: conflictSamplesCollector,
+		collect: func(ctx context.Context, db bun.IDB, opts AnalyzerOptions, snapshot *Snapshot) error {
+			sample, err := getConflictSample(ctx, db)
+			if err != nil {
+				return err
+			}
+			snapshot.ConflictSamples = append(snapshot.ConflictSamples, sample)
+			return nil
+		},
+	}
+
+	runCollector(ctx, s.db, opts, snapshot, sample)
+	if opts.ConflictSampleInterval <= 0 || len(snapshot.ConflictSamples) == 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(opts.ConflictSampleInterval):
+	}
+	runCollector(ctx, s.db, opts, snapshot, sample)
+}
+
+// getConflictSample reads pg_stat_database_conflicts
+func getConflictSample(ctx context.Context, db bun.IDB) (ConflictSample, error) {
+	query := `
+		SELECT
+			clock_timestamp(),
+			datname,
+			confl_tablespace,
+			confl_lock,
+			confl_snapshot,
+			confl_bufferpin,
+			confl_deadlock
+		FROM pg_stat_database_conflicts
+		ORDER BY datname
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return ConflictSample{}, err
+	}
+	defer rows.Close()
+
+	var sample ConflictSample
+	for rows.Next() {
+		var row ConflictRow
+		err := rows.Scan(&sample.Time, &row.Database, &row.Tablespace, &row.Lock, &row.Snapshot, &row.BufferPin, &row.Deadlock)
+		if err != nil {
+			continue
+		}
+		sample.Databases = append(sample.Databases, row)
+	}
+
+	return sample, rows.Err()
+}
+
+// analyzeStandby builds the standby report, or returns nil when the server is not in recovery
+func analyzeStandby(snapshot *Snapshot, locks []LockInfo) *StandbyReport {
+	if !snapshot.InRecovery {
+		return nil
+	}
+
+	report := &StandbyReport{
+		LastReplayTime: snapshot.LastReplayTime,
+		Settings:       make(map[string]string),
+	}
+	if !snapshot.LastReplayTime.IsZero() && snapshot.Timestamp.After(snapshot.LastReplayTime) {
+		report.ReplayLag = snapshot.Timestamp.Sub(snapshot.LastReplayTime)
+	}
+	for _, name := range standbySettings {
+		if value, ok := snapshot.Settings[name]; ok {
+			report.Settings[name] = value
+		}
+	}
+
+	if len(snapshot.ConflictSamples) > 0 {
+		last := snapshot.ConflictSamples[len(snapshot.ConflictSamples)-1]
+		for _, row := range last.Databases {
+			if conflicts := RecoveryConflicts(row); conflicts.Total() > 0 {
+				report.Conflicts = append(report.Conflicts, conflicts)
+			}
+		}
+	}
+	if len(snapshot.ConflictSamples) > 1 {
+		first, last := snapshot.ConflictSamples[0], snapshot.ConflictSamples[len(snapshot.ConflictSamples)-1]
+		report.SampleInterval = last.Time.Sub(first.Time)
+		report.Deltas = conflictDeltas(first.Databases, last.Databases)
+	}
+
+	for _, session := range snapshot.Activity {
+		if session.BackendType == startupBackendType {
+			report.StartupPID = session.PID
+			if session.WaitEventType != "" && session.WaitEventType != "Activity" {
+				report.StartupWaitEvent = session.WaitEventType + ": " + session.WaitEvent
+			}
+		}
+	}
+	if report.StartupPID != 0 {
+		report.ReplayWaiters = detectReplayWaiters(snapshot.Activity, locks, report.StartupPID)
+	}
+
+	return report
+}
+
+// conflictDeltas returns the conflicts of each database between two samples, leaving out the
+// databases without new conflicts
+func conflictDeltas(first, last []ConflictRow) []RecoveryConflicts {
+	before := make(map[string]ConflictRow, len(first))
+	for _, row := range first {
+		before[row.Database] = row
+	}
+
+	var deltas []RecoveryConflicts
+	for _, row := range last {
+		previous := before[row.Database]
+		delta := RecoveryConflicts{
+			Database:   row.Database,
+			Tablespace: row.Tablespace - previous.Tablespace,
+			Lock:       row.Lock - previous.Lock,
+			Snapshot:   row.Snapshot - previous.Snapshot,
+			BufferPin:  row.BufferPin - previous.BufferPin,
+			Deadlock:   row.Deadlock - previous.Deadlock,
+		}
+		if delta.Total() > 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas
+}
+
+// detectReplayWaiters lists the sessions waiting for a lock held by the startup process, the
+// longest waits first
+func detectReplayWaiters(activity []ActivityRow, locks []LockInfo, startupPID int) []ReplayWaiter {
+	var waiters []ReplayWaiter
+	for _, session := range activity {
+		if !containsPID(session.BlockingPIDs, startupPID) {
+			continue
+		}
+		waiter := ReplayWaiter{PID: session.PID, Database: session.Database, Query: session.Query}
+		for _, lock := range locks {
+			if lock.PID == session.PID && !lock.Granted {
+				waiter.WaitingLock = lock
+				waiter.WaitTime = lock.WaitTime
+				break
+			}
+		}
+		waiters = append(waiters, waiter)
+	}
+
+	sort.SliceStable(waiters, func(i, j int) bool {
+		return waiters[i].WaitTime > waiters[j].WaitTime
+	})
+	return waiters
+}
@@ -0,0 +1,138 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// TestAnalyzeStandby tests the recovery conflicts and replay waits reported on a standby
+func TestAnalyzeStandby(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		Timestamp:      now,
+		InRecovery:     true,
+		LastReplayTime: now.Add(-3 * time.Second),
+		Settings: map[string]string{
+			"max_standby_streaming_delay": "30s",
+			"hot_standby_feedback":        "off",
+			"max_pred_locks_per_page":     "2",
+		},
+		Relations: []RelationRow{{OID: 16400, Schema: "public", Name: "orders", Kind: "r"}},
+		Locks: []LockRow{
+			{PID: 40, LockType: "relation", Relation: 16400, Mode: "AccessExclusiveLock", Granted: true},
+			{PID: 5, LockType: "relation", Relation: 16400, Mode: "AccessShareLock", Granted: false, WaitStart: now.Add(-2 * time.Second)},
+			{PID: 6, LockType: "relation", Relation: 16400, Mode: "AccessShareLock", Granted: false, WaitStart: now.Add(-8 * time.Second)},
+		},
+		Activity: []ActivityRow{
+			{PID: 40, BackendType: startupBackendType, WaitEventType: "Lock", WaitEvent: "relation"},
+			{PID: 5, BackendType: "client backend", Query: "SELECT * FROM orders", BlockingPIDs: []int{40}},
+			{PID: 6, BackendType: "client backend", Query: "SELECT count(*) FROM orders", BlockingPIDs: []int{40}},
+			{PID: 7, BackendType: "client backend", Query: "SELECT 1"},
+		},
+		ConflictSamples: []ConflictSample{
+			{Time: now.Add(-time.Second), Databases: []ConflictRow{
+				{Database: "shop", Lock: 2, Snapshot: 10},
+				{Database: "postgres"},
+			}},
+			{Time: now, Databases: []ConflictRow{
+				{Database: "shop", Lock: 3, Snapshot: 14, Deadlock: 1},
+				{Database: "postgres"},
+				{Database: "billing", BufferPin: 1},
+			}},
+		},
+	}
+
+	report := analyzeStandby(snapshot, buildLocks(snapshot))
+	if report == nil {
+		t.Fatal("Expected a standby report")
+	}
+
+	if report.ReplayLag != 3*time.Second || report.SampleInterval != time.Second {
+		t.Errorf("Expected a 3s replay lag sampled over 1s, got: %v over %v", report.ReplayLag, report.SampleInterval)
+	}
+	if len(report.Settings) != 2 || report.Settings["hot_standby_feedback"] != "off" {
+		t.Errorf("Expected the 2 standby settings, got: %v", report.Settings)
+	}
+	if len(report.Conflicts) != 2 || report.Conflicts[0].Database != "shop" || report.Conflicts[0].Total() != 18 {
+		t.Errorf("Expected the conflicts of shop and billing since the reset, got: %+v", report.Conflicts)
+	}
+
+	expected := []RecoveryConflicts{
+		{Database: "shop", Lock: 1, Snapshot: 4, Deadlock: 1},
+		{Database: "billing", BufferPin: 1},
+	}
+	if len(report.Deltas) != len(expected) {
+		t.Fatalf("Expected %d deltas, got: %+v", len(expected), report.Deltas)
+	}
+	for i, delta := range report.Deltas {
+		if delta != expected[i] {
+			t.Errorf("Expected delta %+v, got: %+v", expected[i], delta)
+		}
+	}
+	if report.DeltaTotal() != 7 {
+		t.Errorf("Expected 7 conflicts during the interval, got: %d", report.DeltaTotal())
+	}
+
+	if report.StartupPID != 40 || report.StartupWaitEvent != "Lock: relation" {
+		t.Errorf("Expected the startup process waiting for a lock, got: %d %q", report.StartupPID, report.StartupWaitEvent)
+	}
+	if len(report.ReplayWaiters) != 2 {
+		t.Fatalf("Expected 2 replay waiters, got: %+v", report.ReplayWaiters)
+	}
+	waiter := report.ReplayWaiters[0]
+	if waiter.PID != 6 || waiter.WaitTime != 8*time.Second || waiter.WaitingLock.Target() != "public.orders" {
+		t.Errorf("Expected PID 6 waiting 8s on public.orders first, got: %+v", waiter)
+	}
+}
+
+// TestAnalyzeStandbySingleSample tests the report of a single conflict sample, and of a primary
+func TestAnalyzeStandbySingleSample(t *testing.T) {
+	snapshot := &Snapshot{
+		InRecovery: true,
+		ConflictSamples: []ConflictSample{
+			{Databases: []ConflictRow{{Database: "shop", Snapshot: 3}}},
+		},
+	}
+
+	report := analyzeStandby(snapshot, nil)
+	if report == nil || len(report.Conflicts) != 1 || len(report.Deltas) != 0 || report.SampleInterval != 0 {
+		t.Errorf("Expected conflicts since the reset without deltas, got: %+v", report)
+	}
+	if report.ReplayLag != 0 || report.StartupPID != 0 {
+		t.Errorf("Expected no replay lag nor startup process, got: %+v", report)
+	}
+
+	snapshot.InRecovery = false
+	if report := analyzeStandby(snapshot, nil); report != nil {
+		t.Errorf("Expected no standby report on a primary, got: %+v", report)
+	}
+}
+
+// TestCollectConflictSamplesFailure tests that no second sample is waited for when the first one
+// fails
+func TestCollectConflictSamplesFailure(t *testing.T) {
+	sqldb, err := sql.Open("postgres", "postgres://localhost:1/unreachable?sslmode=disable")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db := bun.NewDB(sqldb, pgdialect.New())
+	defer db.Close()
+
+	opts := DefaultAnalyzerOptions()
+	opts.ConflictSampleInterval = time.Minute
+	snapshot := &Snapshot{InRecovery: true}
+
+	start := time.Now()
+	NewPostgresSource(db).collectConflictSamples(context.Background(), opts, snapshot)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the interval not to be waited for, took: %v", elapsed)
+	}
+	if len(snapshot.ConflictSamples) != 0 || len(snapshot.CollectorErrors) != 1 || snapshot.CollectorErrors[0].Collector != conflictSamplesCollector {
+		t.Errorf("Expected a single sample failure, got: %+v", snapshot.CollectorErrors)
+	}
+}
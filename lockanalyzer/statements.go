@@ -0,0 +1,446 @@
+package lockanalyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// pg_stat_statements aggregates the executions of each normalized statement. Linking the blocking
+// and blocked sessions to their statement tells a one-off administrative query from one of the
+// most executed statements of the application, which calls for a different fix. Sessions are
+// matched on pg_stat_activity.query_id (PostgreSQL 14 with compute_query_id), or else on their
+// query text once constants are replaced the way pg_stat_statements normalizes them.
+
+// hotStatementCalls is the number of calls from which a statement is deemed part of the regular
+// workload of the application
+const hotStatementCalls = 1000
+
+// defaultActivityQuerySize is the default of track_activity_query_size
+const defaultActivityQuerySize = 1024
+
+// StatementRow is an entry of pg_stat_statements, aggregated over the users running it
+type StatementRow struct {
+	// Database is the OID of the database the statement runs in
+	Database  uint32
+	QueryID   int64
+	Query     string
+	Calls     int64
+	TotalTime time.Duration
+}
+
+// StatementStats are the statistics of the statement run by a session
+type StatementStats struct {
+	QueryID   int64
+	Database  string
+	Query     string
+	Calls     int64
+	TotalTime time.Duration
+	MeanTime  time.Duration
+}
+
+// LockStatement is a statement run by blocking or blocked sessions
+type LockStatement struct {
+	Statement StatementStats
+	// BlockingPIDs are the sessions running the statement while blocking others
+	BlockingPIDs []int
+	// BlockedPIDs are the sessions running the statement while waiting for a lock
+	BlockedPIDs []int
+}
+
+// lockWaitSessions returns the sessions waiting for a lock or blocking others
+func lockWaitSessions(activity []ActivityRow) []ActivityRow {
+	blocking := make(map[int]bool)
+	for _, session := range activity {
+		for _, pid := range session.BlockingPIDs {
+			blocking[pid] = true
+		}
+	}
+
+	var sessions []ActivityRow
+	for _, session := range activity {
+		if len(session.BlockingPIDs) > 0 || blocking[session.PID] {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// getExtensions retrieves the versions of the extensions installed in the current database
+func getExtensions(ctx context.Context, db bun.IDB) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT extname, extversion FROM pg_extension")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	extensions := make(map[string]string)
+	for rows.Next() {
+		var name, version string
+		if err := rows.Scan(&name, &version); err != nil {
+			continue
+		}
+		extensions[name] = version
+	}
+
+	return extensions, rows.Err()
+}
+
+// statementTimeColumn returns the column of pg_stat_statements holding the total execution time,
+// renamed total_exec_time in version 1.8 of the extension (PostgreSQL 13) when planning time
+// started to be tracked
+func statementTimeColumn(caps capabilities) string {
+	version := strings.SplitN(caps.extensions["pg_stat_statements"], ".", 3)
+	if len(version) >= 2 {
+		major, _ := strconv.Atoi(version[0])
+		minor, _ := strconv.Atoi(version[1])
+		if major == 1 && minor < 8 {
+			return "total_time"
+		}
+	}
+	return "total_exec_time"
+}
+
+// activityQuerySize returns track_activity_query_size, the size in bytes up to which
+// pg_stat_activity keeps the query of a session, from its SHOW value (e.g. 1kB). The default of
+// 1kB is returned when unknown.
+func activityQuerySize(settings map[string]string) int {
+	value := settings["track_activity_query_size"]
+	unit := 1
+	switch {
+	case strings.HasSuffix(value, "kB"):
+		value, unit = strings.TrimSuffix(value, "kB"), 1<<10
+	case strings.HasSuffix(value, "MB"):
+		value, unit = strings.TrimSuffix(value, "MB"), 1<<20
+	}
+	if size, err := strconv.Atoi(strings.TrimSuffix(value, "B")); err == nil && size > 0 {
+		return size * unit
+	}
+	return defaultActivityQuerySize
+}
+
+// statementText is the normalized query of a session, compared with the text of the
+// pg_stat_statements entries. A query cut at track_activity_query_size is kept up to its last
+// complete token, which the text of its statement starts with.
+type statementText struct {
+	text      string
+	truncated bool
+}
+
+// sessionText returns the normalized query of a session
+func sessionText(session ActivityRow, querySize int) statementText {
+	text := normalizeQuery(session.Query)
+	if len(session.Query) < querySize-1 {
+		return statementText{text: text}
+	}
+	if i := strings.LastIndexByte(text, ' '); i >= 0 {
+		text = text[:i]
+	}
+	return statementText{text: text, truncated: true}
+}
+
+// matches reports whether a normalized statement text is the query of the session
+func (t statementText) matches(statement string) bool {
+	switch {
+	case t.text == "":
+		return false
+	case t.truncated:
+		return strings.HasPrefix(statement, t.text)
+	default:
+		return statement == t.text
+	}
+}
+
+// statementFilter tells the pg_stat_statements entries run by a set of sessions: by query ID for
+// the sessions that have one, by query text in their database for the others
+type statementFilter struct {
+	queryIDs map[int64]bool
+	texts    map[uint32][]statementText
+}
+
+// newStatementFilter returns the filter of the statements run by the given sessions
+func newStatementFilter(sessions []ActivityRow, databases []DatabaseRow, querySize int) statementFilter {
+	oids := make(map[string]uint32, len(databases))
+	for _, database := range databases {
+		oids[database.Name] = database.OID
+	}
+
+	filter := statementFilter{queryIDs: make(map[int64]bool), texts: make(map[uint32][]statementText)}
+	for _, session := range sessions {
+		if session.QueryID != 0 {
+			filter.queryIDs[session.QueryID] = true
+			continue
+		}
+		oid, ok := oids[session.Database]
+		if text := sessionText(session, querySize); ok && text.text != "" {
+			filter.texts[oid] = append(filter.texts[oid], text)
+		}
+	}
+	return filter
+}
+
+// keep reports whether a statement is run by one of the sessions
+func (f statementFilter) keep(statement StatementRow) bool {
+	if f.queryIDs[statement.QueryID] {
+		return true
+	}
+	texts := f.texts[statement.Database]
+	if len(texts) == 0 {
+		return false
+	}
+	normalized := normalizeQuery(statement.Query)
+	for _, text := range texts {
+		if text.matches(normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// getStatementRows retrieves the pg_stat_statements entries of the given sessions. The entries of
+// the databases of the sessions without query ID are read to find theirs by query text, and only
+// the matching ones are kept.
+func getStatementRows(ctx context.Context, db bun.IDB, caps capabilities, sessions []ActivityRow, databases []DatabaseRow, querySize int) ([]StatementRow, error) {
+	filter := newStatementFilter(sessions, databases, querySize)
+
+	var queryIDs []int64
+	for queryID := range filter.queryIDs {
+		queryIDs = append(queryIDs, queryID)
+	}
+	var textDatabases []uint32
+	for oid := range filter.texts {
+		textDatabases = append(textDatabases, oid)
+	}
+	sort.Slice(queryIDs, func(i, j int) bool { return queryIDs[i] < queryIDs[j] })
+	sort.Slice(textDatabases, func(i, j int) bool { return textDatabases[i] < textDatabases[j] })
+
+	var conditions []string
+	var args []interface{}
+	if len(queryIDs) > 0 {
+		conditions = append(conditions, "s.queryid IN (?)")
+		args = append(args, bun.In(queryIDs))
+	}
+	if len(textDatabases) > 0 {
+		conditions = append(conditions, "s.dbid IN (?)")
+		args = append(args, bun.In(textDatabases))
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			s.dbid,
+			s.queryid,
+			min(s.query),
+			sum(s.calls),
+			sum(s.%s)
+		FROM pg_stat_statements s
+		WHERE s.queryid IS NOT NULL AND (%s)
+		GROUP BY s.dbid, s.queryid
+		ORDER BY s.dbid, s.queryid
+	`, statementTimeColumn(caps), strings.Join(conditions, " OR "))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []StatementRow
+	for rows.Next() {
+		var statement StatementRow
+		var dbid int64
+		var totalMs float64
+		if err := rows.Scan(&dbid, &statement.QueryID, &statement.Query, &statement.Calls, &totalMs); err != nil {
+			continue
+		}
+		statement.Database = uint32(dbid)
+		statement.TotalTime = time.Duration(totalMs * float64(time.Millisecond))
+		if filter.keep(statement) {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements, rows.Err()
+}
+
+// statementKey identifies a statement of a database by query ID
+type statementKey struct {
+	database uint32
+	queryID  int64
+}
+
+// indexedStatement is a statement with its normalized text
+type indexedStatement struct {
+	statement *StatementRow
+	text      string
+}
+
+// statementIndex finds the statement run by a session
+type statementIndex struct {
+	statements map[statementKey]*StatementRow
+	// texts are the statements of each database along with their normalized text
+	texts     map[uint32][]indexedStatement
+	databases map[string]uint32
+	querySize int
+}
+
+// newStatementIndex indexes the statements of a snapshot
+func newStatementIndex(snapshot *Snapshot) statementIndex {
+	index := statementIndex{
+		statements: make(map[statementKey]*StatementRow, len(snapshot.Statements)),
+		texts:      make(map[uint32][]indexedStatement),
+		databases:  make(map[string]uint32, len(snapshot.Databases)),
+		querySize:  activityQuerySize(snapshot.Settings),
+	}
+	for _, database := range snapshot.Databases {
+		index.databases[database.Name] = database.OID
+	}
+	for i := range snapshot.Statements {
+		statement := &snapshot.Statements[i]
+		index.statements[statementKey{database: statement.Database, queryID: statement.QueryID}] = statement
+		index.texts[statement.Database] = append(index.texts[statement.Database],
+			indexedStatement{statement: statement, text: normalizeQuery(statement.Query)})
+	}
+	return index
+}
+
+// lookupText returns the statement of a database with the given text. The statement of a
+// truncated query is only known when a single statement starts with it.
+func (i statementIndex) lookupText(database uint32, text statementText) *StatementRow {
+	var found *StatementRow
+	for _, candidate := range i.texts[database] {
+		if !text.matches(candidate.text) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = candidate.statement
+	}
+	return found
+}
+
+// lookup returns the statistics of the statement run by a session, nil when unknown
+func (i statementIndex) lookup(session ActivityRow) *StatementStats {
+	database, ok := i.databases[session.Database]
+	if !ok {
+		return nil
+	}
+
+	statement := i.statements[statementKey{database: database, queryID: session.QueryID}]
+	if session.QueryID == 0 {
+		statement = i.lookupText(database, sessionText(session, i.querySize))
+	}
+	if statement == nil {
+		return nil
+	}
+
+	stats := &StatementStats{
+		QueryID:   statement.QueryID,
+		Database:  session.Database,
+		Query:     statement.Query,
+		Calls:     statement.Calls,
+		TotalTime: statement.TotalTime,
+	}
+	if statement.Calls > 0 {
+		stats.MeanTime = statement.TotalTime / time.Duration(statement.Calls)
+	}
+	return stats
+}
+
+// correlateStatements links the blocking and blocked sessions of a report to their statement and
+// lists the statements involved in lock waits, the most time consuming first
+func correlateStatements(data *ReportData, snapshot *Snapshot) []LockStatement {
+	if len(snapshot.Statements) == 0 {
+		return nil
+	}
+
+	// Sessions of the wait graph, which holds the lock waits on objects in scope
+	index := newStatementIndex(snapshot)
+	var waitSessions []ActivityRow
+	for _, session := range snapshot.Activity {
+		if data.WaitGraph != nil && (data.WaitGraph.IsWaiting(session.PID) || data.WaitGraph.IsBlocking(session.PID)) {
+			waitSessions = append(waitSessions, session)
+		}
+	}
+	sessions := make(map[int]*StatementStats)
+	for _, session := range waitSessions {
+		if stats := index.lookup(session); stats != nil {
+			sessions[session.PID] = stats
+		}
+	}
+
+	for i := range data.BlockedTxns {
+		data.BlockedTxns[i].Statement = sessions[data.BlockedTxns[i].PID]
+	}
+	for i := range data.BlockingTrees {
+		setNodeStatements(&data.BlockingTrees[i].Root, sessions)
+	}
+
+	type statementID struct {
+		database string
+		queryID  int64
+	}
+	byID := make(map[statementID]*LockStatement)
+	var statements []*LockStatement
+	for _, session := range waitSessions {
+		stats, ok := sessions[session.PID]
+		if !ok {
+			continue
+		}
+		id := statementID{database: stats.Database, queryID: stats.QueryID}
+		statement, ok := byID[id]
+		if !ok {
+			statement = &LockStatement{Statement: *stats}
+			byID[id] = statement
+			statements = append(statements, statement)
+		}
+		if data.WaitGraph.IsWaiting(session.PID) {
+			statement.BlockedPIDs = append(statement.BlockedPIDs, session.PID)
+		}
+		if data.WaitGraph.IsBlocking(session.PID) {
+			statement.BlockingPIDs = append(statement.BlockingPIDs, session.PID)
+		}
+	}
+
+	sort.SliceStable(statements, func(i, j int) bool {
+		return statements[i].Statement.TotalTime > statements[j].Statement.TotalTime
+	})
+
+	result := make([]LockStatement, 0, len(statements))
+	for _, statement := range statements {
+		result = append(result, *statement)
+	}
+	return result
+}
+
+// setNodeStatements sets the statement of the sessions of a blocking tree
+func setNodeStatements(node *BlockingNode, sessions map[int]*StatementStats) {
+	node.Statement = sessions[node.PID]
+	for i := range node.Waiters {
+		setNodeStatements(&node.Waiters[i], sessions)
+	}
+}
+
+// rootBlockerStatements tells whether root blockers run one-off statements, with hardly any
+// execution recorded, and statements of the regular workload
+func rootBlockerStatements(trees []BlockingTree) (oneOff, hot bool) {
+	for _, tree := range trees {
+		statement := tree.Root.Statement
+		switch {
+		case statement == nil:
+		case statement.Calls <= 1:
+			oneOff = true
+		case statement.Calls >= hotStatementCalls:
+			hot = true
+		}
+	}
+	return oneOff, hot
+}
@@ -0,0 +1,199 @@
+package lockanalyzer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createStatementSnapshot creates a snapshot where a one-off query blocks a DDL statement, itself
+// blocking two frequent application statements
+func createStatementSnapshot() *Snapshot {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return &Snapshot{
+		Timestamp:     now,
+		ServerVersion: 140005,
+		Extensions:    map[string]string{"pg_stat_statements": "1.9"},
+		Databases:     []DatabaseRow{{OID: 16384, Name: "app", Current: true}},
+		Relations:     []RelationRow{{OID: 16400, Database: 16384, Schema: "public", Name: "models", Kind: "r"}},
+		Locks: []LockRow{
+			{PID: 1, LockType: "relation", Database: 16384, Relation: 16400, Mode: "AccessShareLock", Granted: true},
+			{PID: 2, LockType: "relation", Database: 16384, Relation: 16400, Mode: "AccessExclusiveLock", Granted: false,
+				WaitStart: now.Add(-time.Minute)},
+			{PID: 3, LockType: "relation", Database: 16384, Relation: 16400, Mode: "AccessShareLock", Granted: false,
+				WaitStart: now.Add(-30 * time.Second)},
+			{PID: 4, LockType: "relation", Database: 16384, Relation: 16400, Mode: "RowExclusiveLock", Granted: false,
+				WaitStart: now.Add(-10 * time.Second)},
+		},
+		Activity: []ActivityRow{
+			{PID: 1, Database: "app", State: "active", Query: "SELECT count(*) FROM models", QueryID: 111},
+			{PID: 2, Database: "app", State: "active", Query: "ALTER TABLE models ADD COLUMN y int", BlockingPIDs: []int{1}},
+			{PID: 3, Database: "app", State: "active", Query: "SELECT * FROM models WHERE id = 42", QueryID: 222, BlockingPIDs: []int{2}},
+			// Without query ID, the statement is found by its text
+			{PID: 4, Database: "app", State: "active", Query: "INSERT INTO models\n  VALUES (2, 'it''s')", BlockingPIDs: []int{2}},
+			{PID: 5, Database: "app", State: "active", Query: "SELECT 1"},
+		},
+		Statements: []StatementRow{
+			{Database: 16384, QueryID: 111, Query: "SELECT count(*) FROM models", Calls: 1, TotalTime: 2 * time.Second},
+			{Database: 16384, QueryID: 222, Query: "SELECT * FROM models WHERE id = $1", Calls: 50000, TotalTime: 100 * time.Second},
+			{Database: 16384, QueryID: 333, Query: "INSERT INTO models VALUES ($1, $2)", Calls: 1200, TotalTime: 3 * time.Second},
+		},
+	}
+}
+
+// TestCorrelateStatements tests that the blocking and blocked sessions are linked to their statement
+func TestCorrelateStatements(t *testing.T) {
+	data := Analyze(createStatementSnapshot(), DefaultAnalyzerOptions())
+
+	var queryIDs []int64
+	for _, statement := range data.Statements {
+		queryIDs = append(queryIDs, statement.Statement.QueryID)
+	}
+	if expected := []int64{222, 333, 111}; !reflect.DeepEqual(queryIDs, expected) {
+		t.Fatalf("Expected the statements %v by total time, got: %v", expected, queryIDs)
+	}
+
+	hot := data.Statements[0]
+	if hot.Statement.MeanTime != 2*time.Millisecond || !reflect.DeepEqual(hot.BlockedPIDs, []int{3}) || len(hot.BlockingPIDs) != 0 {
+		t.Errorf("Unexpected statement of the blocked session: %+v", hot)
+	}
+	if blocker := data.Statements[2]; !reflect.DeepEqual(blocker.BlockingPIDs, []int{1}) {
+		t.Errorf("Expected PID 1 to run the blocking statement, got: %+v", blocker)
+	}
+
+	for _, txn := range data.BlockedTxns {
+		switch txn.PID {
+		case 2:
+			if txn.Statement != nil {
+				t.Errorf("Expected no statement for the DDL, got: %+v", txn.Statement)
+			}
+		case 4:
+			if txn.Statement == nil || txn.Statement.QueryID != 333 {
+				t.Errorf("Expected the insert to be found by its text, got: %+v", txn.Statement)
+			}
+		}
+	}
+
+	top := data.Summary.TopRootBlocker
+	if top == nil || top.Statement == nil || top.Statement.Calls != 1 {
+		t.Errorf("Expected the root blocker to carry its statement, got: %+v", top)
+	}
+	if len(data.BlockingTrees) != 1 || data.BlockingTrees[0].Root.Waiters[0].Waiters[0].Statement == nil {
+		t.Errorf("Expected the blocking tree sessions to carry their statement, got: %+v", data.BlockingTrees)
+	}
+
+	var oneOff bool
+	for _, suggestion := range data.Suggestions {
+		oneOff = oneOff || strings.Contains(suggestion, "one-off statements")
+	}
+	if !oneOff {
+		t.Errorf("Expected a suggestion for the one-off root blocker, got: %v", data.Suggestions)
+	}
+}
+
+// TestCorrelateStatementsWithoutExtension tests the report of a server without pg_stat_statements
+func TestCorrelateStatementsWithoutExtension(t *testing.T) {
+	snapshot := createStatementSnapshot()
+	snapshot.Extensions = map[string]string{}
+	snapshot.Statements = nil
+
+	data := Analyze(snapshot, DefaultAnalyzerOptions())
+	if len(data.Statements) != 0 {
+		t.Errorf("Expected no statements, got: %+v", data.Statements)
+	}
+	if len(data.UnsupportedFeatures) != 1 || data.UnsupportedFeatures[0].Feature != FeatureStatementStats {
+		t.Errorf("Expected pg_stat_statements to be reported missing, got: %+v", data.UnsupportedFeatures)
+	}
+
+	// Snapshots saved before extensions were collected do not tell
+	snapshot.Extensions = nil
+	if data := Analyze(snapshot, DefaultAnalyzerOptions()); len(data.UnsupportedFeatures) != 0 {
+		t.Errorf("Expected no unsupported features without extensions, got: %+v", data.UnsupportedFeatures)
+	}
+}
+
+// TestStatementTimeColumn tests the total time column of each pg_stat_statements version
+func TestStatementTimeColumn(t *testing.T) {
+	tests := map[string]string{
+		"1.7":  "total_time",
+		"1.8":  "total_exec_time",
+		"1.10": "total_exec_time",
+	}
+	for version, expected := range tests {
+		caps := capabilities{extensions: map[string]string{"pg_stat_statements": version}}
+		if got := statementTimeColumn(caps); got != expected {
+			t.Errorf("Version %s: expected %s, got: %s", version, expected, got)
+		}
+	}
+}
+
+// TestStatementFilter tests that only the statements of the sessions are kept from the entries of
+// their databases
+func TestStatementFilter(t *testing.T) {
+	long := "SELECT id, name, price, description, created_at FROM models WHERE category = 'books' AND price > 10"
+	sessions := []ActivityRow{
+		{PID: 1, Database: "app", Query: "SELECT * FROM models WHERE id = 42", QueryID: 222},
+		{PID: 2, Database: "app", Query: "INSERT INTO models VALUES (2, 'x')"},
+		{PID: 3, Database: "app", Query: long[:59]},
+	}
+	databases := []DatabaseRow{{OID: 16384, Name: "app", Current: true}, {OID: 16385, Name: "billing"}}
+	filter := newStatementFilter(sessions, databases, 60)
+
+	tests := []struct {
+		statement StatementRow
+		keep      bool
+	}{
+		{StatementRow{Database: 16384, QueryID: 222, Query: "SELECT * FROM models WHERE id = $1"}, true},
+		{StatementRow{Database: 16384, QueryID: 333, Query: "INSERT INTO models VALUES ($1, $2)"}, true},
+		{StatementRow{Database: 16384, QueryID: 444, Query: "DELETE FROM models WHERE id = $1"}, false},
+		{StatementRow{Database: 16385, QueryID: 555, Query: "INSERT INTO models VALUES ($1, $2)"}, false},
+		{StatementRow{Database: 16384, QueryID: 666, Query: strings.ReplaceAll(strings.ReplaceAll(long, "'books'", "$1"), "10", "$2")}, true},
+	}
+	for _, tt := range tests {
+		if got := filter.keep(tt.statement); got != tt.keep {
+			t.Errorf("keep(%d): expected %v, got: %v", tt.statement.QueryID, tt.keep, got)
+		}
+	}
+}
+
+// TestCorrelateTruncatedQueries tests that a query cut at track_activity_query_size is linked to
+// the only statement starting with it, and left unknown when several do
+func TestCorrelateTruncatedQueries(t *testing.T) {
+	long := "SELECT id, name, price, description, created_at, updated_at FROM models WHERE category = 'books' AND price > 10 ORDER BY id"
+	snapshot := createStatementSnapshot()
+	snapshot.Settings = map[string]string{"track_activity_query_size": "100B"}
+	snapshot.Activity[3].Query = long[:99]
+	snapshot.Statements[2].Query = "SELECT id, name, price, description, created_at, updated_at FROM models WHERE category = $1 AND price > $2 ORDER BY id"
+
+	data := Analyze(snapshot, DefaultAnalyzerOptions())
+	for _, txn := range data.BlockedTxns {
+		if txn.PID == 4 && (txn.Statement == nil || txn.Statement.QueryID != 333) {
+			t.Errorf("Expected the truncated query to be found by its beginning, got: %+v", txn.Statement)
+		}
+	}
+
+	snapshot.Statements = append(snapshot.Statements, StatementRow{Database: 16384, QueryID: 444, Calls: 5,
+		Query: "SELECT id, name, price, description, created_at, updated_at FROM models WHERE category = $1 AND price > $2 ORDER BY name"})
+	data = Analyze(snapshot, DefaultAnalyzerOptions())
+	for _, txn := range data.BlockedTxns {
+		if txn.PID == 4 && txn.Statement != nil {
+			t.Errorf("Expected the statement of an ambiguous truncated query to be unknown, got: %+v", txn.Statement)
+		}
+	}
+}
+
+// TestActivityQuerySize tests the parsing of track_activity_query_size
+func TestActivityQuerySize(t *testing.T) {
+	tests := map[string]int{
+		"1kB":   1024,
+		"4096B": 4096,
+		"1MB":   1 << 20,
+		"":      defaultActivityQuerySize,
+	}
+	for value, expected := range tests {
+		if got := activityQuerySize(map[string]string{"track_activity_query_size": value}); got != expected {
+			t.Errorf("activityQuerySize(%q): expected %d, got: %d", value, expected, got)
+		}
+	}
+}
@@ -62,13 +62,18 @@ type TestDB struct {
 	DB *bun.DB
 }
 
-// setupTestDB configures a test database with fixtures
-func setupTestDB(t *testing.T, fixtureFile string) *TestDB {
+// testDSN returns the connection string of the test database
+func testDSN() string {
 	dsn := os.Getenv("TEST_DATABASE_URL")
 	if dsn == "" {
 		dsn = "postgres://philippebouamriou@localhost:5432/testdb?sslmode=disable"
 	}
-	sqldb, err := sql.Open("postgres", dsn)
+	return dsn
+}
+
+// setupTestDB configures a test database with fixtures
+func setupTestDB(t *testing.T, fixtureFile string) *TestDB {
+	sqldb, err := sql.Open("postgres", testDSN())
 	if err != nil {
 		t.Fatalf("Database connection error: %v", err)
 	}
@@ -164,3 +169,18 @@ func (tdb *TestDB) cleanupTestDB() {
 		tdb.DB.Close()
 	}
 }
+
+// analyzeDB takes a snapshot of the test database and analyzes it with the default options
+func analyzeDB(t *testing.T, db bun.IDB) *ReportData {
+	t.Helper()
+
+	snapshot, err := NewPostgresSource(db).Snapshot(context.Background(), DefaultAnalyzerOptions())
+	if err != nil {
+		t.Fatalf("Error taking snapshot: %v", err)
+	}
+	if len(snapshot.CollectorErrors) > 0 {
+		t.Fatalf("Error collecting snapshot data: %v", snapshot.CollectorErrors)
+	}
+
+	return Analyze(snapshot, DefaultAnalyzerOptions())
+}
@@ -0,0 +1,195 @@
+package lockanalyzer
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pbouamriou/lock-analyzer/lockmodes"
+
+	"github.com/uptrace/bun"
+)
+
+// VACUUM takes a ShareUpdateExclusiveLock on the table, which conflicts with most DDL. An
+// autovacuum worker blocking another lock request is cancelled after deadlock_timeout, unless it
+// runs to prevent transaction ID wraparound: such a vacuum does not yield, and DDL queues behind it,
+// along with every query on the table queued behind the DDL. Conversely, a vacuum waiting for a
+// lock does not clean up the table, which is critical for a wraparound vacuum.
+
+// autovacuumBackendType is the backend_type of autovacuum workers in pg_stat_activity
+const autovacuumBackendType = "autovacuum worker"
+
+// VacuumInfo describes a backend running VACUUM, manually or as an autovacuum worker
+type VacuumInfo struct {
+	Auto bool
+	// Wraparound is set for the autovacuums run to prevent transaction ID wraparound
+	Wraparound bool
+	// Phase is the phase reported by pg_stat_progress_vacuum, empty when the backend only analyzes
+	Phase           string
+	HeapBlksTotal   int64
+	HeapBlksScanned int64
+}
+
+// Kind describes the vacuum: anti-wraparound autovacuum, autovacuum or VACUUM
+func (v VacuumInfo) Kind() string {
+	switch {
+	case v.Wraparound:
+		return "anti-wraparound autovacuum"
+	case v.Auto:
+		return "autovacuum"
+	default:
+		return "VACUUM"
+	}
+}
+
+// VacuumConflict is a vacuum blocking another session, or blocked by it
+type VacuumConflict struct {
+	Database   string
+	Schema     string
+	Object     string
+	VacuumPID  int
+	Vacuum     VacuumInfo
+	VacuumMode string
+	OtherPID   int
+	OtherMode  string
+	OtherQuery string
+	// WaitTime is how long the waiting session, vacuum or not, has waited
+	WaitTime       time.Duration
+	Recommendation string
+}
+
+// VacuumReport lists the lock conflicts involving vacuums
+type VacuumReport struct {
+	// Blocking are the vacuums holding a lock other sessions wait for, typically DDL
+	Blocking []VacuumConflict
+	// Blocked are the vacuums waiting for a lock held by other sessions
+	Blocked []VacuumConflict
+}
+
+// getVacuumProgressRows retrieves the rows of pg_stat_progress_vacuum
+func getVacuumProgressRows(ctx context.Context, db bun.IDB) ([]VacuumProgressRow, error) {
+	query := `
+		SELECT
+			pid,
+			relid,
+			phase,
+			heap_blks_total,
+			heap_blks_scanned
+		FROM pg_stat_progress_vacuum
+		ORDER BY pid
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var progress []VacuumProgressRow
+	for rows.Next() {
+		var row VacuumProgressRow
+		var relation sql.NullInt64
+		if err := rows.Scan(&row.PID, &relation, &row.Phase, &row.HeapBlksTotal, &row.HeapBlksScanned); err != nil {
+			continue
+		}
+		row.Relation = uint32(relation.Int64)
+		progress = append(progress, row)
+	}
+
+	return progress, rows.Err()
+}
+
+// classifyVacuum returns the vacuum run by a session, or nil when the session does not vacuum.
+// Autovacuum workers are recognized by their backend type and describe their work in their
+// query (e.g. "autovacuum: VACUUM public.orders (to prevent wraparound)"); manual vacuums by
+// their query or their pg_stat_progress_vacuum row.
+func classifyVacuum(session ActivityRow, progress VacuumProgressRow, inProgress bool) *VacuumInfo {
+	query := strings.ToUpper(strings.TrimSpace(session.Query))
+	auto := session.BackendType == autovacuumBackendType || strings.HasPrefix(query, "AUTOVACUUM:")
+	if !auto && !inProgress && !strings.HasPrefix(query, "VACUUM") {
+		return nil
+	}
+
+	vacuum := &VacuumInfo{
+		Auto:       auto,
+		Wraparound: auto && strings.Contains(query, "TO PREVENT WRAPAROUND"),
+	}
+	if inProgress {
+		vacuum.Phase = progress.Phase
+		vacuum.HeapBlksTotal = progress.HeapBlksTotal
+		vacuum.HeapBlksScanned = progress.HeapBlksScanned
+	}
+	return vacuum
+}
+
+// detectVacuumConflicts pairs the locks of vacuums with the conflicting locks of other sessions
+func detectVacuumConflicts(locks []LockInfo) VacuumReport {
+	objectMap := make(map[string][]LockInfo)
+	for _, lock := range locks {
+		key := lockTag(lock)
+		objectMap[key] = append(objectMap[key], lock)
+	}
+
+	var report VacuumReport
+	for _, objectLocks := range objectMap {
+		for _, waiter := range objectLocks {
+			if waiter.Granted {
+				continue
+			}
+			for _, holder := range objectLocks {
+				if !holder.Granted || holder.PID == waiter.PID || !lockmodes.ModesConflict(holder.Mode, waiter.Mode) {
+					continue
+				}
+				switch {
+				case holder.Vacuum != nil:
+					report.Blocking = append(report.Blocking, vacuumConflict(holder, waiter, waiter.WaitTime))
+				case waiter.Vacuum != nil:
+					report.Blocked = append(report.Blocked, vacuumConflict(waiter, holder, waiter.WaitTime))
+				}
+			}
+		}
+	}
+
+	for _, conflicts := range [][]VacuumConflict{report.Blocking, report.Blocked} {
+		sort.Slice(conflicts, func(i, j int) bool {
+			if conflicts[i].Vacuum.Wraparound != conflicts[j].Vacuum.Wraparound {
+				return conflicts[i].Vacuum.Wraparound
+			}
+			return conflicts[i].WaitTime > conflicts[j].WaitTime
+		})
+	}
+
+	return report
+}
+
+// vacuumConflict describes the conflict between the lock of a vacuum and the lock of another session
+func vacuumConflict(vacuum, other LockInfo, waitTime time.Duration) VacuumConflict {
+	conflict := VacuumConflict{
+		Database:   vacuum.Database,
+		Schema:     vacuum.Schema,
+		Object:     vacuum.Target(),
+		VacuumPID:  vacuum.PID,
+		Vacuum:     *vacuum.Vacuum,
+		VacuumMode: vacuum.Mode,
+		OtherPID:   other.PID,
+		OtherMode:  other.Mode,
+		OtherQuery: other.Query,
+		WaitTime:   waitTime,
+	}
+
+	switch {
+	case vacuum.Granted && conflict.Vacuum.Wraparound:
+		conflict.Recommendation = "Anti-wraparound autovacuum does not yield to DDL: let it finish, or VACUUM (FREEZE) the table before the migration"
+	case vacuum.Granted && conflict.Vacuum.Auto:
+		conflict.Recommendation = "Autovacuum is cancelled after deadlock_timeout; if the DDL keeps cancelling it, VACUUM the table manually beforehand"
+	case vacuum.Granted:
+		conflict.Recommendation = "Manual VACUUM keeps its lock until it ends: schedule it outside migrations"
+	case conflict.Vacuum.Wraparound:
+		conflict.Recommendation = "End the blocking transaction: the table cannot be frozen and approaches transaction ID wraparound"
+	default:
+		conflict.Recommendation = "Keep transactions short so that vacuum can clean up the table"
+	}
+	return conflict
+}
@@ -0,0 +1,96 @@
+package lockanalyzer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestClassifyVacuum tests the recognition of vacuum backends
+func TestClassifyVacuum(t *testing.T) {
+	tests := []struct {
+		name       string
+		session    ActivityRow
+		inProgress bool
+		expected   string
+	}{
+		{"wraparound", ActivityRow{BackendType: autovacuumBackendType, Query: "autovacuum: VACUUM public.orders (to prevent wraparound)"}, true, "anti-wraparound autovacuum"},
+		{"autovacuum", ActivityRow{BackendType: autovacuumBackendType, Query: "autovacuum: VACUUM ANALYZE public.orders"}, true, "autovacuum"},
+		{"autoanalyze", ActivityRow{BackendType: autovacuumBackendType, Query: "autovacuum: ANALYZE public.orders"}, false, "autovacuum"},
+		{"manual", ActivityRow{BackendType: "client backend", Query: "  vacuum (verbose) orders"}, false, "VACUUM"},
+		{"manual in progress", ActivityRow{BackendType: "client backend", Query: "/* maintenance */ VACUUM orders"}, true, "VACUUM"},
+		// A manual VACUUM FREEZE is not an anti-wraparound autovacuum, even if it mentions it
+		{"manual freeze", ActivityRow{BackendType: "client backend", Query: "VACUUM FREEZE orders -- to prevent wraparound"}, false, "VACUUM"},
+		{"query", ActivityRow{BackendType: "client backend", Query: "SELECT * FROM vacuum_jobs"}, false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			progress := VacuumProgressRow{Phase: "scanning heap", HeapBlksTotal: 10, HeapBlksScanned: 4}
+			vacuum := classifyVacuum(test.session, progress, test.inProgress)
+			if test.expected == "" {
+				if vacuum != nil {
+					t.Errorf("Expected no vacuum, got: %+v", vacuum)
+				}
+				return
+			}
+			if vacuum == nil || vacuum.Kind() != test.expected {
+				t.Fatalf("Expected %s, got: %+v", test.expected, vacuum)
+			}
+			if test.inProgress != (vacuum.Phase == "scanning heap") {
+				t.Errorf("Progress should only be set for the backends in pg_stat_progress_vacuum, got: %+v", vacuum)
+			}
+		})
+	}
+}
+
+// TestDetectVacuumConflicts tests that vacuums blocking DDL and blocked vacuums are reported
+func TestDetectVacuumConflicts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		Timestamp: now,
+		Relations: []RelationRow{
+			{OID: 1, Schema: "public", Name: "orders", Kind: "r"},
+			{OID: 2, Schema: "public", Name: "files", Kind: "r"},
+		},
+		Locks: []LockRow{
+			{PID: 7, LockType: "relation", Relation: 1, Mode: "ShareUpdateExclusiveLock", Granted: true},
+			{PID: 8, LockType: "relation", Relation: 1, Mode: "AccessExclusiveLock", Granted: false, WaitStart: now.Add(-30 * time.Second)},
+			// Reads do not conflict with vacuum
+			{PID: 11, LockType: "relation", Relation: 1, Mode: "AccessShareLock", Granted: true},
+			{PID: 9, LockType: "relation", Relation: 2, Mode: "ShareLock", Granted: true},
+			{PID: 10, LockType: "relation", Relation: 2, Mode: "ShareUpdateExclusiveLock", Granted: false, WaitStart: now.Add(-2 * time.Minute)},
+		},
+		Activity: []ActivityRow{
+			{PID: 7, BackendType: autovacuumBackendType, Query: "autovacuum: VACUUM public.orders (to prevent wraparound)"},
+			{PID: 8, BackendType: "client backend", Query: "ALTER TABLE orders ADD COLUMN note text"},
+			{PID: 9, BackendType: "client backend", Query: "CREATE INDEX ON files (name)"},
+			{PID: 10, BackendType: autovacuumBackendType, Query: "autovacuum: VACUUM public.files"},
+			{PID: 11, BackendType: "client backend", Query: "SELECT * FROM orders"},
+		},
+		VacuumProgress: []VacuumProgressRow{{PID: 7, Relation: 1, Phase: "scanning heap"}},
+	}
+
+	report := detectVacuumConflicts(buildLocks(snapshot))
+
+	if len(report.Blocking) != 1 {
+		t.Fatalf("Expected 1 blocking vacuum, got: %+v", report.Blocking)
+	}
+	blocking := report.Blocking[0]
+	if blocking.VacuumPID != 7 || !blocking.Vacuum.Wraparound || blocking.Vacuum.Phase != "scanning heap" || blocking.Object != "public.orders" {
+		t.Errorf("Expected the anti-wraparound autovacuum of public.orders, got: %+v", blocking)
+	}
+	if blocking.OtherPID != 8 || blocking.OtherMode != "AccessExclusiveLock" || blocking.WaitTime != 30*time.Second {
+		t.Errorf("Expected the ALTER TABLE waiting for 30s, got: %+v", blocking)
+	}
+
+	if len(report.Blocked) != 1 {
+		t.Fatalf("Expected 1 blocked vacuum, got: %+v", report.Blocked)
+	}
+	blocked := report.Blocked[0]
+	if blocked.VacuumPID != 10 || blocked.Vacuum.Wraparound || !blocked.Vacuum.Auto || blocked.OtherPID != 9 || blocked.WaitTime != 2*time.Minute {
+		t.Errorf("Expected the autovacuum of public.files blocked by PID 9, got: %+v", blocked)
+	}
+	if blocked.OtherQuery != "CREATE INDEX ON files (name)" {
+		t.Errorf("Expected the query of the holder, got: %s", blocked.OtherQuery)
+	}
+}
@@ -0,0 +1,244 @@
+package lockanalyzer
+
+import (
+	"slices"
+	"sort"
+)
+
+// WaitEdge represents a "waits for" relationship between two backends
+type WaitEdge struct {
+	Waiter  int
+	Blocker int
+}
+
+// WaitGraph contains the backends involved in lock waits and their "waits for" relationships.
+// It is built from pg_blocking_pids(), so an edge always denotes a real blocking relationship.
+// The prepared transactions, which have no backend, are the negation of their transaction ID.
+type WaitGraph struct {
+	Nodes []int
+	Edges []WaitEdge
+
+	blockers map[int][]int
+	waiters  map[int][]int
+}
+
+// NewWaitGraph creates a wait graph from a list of edges
+func NewWaitGraph(edges []WaitEdge) *WaitGraph {
+	graph := &WaitGraph{}
+	for _, edge := range edges {
+		graph.AddEdge(edge.Waiter, edge.Blocker)
+	}
+	return graph
+}
+
+// AddEdge records that waiter is waiting for blocker. Duplicate edges are ignored.
+func (g *WaitGraph) AddEdge(waiter, blocker int) {
+	g.index()
+	for _, pid := range g.blockers[waiter] {
+		if pid == blocker {
+			return
+		}
+	}
+
+	g.addNode(waiter)
+	g.addNode(blocker)
+	g.Edges = append(g.Edges, WaitEdge{Waiter: waiter, Blocker: blocker})
+	g.blockers[waiter] = append(g.blockers[waiter], blocker)
+	g.waiters[blocker] = append(g.waiters[blocker], waiter)
+}
+
+// BlockersOf returns the backends the given PID is waiting for
+func (g *WaitGraph) BlockersOf(pid int) []int {
+	g.index()
+	return g.blockers[pid]
+}
+
+// WaitersOf returns the backends waiting for the given PID
+func (g *WaitGraph) WaitersOf(pid int) []int {
+	g.index()
+	return g.waiters[pid]
+}
+
+// TransitiveWaitersOf returns the backends waiting for the given PID, directly or through
+// other waiting backends, in PID order
+func (g *WaitGraph) TransitiveWaitersOf(pid int) []int {
+	seen := map[int]bool{pid: true}
+	queue := []int{pid}
+	var waiters []int
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, waiter := range g.WaitersOf(current) {
+			if !seen[waiter] {
+				seen[waiter] = true
+				waiters = append(waiters, waiter)
+				queue = append(queue, waiter)
+			}
+		}
+	}
+	sort.Ints(waiters)
+	return waiters
+}
+
+// IsWaiting reports whether the given PID is waiting for another backend
+func (g *WaitGraph) IsWaiting(pid int) bool {
+	return len(g.BlockersOf(pid)) > 0
+}
+
+// IsBlocking reports whether at least one backend is waiting for the given PID
+func (g *WaitGraph) IsBlocking(pid int) bool {
+	return len(g.WaitersOf(pid)) > 0
+}
+
+// Cycles returns the groups of backends waiting for each other in a cycle, one per strongly
+// connected component of the graph. Each group is an actual cycle through the lowest PID of its
+// component, ordered along the wait relationships starting from that PID.
+func (g *WaitGraph) Cycles() [][]int {
+	var cycles [][]int
+	for _, component := range g.stronglyConnectedComponents() {
+		if len(component) > 1 {
+			cycles = append(cycles, g.orderCycle(component))
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+
+	return cycles
+}
+
+// stronglyConnectedComponents computes the strongly connected components of the graph (Tarjan)
+func (g *WaitGraph) stronglyConnectedComponents() [][]int {
+	g.index()
+
+	index := 0
+	indexes := make(map[int]int)
+	lowLinks := make(map[int]int)
+	onStack := make(map[int]bool)
+	var stack []int
+	var components [][]int
+
+	var visit func(pid int)
+	visit = func(pid int) {
+		indexes[pid] = index
+		lowLinks[pid] = index
+		index++
+		stack = append(stack, pid)
+		onStack[pid] = true
+
+		for _, blocker := range g.blockers[pid] {
+			if _, visited := indexes[blocker]; !visited {
+				visit(blocker)
+				lowLinks[pid] = min(lowLinks[pid], lowLinks[blocker])
+			} else if onStack[blocker] {
+				lowLinks[pid] = min(lowLinks[pid], indexes[blocker])
+			}
+		}
+
+		if lowLinks[pid] == indexes[pid] {
+			var component []int
+			for {
+				member := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[member] = false
+				component = append(component, member)
+				if member == pid {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, pid := range g.Nodes {
+		if _, visited := indexes[pid]; !visited {
+			visit(pid)
+		}
+	}
+
+	return components
+}
+
+// orderCycle returns a cycle of a component through its lowest PID, each member waiting for the
+// next one and the last one for the first. The shortest cycle is chosen: a component made of
+// several cycles is reported through one of them, its other members waiting for that cycle.
+func (g *WaitGraph) orderCycle(component []int) []int {
+	members := make(map[int]bool, len(component))
+	start := component[0]
+	for _, pid := range component {
+		members[pid] = true
+		start = min(start, pid)
+	}
+
+	// Breadth-first walk of the wait relationships back to the start, blockers in PID order
+	previous := map[int]int{start: start}
+	queue := []int{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		blockers := append([]int(nil), g.blockers[current]...)
+		sort.Ints(blockers)
+		for _, blocker := range blockers {
+			if !members[blocker] {
+				continue
+			}
+			if blocker == start {
+				var cycle []int
+				for pid := current; pid != start; pid = previous[pid] {
+					cycle = append(cycle, pid)
+				}
+				cycle = append(cycle, start)
+				slices.Reverse(cycle)
+				return cycle
+			}
+			if _, seen := previous[blocker]; !seen {
+				previous[blocker] = current
+				queue = append(queue, blocker)
+			}
+		}
+	}
+
+	// Not reached for a strongly connected component
+	return []int{start}
+}
+
+// cycleMembers returns the backends of the components containing a cycle, including those
+// outside the cycle reported for their component
+func (g *WaitGraph) cycleMembers() map[int]bool {
+	members := make(map[int]bool)
+	for _, component := range g.stronglyConnectedComponents() {
+		if len(component) > 1 {
+			for _, pid := range component {
+				members[pid] = true
+			}
+		}
+	}
+	return members
+}
+
+// addNode adds a PID to the node list, keeping it sorted
+func (g *WaitGraph) addNode(pid int) {
+	i := sort.SearchInts(g.Nodes, pid)
+	if i < len(g.Nodes) && g.Nodes[i] == pid {
+		return
+	}
+	g.Nodes = append(g.Nodes, 0)
+	copy(g.Nodes[i+1:], g.Nodes[i:])
+	g.Nodes[i] = pid
+}
+
+// index builds the adjacency maps from the edge list when needed
+// (e.g. for a graph decoded from JSON)
+func (g *WaitGraph) index() {
+	if g.blockers != nil {
+		return
+	}
+	g.blockers = make(map[int][]int)
+	g.waiters = make(map[int][]int)
+	for _, edge := range g.Edges {
+		g.blockers[edge.Waiter] = append(g.blockers[edge.Waiter], edge.Blocker)
+		g.waiters[edge.Blocker] = append(g.waiters[edge.Blocker], edge.Waiter)
+	}
+}
@@ -0,0 +1,153 @@
+package lockanalyzer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestWaitGraph tests wait graph construction
+func TestWaitGraph(t *testing.T) {
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 30, Blocker: 10},
+		{Waiter: 20, Blocker: 10},
+		{Waiter: 20, Blocker: 10}, // duplicate returned by pg_blocking_pids()
+		{Waiter: 40, Blocker: 20},
+	})
+
+	if len(graph.Edges) != 3 {
+		t.Errorf("Expected 3 edges, got: %d", len(graph.Edges))
+	}
+
+	expectedNodes := []int{10, 20, 30, 40}
+	if len(graph.Nodes) != len(expectedNodes) {
+		t.Fatalf("Expected nodes %v, got: %v", expectedNodes, graph.Nodes)
+	}
+	for i, pid := range expectedNodes {
+		if graph.Nodes[i] != pid {
+			t.Errorf("Expected nodes %v, got: %v", expectedNodes, graph.Nodes)
+			break
+		}
+	}
+
+	if waiters := graph.WaitersOf(10); len(waiters) != 2 {
+		t.Errorf("Expected 2 waiters for PID 10, got: %v", waiters)
+	}
+	if blockers := graph.BlockersOf(40); len(blockers) != 1 || blockers[0] != 20 {
+		t.Errorf("Expected PID 40 to wait for PID 20, got: %v", blockers)
+	}
+	if graph.IsWaiting(10) {
+		t.Error("PID 10 should not be waiting")
+	}
+	if !graph.IsBlocking(20) {
+		t.Error("PID 20 should be blocking")
+	}
+}
+
+// TestWaitGraphCycles tests cycle detection in the wait graph
+func TestWaitGraphCycles(t *testing.T) {
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 30, Blocker: 10},
+		{Waiter: 10, Blocker: 20},
+		{Waiter: 20, Blocker: 30},
+		{Waiter: 40, Blocker: 10},
+		{Waiter: 50, Blocker: 60},
+		{Waiter: 60, Blocker: 50},
+		{Waiter: 70, Blocker: 80},
+	})
+
+	cycles := graph.Cycles()
+	if len(cycles) != 2 {
+		t.Fatalf("Expected 2 cycles, got: %v", cycles)
+	}
+
+	// Cycles are ordered along the wait relationships from their lowest PID
+	expected := [][]int{{10, 20, 30}, {50, 60}}
+	for i, cycle := range expected {
+		if len(cycles[i]) != len(cycle) {
+			t.Fatalf("Expected cycles %v, got: %v", expected, cycles)
+		}
+		for j, pid := range cycle {
+			if cycles[i][j] != pid {
+				t.Errorf("Expected cycles %v, got: %v", expected, cycles)
+			}
+		}
+	}
+}
+
+// TestWaitGraphIntertwinedCycles tests that a component made of several cycles is reported through
+// an actual cycle
+func TestWaitGraphIntertwinedCycles(t *testing.T) {
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 10, Blocker: 20},
+		{Waiter: 20, Blocker: 10},
+		{Waiter: 20, Blocker: 30},
+		{Waiter: 30, Blocker: 20},
+		{Waiter: 40, Blocker: 30},
+	})
+
+	// 30 waits for 20, not for 10, so it cannot follow 20 in the cycle of 10
+	cycles := graph.Cycles()
+	if !reflect.DeepEqual(cycles, [][]int{{10, 20}}) {
+		t.Errorf("Expected the cycle [10 20], got: %v", cycles)
+	}
+
+	if chains := detectBlockingChains(graph, nil, nil); len(chains) != 0 {
+		t.Errorf("Expected the waiters of the cycle to be left out of chains, got: %v", chains)
+	}
+}
+
+// TestWaitGraphFromJSON tests that a decoded wait graph can be queried
+func TestWaitGraphFromJSON(t *testing.T) {
+	content, err := json.Marshal(NewWaitGraph([]WaitEdge{{Waiter: 2, Blocker: 1}}))
+	if err != nil {
+		t.Fatalf("Error encoding wait graph: %v", err)
+	}
+
+	var graph WaitGraph
+	if err := json.Unmarshal(content, &graph); err != nil {
+		t.Fatalf("Error decoding wait graph: %v", err)
+	}
+
+	if blockers := graph.BlockersOf(2); len(blockers) != 1 || blockers[0] != 1 {
+		t.Errorf("Expected PID 2 to wait for PID 1, got: %v", blockers)
+	}
+}
+
+// TestGetWaitGraph tests wait graph retrieval
+func TestGetWaitGraph(t *testing.T) {
+	tdb := setupTestDB(t, "fixture_test.yml")
+	defer tdb.cleanupTestDB()
+
+	graph := analyzeDB(t, tdb.DB).WaitGraph
+
+	// On an idle database, there may not be any blocking relationship
+	t.Logf("Number of waiting relationships detected: %d", len(graph.Edges))
+}
+
+// TestWaitGraphTransitiveWaiters tests the direct and indirect waiters of a backend
+func TestWaitGraphTransitiveWaiters(t *testing.T) {
+	// 4 and 3 wait for 2, 2 waits for 1, 1 and 5 wait for each other
+	graph := NewWaitGraph([]WaitEdge{
+		{Waiter: 2, Blocker: 1},
+		{Waiter: 3, Blocker: 2},
+		{Waiter: 4, Blocker: 2},
+		{Waiter: 1, Blocker: 5},
+		{Waiter: 5, Blocker: 1},
+	})
+
+	waiters := graph.TransitiveWaitersOf(2)
+	if len(waiters) != 2 || waiters[0] != 3 || waiters[1] != 4 {
+		t.Errorf("Expected waiters [3 4], got: %v", waiters)
+	}
+
+	// The cycle must not loop forever nor list the backend itself
+	waiters = graph.TransitiveWaitersOf(1)
+	if len(waiters) != 4 || containsPID(waiters, 1) {
+		t.Errorf("Expected waiters [2 3 4 5], got: %v", waiters)
+	}
+
+	if len(graph.TransitiveWaitersOf(3)) != 0 {
+		t.Error("Backend 3 should have no waiters")
+	}
+}
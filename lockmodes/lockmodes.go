@@ -0,0 +1,162 @@
+// Package lockmodes encodes the conflicts between PostgreSQL lock modes.
+//
+// Table-level modes are the heavyweight lock modes reported by pg_locks. They apply to every
+// lock type of the default lock method (relations, transaction IDs, tuples, advisory locks...).
+// Row-level modes are the ones taken by SELECT ... FOR UPDATE/SHARE and by row updates; they
+// are reported by pgrowlocks and are not visible in pg_locks.
+//
+// See https://www.postgresql.org/docs/current/explicit-locking.html
+package lockmodes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode is a table-level lock mode, from the weakest to the strongest
+type Mode int
+
+// Table-level lock modes
+const (
+	AccessShare Mode = iota + 1
+	RowShare
+	RowExclusive
+	ShareUpdateExclusive
+	Share
+	ShareRowExclusive
+	Exclusive
+	AccessExclusive
+)
+
+// modeNames are the names of the table-level modes in pg_locks
+var modeNames = map[Mode]string{
+	AccessShare:          "AccessShareLock",
+	RowShare:             "RowShareLock",
+	RowExclusive:         "RowExclusiveLock",
+	ShareUpdateExclusive: "ShareUpdateExclusiveLock",
+	Share:                "ShareLock",
+	ShareRowExclusive:    "ShareRowExclusiveLock",
+	Exclusive:            "ExclusiveLock",
+	AccessExclusive:      "AccessExclusiveLock",
+}
+
+// conflicts lists the modes each table-level mode conflicts with
+var conflicts = map[Mode][]Mode{
+	AccessShare:          {AccessExclusive},
+	RowShare:             {Exclusive, AccessExclusive},
+	RowExclusive:         {Share, ShareRowExclusive, Exclusive, AccessExclusive},
+	ShareUpdateExclusive: {ShareUpdateExclusive, Share, ShareRowExclusive, Exclusive, AccessExclusive},
+	Share:                {RowExclusive, ShareUpdateExclusive, ShareRowExclusive, Exclusive, AccessExclusive},
+	ShareRowExclusive:    {RowExclusive, ShareUpdateExclusive, Share, ShareRowExclusive, Exclusive, AccessExclusive},
+	Exclusive:            {RowShare, RowExclusive, ShareUpdateExclusive, Share, ShareRowExclusive, Exclusive, AccessExclusive},
+	AccessExclusive:      {AccessShare, RowShare, RowExclusive, ShareUpdateExclusive, Share, ShareRowExclusive, Exclusive, AccessExclusive},
+}
+
+// String returns the name of the mode in pg_locks (e.g. RowExclusiveLock)
+func (m Mode) String() string {
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses a table-level mode, either as named in pg_locks (RowExclusiveLock)
+// or as written in a LOCK statement (ROW EXCLUSIVE)
+func ParseMode(name string) (Mode, error) {
+	normalized := normalize(name)
+	for mode, modeName := range modeNames {
+		if normalized == normalize(modeName) || normalized+"lock" == normalize(modeName) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown lock mode: %s", name)
+}
+
+// Conflicts reports whether locks of the two modes on the same object conflict.
+// The relation is symmetric.
+func Conflicts(a, b Mode) bool {
+	for _, mode := range conflicts[a] {
+		if mode == b {
+			return true
+		}
+	}
+	return false
+}
+
+// ModesConflict reports whether two modes named as in pg_locks conflict.
+// Modes that are not table-level modes, such as SIReadLock, never conflict.
+func ModesConflict(a, b string) bool {
+	modeA, err := ParseMode(a)
+	if err != nil {
+		return false
+	}
+	modeB, err := ParseMode(b)
+	if err != nil {
+		return false
+	}
+	return Conflicts(modeA, modeB)
+}
+
+// RowMode is a row-level lock mode, from the weakest to the strongest
+type RowMode int
+
+// Row-level lock modes
+const (
+	ForKeyShare RowMode = iota + 1
+	ForShare
+	ForNoKeyUpdate
+	ForUpdate
+)
+
+// rowModeNames are the names of the row-level modes in SELECT statements
+var rowModeNames = map[RowMode]string{
+	ForKeyShare:    "FOR KEY SHARE",
+	ForShare:       "FOR SHARE",
+	ForNoKeyUpdate: "FOR NO KEY UPDATE",
+	ForUpdate:      "FOR UPDATE",
+}
+
+// rowConflicts lists the modes each row-level mode conflicts with
+var rowConflicts = map[RowMode][]RowMode{
+	ForKeyShare:    {ForUpdate},
+	ForShare:       {ForNoKeyUpdate, ForUpdate},
+	ForNoKeyUpdate: {ForShare, ForNoKeyUpdate, ForUpdate},
+	ForUpdate:      {ForKeyShare, ForShare, ForNoKeyUpdate, ForUpdate},
+}
+
+// String returns the name of the mode in a SELECT statement (e.g. FOR NO KEY UPDATE)
+func (m RowMode) String() string {
+	if name, ok := rowModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("RowMode(%d)", int(m))
+}
+
+// ParseRowMode parses a row-level mode, either as written in a SELECT statement (FOR NO KEY UPDATE)
+// or as reported by pgrowlocks (For No Key Update). The pgrowlocks modes of updated rows,
+// Update and No Key Update, lock the rows like FOR UPDATE and FOR NO KEY UPDATE.
+func ParseRowMode(name string) (RowMode, error) {
+	normalized := strings.TrimPrefix(normalize(name), "for")
+	for mode, modeName := range rowModeNames {
+		if normalized == strings.TrimPrefix(normalize(modeName), "for") {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown row lock mode: %s", name)
+}
+
+// RowConflicts reports whether row locks of the two modes on the same row conflict.
+// The relation is symmetric.
+func RowConflicts(a, b RowMode) bool {
+	for _, mode := range rowConflicts[a] {
+		if mode == b {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases a mode name and removes its spaces and underscores
+func normalize(name string) string {
+	return strings.NewReplacer(" ", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
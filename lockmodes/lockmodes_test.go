@@ -0,0 +1,112 @@
+package lockmodes
+
+import "testing"
+
+// TestConflicts tests the table-level conflict matrix against the PostgreSQL documentation
+func TestConflicts(t *testing.T) {
+	// Each row lists, from AccessShare to AccessExclusive, whether the modes conflict
+	expected := map[Mode][8]bool{
+		AccessShare:          {false, false, false, false, false, false, false, true},
+		RowShare:             {false, false, false, false, false, false, true, true},
+		RowExclusive:         {false, false, false, false, true, true, true, true},
+		ShareUpdateExclusive: {false, false, false, true, true, true, true, true},
+		Share:                {false, false, true, true, false, true, true, true},
+		ShareRowExclusive:    {false, false, true, true, true, true, true, true},
+		Exclusive:            {false, true, true, true, true, true, true, true},
+		AccessExclusive:      {true, true, true, true, true, true, true, true},
+	}
+
+	for a, row := range expected {
+		for i, conflict := range row {
+			b := Mode(i + 1)
+			if Conflicts(a, b) != conflict {
+				t.Errorf("Expected conflict between %s and %s: %v", a, b, conflict)
+			}
+			if Conflicts(a, b) != Conflicts(b, a) {
+				t.Errorf("Conflict between %s and %s should be symmetric", a, b)
+			}
+		}
+	}
+}
+
+// TestRowConflicts tests the row-level conflict matrix against the PostgreSQL documentation
+func TestRowConflicts(t *testing.T) {
+	expected := map[RowMode][4]bool{
+		ForKeyShare:    {false, false, false, true},
+		ForShare:       {false, false, true, true},
+		ForNoKeyUpdate: {false, true, true, true},
+		ForUpdate:      {true, true, true, true},
+	}
+
+	for a, row := range expected {
+		for i, conflict := range row {
+			b := RowMode(i + 1)
+			if RowConflicts(a, b) != conflict {
+				t.Errorf("Expected conflict between %s and %s: %v", a, b, conflict)
+			}
+		}
+	}
+}
+
+// TestParseMode tests parsing of pg_locks and LOCK statement mode names
+func TestParseMode(t *testing.T) {
+	tests := map[string]Mode{
+		"AccessShareLock":          AccessShare,
+		"ShareUpdateExclusiveLock": ShareUpdateExclusive,
+		"ROW EXCLUSIVE":            RowExclusive,
+		"access exclusive":         AccessExclusive,
+		"Share":                    Share,
+	}
+	for name, expected := range tests {
+		mode, err := ParseMode(name)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", name, err)
+			continue
+		}
+		if mode != expected {
+			t.Errorf("Expected %s for %s, got: %s", expected, name, mode)
+		}
+	}
+
+	if _, err := ParseMode("SIReadLock"); err == nil {
+		t.Error("SIReadLock should not be a table-level mode")
+	}
+}
+
+// TestParseRowMode tests parsing of SELECT and pgrowlocks mode names
+func TestParseRowMode(t *testing.T) {
+	tests := map[string]RowMode{
+		"FOR KEY SHARE":     ForKeyShare,
+		"For Share":         ForShare,
+		"For No Key Update": ForNoKeyUpdate,
+		"No Key Update":     ForNoKeyUpdate,
+		"Update":            ForUpdate,
+	}
+	for name, expected := range tests {
+		mode, err := ParseRowMode(name)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", name, err)
+			continue
+		}
+		if mode != expected {
+			t.Errorf("Expected %s for %s, got: %s", expected, name, mode)
+		}
+	}
+
+	if _, err := ParseRowMode("ExclusiveLock"); err == nil {
+		t.Error("ExclusiveLock should not be a row-level mode")
+	}
+}
+
+// TestModesConflict tests the conflicts of modes named as in pg_locks
+func TestModesConflict(t *testing.T) {
+	if ModesConflict("AccessShareLock", "AccessShareLock") {
+		t.Error("Two AccessShareLock should not conflict")
+	}
+	if !ModesConflict("ShareLock", "RowExclusiveLock") {
+		t.Error("ShareLock and RowExclusiveLock should conflict")
+	}
+	if ModesConflict("SIReadLock", "AccessExclusiveLock") {
+		t.Error("SIReadLock should not conflict with any mode")
+	}
+}